@@ -0,0 +1,48 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"os"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/metrics"
+)
+
+//Version is set at build time with -ldflags "-X main.Version=<tag>"
+var Version = "dev"
+
+//adminListenAddr is the address of the separate admin listener, ADMIN_LISTEN_ADDR e.g. :9090. When it is not set the
+//admin routes, apart from pprof, are served on the main port alongside the downloads
+func adminListenAddr() string {
+	return os.Getenv("ADMIN_LISTEN_ADDR")
+}
+
+//newAdminRouter serves the operational endpoints which should not be reachable publicly
+func newAdminRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	registerOperationalRoutes(mux)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+func registerOperationalRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", readyHandler)
+	mux.HandleFunc("/metrics", func(rw http.ResponseWriter, r *http.Request) {
+		metrics.DefaultRegistry.ServeHTTP(rw, r)
+	})
+	mux.HandleFunc("/version", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("content-type", "text/plain")
+		rw.Write([]byte(Version))
+	})
+	if expvarEnabled() {
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+}
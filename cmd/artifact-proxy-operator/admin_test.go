@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOperationalRoutesSharedByDefault(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+
+	for _, target := range []string{"/healthz", "/readyz", "/metrics", "/version"} {
+		if rec := env.do("GET", target, nil); rec.Code != http.StatusOK {
+			t.Errorf("expected %s on the main port to return %d but got %d", target, http.StatusOK, rec.Code)
+		}
+	}
+	if rec := env.do("GET", "/debug/pprof/", nil); rec.Code == http.StatusOK {
+		t.Error("expected pprof never to be served on the main port")
+	}
+}
+
+func TestAdminListenerSplitsRoutes(t *testing.T) {
+	defer setEnv("ADMIN_LISTEN_ADDR", ":9090")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	admin := newAdminRouter()
+
+	for _, target := range []string{"/healthz", "/readyz", "/metrics", "/version", "/debug/pprof/"} {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected %s on the admin port to return %d but got %d", target, http.StatusOK, rec.Code)
+		}
+		if rec := env.do("GET", target, nil); rec.Code == http.StatusOK {
+			t.Errorf("expected %s not to be served on the main port", target)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("GET", "/android-1/download?token="+testToken, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected downloads not to be served on the admin port but got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected downloads on the main port but got status %d", rec.Code)
+	}
+}
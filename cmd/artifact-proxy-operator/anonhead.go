@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//allowAnonymousHead lets HEAD requests without a token learn the size and type of an artifact when
+//ALLOW_ANONYMOUS_HEAD is set, e.g. for health dashboards. GET always needs a token
+func allowAnonymousHead() bool {
+	return os.Getenv("ALLOW_ANONYMOUS_HEAD") == "true"
+}
+
+//isAnonymousHead reports whether r is a HEAD request which carries no credentials at all
+func isAnonymousHead(r *http.Request) bool {
+	if r.Method != http.MethodHead || !allowAnonymousHead() {
+		return false
+	}
+	query := r.URL.Query()
+	_, token := query["token"]
+	_, sig := query[tokenSignatureParam]
+	_, cookieErr := r.Cookie(tokenCookieName)
+	return !token && !sig && cookieErr != nil && r.Header.Get(groupsHeader) == ""
+}
+
+//handleAnonymousHead answers an anonymous HEAD request with only the size and type of the artifact. Every build
+//which can not be described, whether it is missing, restricted to groups, expired or anything else, gets the same
+//404 so the answer does not tell which builds exist behind their tokens
+func handleAnonymousHead(rw http.ResponseWriter, r *http.Request) {
+	buildName, err := buildNameFromPath(r.URL.Path)
+	if err != nil {
+		httpError(rw, "not found", http.StatusNotFound)
+		return
+	}
+	contentType, size, err := describeArtifact(r, buildName)
+	if err != nil {
+		log.Printf("anonymous HEAD of build %s not answered: %s", buildName, err.Error())
+		httpError(rw, "not found", http.StatusNotFound)
+		return
+	}
+	if contentType != "" {
+		rw.Header().Set("content-type", contentType)
+	}
+	if size >= 0 {
+		rw.Header().Set("content-length", strconv.FormatInt(size, 10))
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+//describeArtifact returns the content type and size of the artifact of a build, the size is -1 when it is not known
+func describeArtifact(r *http.Request, buildName string) (string, int64, error) {
+	build, err := osClient.GetBuildContext(r.Context(), buildName)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, restricted := allowedGroups(build); restricted {
+		return "", 0, errors.New("build is restricted to groups")
+	}
+	if tokenExpired(build) {
+		return "", 0, errors.New("token has expired")
+	}
+	buildType, err := osClient.GetBuildTypeContext(r.Context(), build)
+	if err != nil {
+		return "", 0, err
+	}
+	buildType = resolveBuildType(build.Name, buildType)
+	cacheKey := build.Name
+	artifactUrl, ok := buildArtifactUrl(build)
+	if isUniversalBuildType(buildType) {
+		platform := r.URL.Query().Get("platform")
+		artifactUrl, ok = platformArtifactUrl(build, platform)
+		buildType, cacheKey = platform, build.Name+"."+platform
+	}
+	if !ok || artifactUrl == "" || buildTypeDisabled(buildType) || checkArtifactUrl(artifactUrl) != nil || !extensionAllowed(artifactUrl) {
+		return "", 0, errors.New("no artifact to describe for " + buildType + " build")
+	}
+	contentType := artifactContentType(build, buildType)
+	if artifactCache != nil && !isNoCache(build) {
+		if size, ok := artifactCache.Size(cacheKey); ok {
+			return contentType, size, nil
+		}
+	}
+	if isS3Location(artifactUrl) {
+		return contentType, -1, nil
+	}
+	size, err := source.Size(r.Context(), artifactUrl)
+	return contentType, size, err
+}
+
+//artifactContentType is the content type a download of the build's artifact is served with, empty when it is sniffed
+//from the artifact itself
+func artifactContentType(build *apibuildv1.Build, buildType string) string {
+	switch buildType {
+	case "android", "ios":
+		return binaryContentType
+	}
+	return build.Annotations[openshift.ContentType]
+}
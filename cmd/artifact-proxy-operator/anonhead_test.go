@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestAnonymousHead(t *testing.T) {
+	defer setEnv("ALLOW_ANONYMOUS_HEAD", "true")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	rec := env.do("HEAD", "/android-1/download", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected an anonymous HEAD to be answered but got %d", rec.Code)
+	}
+	if length := rec.Header().Get("content-length"); length != strconv.Itoa(len(testArtifact)) {
+		t.Fatalf("expected the size of the artifact but got %q", length)
+	}
+	if contentType := rec.Header().Get("content-type"); contentType != binaryContentType {
+		t.Fatalf("expected the type of the artifact but got %q", contentType)
+	}
+	if disposition := rec.Header().Get("content-disposition"); disposition != "" {
+		t.Fatalf("expected only size and type headers but got content-disposition %q", disposition)
+	}
+	if rec := env.do("GET", "/android-1/download", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected GET to still need a token but got %d", rec.Code)
+	}
+	if rec := env.do("HEAD", "/android-1/download?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a HEAD with a wrong token to be refused but got %d", rec.Code)
+	}
+}
+
+func TestAnonymousHeadObscuresGatedBuilds(t *testing.T) {
+	defer setEnv("ALLOW_ANONYMOUS_HEAD", "true")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("restricted", "android", map[string]string{openshift.AllowedGroups: "qa"})
+	env.addBuild("expired", "android", map[string]string{openshift.TokenExpires: time.Now().Add(-time.Hour).Format(time.RFC3339)})
+
+	missing := env.do("HEAD", "/missing/download", nil)
+	if missing.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing build to be not found but got %d", missing.Code)
+	}
+	for _, build := range []string{"restricted", "expired"} {
+		rec := env.do("HEAD", "/"+build+"/download", nil)
+		if rec.Code != missing.Code || rec.Body.String() != missing.Body.String() {
+			t.Errorf("expected the %s build to look like a missing one but got %d %q", build, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestAnonymousHeadDisabled(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	if rec := env.do("HEAD", "/android-1/download", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a HEAD without a token to be refused by default but got %d", rec.Code)
+	}
+}
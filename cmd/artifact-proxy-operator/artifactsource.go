@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/jenkins"
+)
+
+//artifactSource is where the proxy fetches artifacts from when they are not cached. Handlers only go through source,
+//so tests can swap in one which serves artifacts from memory
+type artifactSource interface {
+	//Stream opens the artifact at location, passing on any conditional request headers
+	Stream(ctx context.Context, location string, conditions http.Header) (*jenkins.ArtifactStream, error)
+	//OpenRanged gives random access to the artifact at location along with its size
+	OpenRanged(ctx context.Context, location string) (io.ReaderAt, int64, error)
+	//Size returns the size of the artifact at location without fetching it, -1 when it is not known
+	Size(ctx context.Context, location string) (int64, error)
+}
+
+var source artifactSource = jenkinsSource{}
+
+//jenkinsSource fetches artifacts from Jenkins with the service account token
+type jenkinsSource struct{}
+
+func (jenkinsSource) Stream(ctx context.Context, location string, conditions http.Header) (*jenkins.ArtifactStream, error) {
+	return jenkinsClient.StreamArtifactContext(ctx, location, osClient.AuthToken, conditions)
+}
+
+func (jenkinsSource) OpenRanged(ctx context.Context, location string) (io.ReaderAt, int64, error) {
+	ranged, err := jenkinsClient.OpenRangedContext(ctx, location, osClient.AuthToken)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ranged, ranged.Size, nil
+}
+
+func (jenkinsSource) Size(ctx context.Context, location string) (int64, error) {
+	return jenkinsClient.ArtifactSize(ctx, location, osClient.AuthToken)
+}
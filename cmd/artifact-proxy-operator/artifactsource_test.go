@@ -0,0 +1,250 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/jenkins"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+//memorySource is an artifactSource serving fixed content from memory, so handler tests control exactly what the
+//upstream sends without running a Jenkins server
+type memorySource struct {
+	content  []byte
+	filename string
+	//size is reported by Size and OpenRanged, the length of content when it is zero
+	size int64
+	//err fails every fetch when it is set
+	err error
+	//truncateAt cuts the stream off with io.ErrUnexpectedEOF after that many bytes when it is positive
+	truncateAt int
+	//hang keeps the stream open after the content until its context is done
+	hang bool
+	//waiting is closed once a hanging stream has sent its content, when it is not nil
+	waiting chan struct{}
+
+	lock    sync.Mutex
+	streams int
+	ranged  int
+	closed  int
+}
+
+//useSource swaps the source handlers fetch artifacts from, the returned func restores Jenkins
+func useSource(s artifactSource) func() {
+	source = s
+	return func() { source = jenkinsSource{} }
+}
+
+func (s *memorySource) Stream(ctx context.Context, location string, conditions http.Header) (*jenkins.ArtifactStream, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.lock.Lock()
+	s.streams++
+	s.lock.Unlock()
+	var body io.Reader = bytes.NewReader(s.content)
+	if s.truncateAt > 0 {
+		body = io.MultiReader(bytes.NewReader(s.content[:s.truncateAt]), failingReader{io.ErrUnexpectedEOF})
+	}
+	return &jenkins.ArtifactStream{ReadCloser: &memoryStream{Reader: body, ctx: ctx, source: s}, Filename: s.filename}, nil
+}
+
+func (s *memorySource) OpenRanged(ctx context.Context, location string) (io.ReaderAt, int64, error) {
+	if s.err != nil {
+		return nil, 0, s.err
+	}
+	s.lock.Lock()
+	s.ranged++
+	s.lock.Unlock()
+	size, _ := s.Size(ctx, location)
+	return bytes.NewReader(s.content), size, nil
+}
+
+func (s *memorySource) Size(ctx context.Context, location string) (int64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.size != 0 {
+		return s.size, nil
+	}
+	return int64(len(s.content)), nil
+}
+
+func (s *memorySource) counts() (streams int, ranged int, closed int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.streams, s.ranged, s.closed
+}
+
+type memoryStream struct {
+	io.Reader
+	ctx    context.Context
+	source *memorySource
+}
+
+func (m *memoryStream) Read(p []byte) (int, error) {
+	n, err := m.Reader.Read(p)
+	if err == io.EOF && m.source.hang {
+		if m.source.waiting != nil {
+			close(m.source.waiting)
+			m.source.waiting = nil
+		}
+		<-m.ctx.Done()
+		return n, m.ctx.Err()
+	}
+	return n, err
+}
+
+func (m *memoryStream) Close() error {
+	m.source.lock.Lock()
+	defer m.source.lock.Unlock()
+	m.source.closed++
+	return nil
+}
+
+type failingReader struct{ err error }
+
+func (f failingReader) Read(p []byte) (int, error) {
+	return 0, f.err
+}
+
+func TestMemorySourceDownload(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	src := &memorySource{content: []byte("in memory apk"), filename: "app-release.apk"}
+	defer useSource(src)()
+
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "in memory apk" {
+		t.Fatalf("expected the artifact from the source but got %d %q", rec.Code, rec.Body.String())
+	}
+	if cd := rec.Header().Get("content-disposition"); cd != `attachment; filename="app-release.apk"` {
+		t.Fatalf("expected the filename from the source but got %q", cd)
+	}
+	if streams, _, closed := src.counts(); streams != 1 || closed != 1 {
+		t.Fatalf("expected one stream to be opened and closed but got %d opened and %d closed", streams, closed)
+	}
+}
+
+func TestMemorySourceErrors(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	cases := []struct {
+		err        error
+		code       int
+		retryAfter string
+	}{
+		{errors.New("unexpected response code from Jenkins download 404 Not Found"), http.StatusInternalServerError, ""},
+		{jenkins.ErrTooManyConnections, http.StatusServiceUnavailable, "5"},
+		{jenkins.ErrTooManyRedirects, http.StatusBadGateway, ""},
+	}
+	for _, c := range cases {
+		restore := useSource(&memorySource{err: c.err})
+		rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+		restore()
+		if rec.Code != c.code || rec.Header().Get("Retry-After") != c.retryAfter {
+			t.Errorf("%s: expected %d with Retry-After %q but got %d with %q", c.err, c.code, c.retryAfter, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestMemorySourceTruncated(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	defer enableCache(t)()
+	env.addBuild("android-1", "android", nil)
+	src := &memorySource{content: []byte(testArtifact), truncateAt: 3}
+	defer useSource(src)()
+
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Body.String() != testArtifact[:3] {
+		t.Fatalf("expected the download to stop where the source did but got %q", rec.Body.String())
+	}
+	if artifactCache.Has("android-1") {
+		t.Fatal("expected a truncated artifact not to be cached")
+	}
+	if _, _, closed := src.counts(); closed != 1 {
+		t.Fatalf("expected the truncated stream to be closed but it was closed %d times", closed)
+	}
+}
+
+func TestMemorySourceCancelled(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	src := &memorySource{content: []byte(testArtifact), hang: true, waiting: make(chan struct{})}
+	waiting := src.waiting
+	defer useSource(src)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest("GET", "/android-1/download?token="+testToken, nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		newRouter().ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	select {
+	case <-waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the download to start")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the download to stop once the client went away")
+	}
+	if _, _, closed := src.counts(); closed != 1 {
+		t.Fatalf("expected the stream to be closed once but it was closed %d times", closed)
+	}
+}
+
+func TestMemorySourceRanged(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, _ := w.Create("reports/index.html")
+	f.Write([]byte("<h1>report</h1>"))
+	if err := w.Close(); err != nil {
+		t.Fatal("error creating zip " + err.Error())
+	}
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("web-1", "web", nil)
+	src := &memorySource{content: buf.Bytes()}
+	defer useSource(src)()
+
+	rec := env.do("GET", "/web-1/download?entry=reports/index.html&token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "<h1>report</h1>" {
+		t.Fatalf("expected the zip entry but got %d %q", rec.Code, rec.Body.String())
+	}
+	if streams, ranged, _ := src.counts(); streams != 0 || ranged != 1 {
+		t.Fatalf("expected the entry to be read with ranged access only but got %d streams and %d ranged", streams, ranged)
+	}
+}
+
+func TestMemorySourceSize(t *testing.T) {
+	defer setEnv("ALLOW_ANONYMOUS_HEAD", "true")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: "https://jenkins.example.com/artifact/app.apk"})
+	defer useSource(&memorySource{size: 123456})()
+
+	rec := env.do("HEAD", "/android-1/download", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("content-length") != strconv.Itoa(123456) {
+		t.Fatalf("expected the size from the source but got %d %q", rec.Code, rec.Header().Get("content-length"))
+	}
+}
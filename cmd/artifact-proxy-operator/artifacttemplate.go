@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//downloadUrlTemplate renders the artifact url of builds without the annotation, nil when DOWNLOAD_URL_TEMPLATE is not
+//set. It is parsed in main so a broken template stops the operator from starting
+var downloadUrlTemplate *template.Template
+
+//artifactUrlFields are the parts of a build a DOWNLOAD_URL_TEMPLATE can use. Templates see this plain copy rather
+//than the build itself so they can not reach any of its methods
+type artifactUrlFields struct {
+	Name        string
+	Namespace   string
+	Number      string
+	Config      string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+//parseDownloadUrlTemplate parses a DOWNLOAD_URL_TEMPLATE, a text/template such as
+//https://jenkins.example.com/job/{{.Namespace}}-{{.Config}}/{{.Number}}/artifact/app.apk. Only the template builtins
+//are available, and a field which is missing fails the render rather than leaving a gap in the url
+func parseDownloadUrlTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("DOWNLOAD_URL_TEMPLATE").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.New("invalid DOWNLOAD_URL_TEMPLATE " + err.Error())
+	}
+	return tmpl, nil
+}
+
+//buildArtifactUrl returns the artifact url from the build's annotation, falling back to rendering the
+//DOWNLOAD_URL_TEMPLATE. It is false when the build has neither, or the template could not be rendered for it
+func buildArtifactUrl(build *apibuildv1.Build) (string, bool) {
+	if artifactUrl, ok := build.Annotations[osClient.GetDownloadConst()]; ok {
+		return artifactUrl, true
+	}
+	if downloadUrlTemplate == nil {
+		return "", false
+	}
+	artifactUrl, err := renderArtifactUrl(downloadUrlTemplate, build)
+	if err != nil {
+		log.Printf("error rendering DOWNLOAD_URL_TEMPLATE for build %s: %s", build.Name, err.Error())
+		return "", false
+	}
+	return artifactUrl, true
+}
+
+//renderArtifactUrl executes tmpl against a copy of the build's fields, an empty result is an error
+func renderArtifactUrl(tmpl *template.Template, build *apibuildv1.Build) (string, error) {
+	fields := artifactUrlFields{
+		Name:        build.Name,
+		Namespace:   build.Namespace,
+		Number:      build.Annotations[openshift.BuildNumber],
+		Config:      build.Annotations[openshift.BuildConfig],
+		Labels:      map[string]string{},
+		Annotations: map[string]string{},
+	}
+	if fields.Config == "" {
+		fields.Config = build.Labels[openshift.BuildConfig]
+	}
+	for k, v := range build.Labels {
+		fields.Labels[k] = v
+	}
+	for k, v := range build.Annotations {
+		fields.Annotations[k] = v
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, fields); err != nil {
+		return "", err
+	}
+	artifactUrl := strings.TrimSpace(out.String())
+	if artifactUrl == "" {
+		return "", errors.New("rendered an empty url")
+	}
+	return artifactUrl, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRenderArtifactUrl(t *testing.T) {
+	build := &apibuildv1.Build{ObjectMeta: metav1.ObjectMeta{
+		Name:        "myapp-3",
+		Namespace:   "mobile",
+		Labels:      map[string]string{openshift.BuildConfig: "myapp", "flavour": "release"},
+		Annotations: map[string]string{openshift.BuildNumber: "3"},
+	}}
+	cases := map[string]string{
+		"https://jenkins.example.com/job/{{.Namespace}}-{{.Config}}/{{.Number}}/artifact/app.apk": "https://jenkins.example.com/job/mobile-myapp/3/artifact/app.apk",
+		"https://jenkins.example.com/{{.Name}}/{{index .Labels \"flavour\"}}.apk":                 "https://jenkins.example.com/myapp-3/release.apk",
+		"https://jenkins.example.com/{{urlquery .Name \"/\"}}":                                    "https://jenkins.example.com/myapp-3%2F",
+	}
+	for text, expected := range cases {
+		tmpl, err := parseDownloadUrlTemplate(text)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %s", text, err.Error())
+		}
+		if rendered, err := renderArtifactUrl(tmpl, build); err != nil || rendered != expected {
+			t.Errorf("expected %s to render %s but got %s %v", text, expected, rendered, err)
+		}
+	}
+
+	for _, text := range []string{"https://jenkins.example.com/{{.Missing}}", "{{.DeepCopy}}", "{{index .Labels \"missing\"}}"} {
+		tmpl, err := parseDownloadUrlTemplate(text)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %s", text, err.Error())
+		}
+		if rendered, err := renderArtifactUrl(tmpl, build); err == nil {
+			t.Errorf("expected %s to fail to render but got %s", text, rendered)
+		}
+	}
+}
+
+func TestParseDownloadUrlTemplate(t *testing.T) {
+	if tmpl, err := parseDownloadUrlTemplate(""); tmpl != nil || err != nil {
+		t.Fatalf("expected no template when it is not set but got %v %v", tmpl, err)
+	}
+	for _, text := range []string{"https://jenkins.example.com/{{.Name", "{{env \"HOME\"}}"} {
+		if _, err := parseDownloadUrlTemplate(text); err == nil {
+			t.Errorf("expected %s to be rejected", text)
+		}
+	}
+}
+
+func TestHandlerUsesDownloadUrlTemplate(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("android-1", "android", nil)
+	annotated := env.addBuild("android-2", "android", nil)
+	env.lock.Lock()
+	delete(build.Annotations, openshift.JenkinsArtifactUri)
+	annotated.Annotations[openshift.JenkinsArtifactUri] = env.jenkins.URL + "/artifact/android-2"
+	env.lock.Unlock()
+
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected a build without an artifact url to be refused without a template but got %d", rec.Code)
+	}
+	tmpl, err := parseDownloadUrlTemplate(env.jenkins.URL + "/artifact/{{.Name}}")
+	if err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	defer func() { downloadUrlTemplate = nil }()
+	downloadUrlTemplate = tmpl
+
+	for _, name := range []string{"android-1", "android-2"} {
+		rec := env.do("GET", "/"+name+"/download?token="+testToken, nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+			t.Fatalf("expected %s to be downloaded but got %d %q", name, rec.Code, rec.Body.String())
+		}
+	}
+}
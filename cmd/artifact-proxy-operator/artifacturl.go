@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//checkArtifactUrl makes sure a download URL annotation is something the proxy can fetch from, so a malformed one is
+//reported as such rather than as a failure to reach Jenkins
+func checkArtifactUrl(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if urlErr, ok := err.(*url.Error); ok {
+		// the error quotes the whole url, which may carry credentials
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "s3":
+	default:
+		return errors.New("unsupported scheme " + strconv.Quote(u.Scheme))
+	}
+	if u.Host == "" {
+		return errors.New("no host")
+	}
+	return nil
+}
+
+//redactRawUrl hides any credentials and query string in a URL which may not parse, for logging it
+func redactRawUrl(raw string) string {
+	if i := strings.IndexAny(raw, "?#"); i >= 0 {
+		raw = raw[:i] + "?[redacted]"
+	}
+	scheme := strings.Index(raw, "://")
+	if scheme < 0 {
+		return raw
+	}
+	authority := raw[scheme+3:]
+	if end := strings.IndexAny(authority, "/?"); end >= 0 {
+		authority = authority[:end]
+	}
+	if at := strings.LastIndex(authority, "@"); at >= 0 {
+		raw = raw[:scheme+3] + "[redacted]" + raw[scheme+3+at:]
+	}
+	return raw
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/budget"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+const groupsHeader = "X-Auth-Groups"
+
+//lookupAuthorizedBuild fetches the build named in the request path and checks the request is allowed to access it,
+//either by its token (or the cookie standing in for it), its groups or both. When it is not an error response is
+//written and false returned
+func lookupAuthorizedBuild(rw http.ResponseWriter, r *http.Request) (*apibuildv1.Build, string, bool) {
+	token, tokenErr := parseToken(r.URL)
+	_, tokenGiven := r.URL.Query()["token"]
+	signatureAuth := hasTokenSignature(r)
+	if signatureAuth && tokenGiven {
+		if strictAuthParams() {
+			httpError(rw, "invalid request, only one of token and sig may be given", http.StatusBadRequest)
+			return nil, "", false
+		}
+		// the signature takes precedence, the token is ignored rather than checked as well
+		token, tokenErr, tokenGiven = "", nil, false
+	}
+	cookieAuth := !tokenGiven && !signatureAuth && hasTokenCookie(r)
+	if tokenErr != nil && !groupsReplaceToken() && !cookieAuth && !signatureAuth {
+		httpError(rw, tokenErr.Error(), http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	buildName, err := buildNameFromPath(r.URL.Path)
+	if err != nil {
+		httpError(rw, err.Error(), http.StatusInternalServerError)
+		return nil, "", false
+	}
+	build, err := osClient.GetBuildContext(r.Context(), buildName)
+	if err != nil {
+		if budget.Exceeded(r.Context()) {
+			httpError(rw, "request budget exceeded", http.StatusGatewayTimeout)
+			return nil, "", false
+		}
+		if strings.Contains(err.Error(), "not found") {
+			httpError(rw, fmt.Sprintf("no resources found for build %s", buildName), http.StatusNotFound)
+			return nil, "", false
+		}
+		httpError(rw, fmt.Sprintf("error fetching build %s", buildName), http.StatusInternalServerError)
+		return nil, "", false
+	}
+	noteBuild(rw, build)
+
+	groups, restricted := allowedGroups(build)
+	if restricted && !groupsAuthorized(r, groups) {
+		httpError(rw, fmt.Sprintf("not a member of a group allowed to download build %s", build.Name), http.StatusForbidden)
+		return nil, "", false
+	}
+
+	if signatureAuth && (!restricted || !groupsReplaceToken()) {
+		if !validTokenSignature(r.URL.Query().Get(tokenSignatureParam), build) {
+			httpError(rw, fmt.Sprintf("invalid or expired signature for build %s", build.Name), http.StatusForbidden)
+			return nil, "", false
+		}
+	} else if cookieAuth && (!restricted || !groupsReplaceToken()) {
+		if !validTokenCookie(r, build) {
+			httpError(rw, fmt.Sprintf("invalid or expired token cookie for build %s", build.Name), http.StatusForbidden)
+			return nil, "", false
+		}
+	} else if !restricted || !groupsReplaceToken() {
+		if tokenErr != nil {
+			httpError(rw, tokenErr.Error(), http.StatusBadRequest)
+			return nil, "", false
+		}
+		tokenAnnotationVal, ok := build.Annotations[osClient.GetTokenConst()]
+		if (tokenAnnotationVal != token || !ok) && !validStreamToken(build, token) && !validPreviousToken(build, token) {
+			httpError(rw, fmt.Sprintf("invalid token provided for build %s", build.Name), http.StatusForbidden)
+			return nil, "", false
+		}
+	}
+	if (!restricted || !groupsReplaceToken()) && tokenExpired(build) {
+		httpError(rw, fmt.Sprintf("the token for build %s has expired", build.Name), http.StatusGone)
+		return nil, "", false
+	}
+	return build, token, true
+}
+
+//strictAuthParams rejects requests carrying both a token and a sig parameter when STRICT_AUTH_PARAMS is set. By
+//default the signature is checked and the token ignored
+func strictAuthParams() bool {
+	return os.Getenv("STRICT_AUTH_PARAMS") == "true"
+}
+
+//tokenExpired reports whether the build's token is past the expiry in its artifact-proxy/token-expires annotation, an
+//RFC 3339 time. An expiry which can not be parsed counts as expired. Tokens without an expiry fall back to
+//DEFAULT_TOKEN_TTL after the build was created, and never expire when it is not set
+func tokenExpired(build *apibuildv1.Build) bool {
+	val, ok := build.Annotations[openshift.TokenExpires]
+	if !ok {
+		return defaultTokenExpired(build)
+	}
+	expires, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		log.Printf("invalid %s annotation on build %s: %s", openshift.TokenExpires, build.Name, err.Error())
+		return true
+	}
+	return !time.Now().Before(expires)
+}
+
+//defaultTokenTTL reads DEFAULT_TOKEN_TTL, a duration such as 720h. Zero, the default, means tokens never expire
+func defaultTokenTTL() time.Duration {
+	val := os.Getenv("DEFAULT_TOKEN_TTL")
+	if val == "" {
+		return 0
+	}
+	ttl, err := time.ParseDuration(val)
+	if err != nil || ttl < 0 {
+		log.Printf("ignoring invalid DEFAULT_TOKEN_TTL %q", val)
+		return 0
+	}
+	return ttl
+}
+
+func defaultTokenExpired(build *apibuildv1.Build) bool {
+	ttl := defaultTokenTTL()
+	if ttl == 0 || build.Annotations[openshift.ArtifactDownloadToken] == "" || build.CreationTimestamp.IsZero() {
+		return false
+	}
+	return !time.Now().Before(build.CreationTimestamp.Add(ttl))
+}
+
+//allowedGroups returns the groups a build is restricted to and whether the build declares any restriction at all
+func allowedGroups(build *apibuildv1.Build) ([]string, bool) {
+	val, ok := build.Annotations[openshift.AllowedGroups]
+	if !ok {
+		return nil, false
+	}
+	return splitList(val), true
+}
+
+//requestGroups returns the groups injected by the auth proxy. The header is only trusted when the request
+//comes from an address in TRUSTED_PROXY_CIDRS, otherwise any client could claim membership of any group
+func requestGroups(r *http.Request) []string {
+	if !isTrustedProxy(r.RemoteAddr) {
+		return nil
+	}
+	return splitList(r.Header.Get(groupsHeader))
+}
+
+//groupsAuthorized reports whether the request carries at least one of the allowed groups
+func groupsAuthorized(r *http.Request, allowed []string) bool {
+	for _, group := range requestGroups(r) {
+		for _, a := range allowed {
+			if group == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//groupsReplaceToken reports whether group membership alone is enough to download a build that declares allowed groups
+func groupsReplaceToken() bool {
+	return os.Getenv("ALLOWED_GROUPS_REPLACE_TOKEN") == "true"
+}
+
+//isAdminRequest reports whether the request carries ADMIN_TOKEN as a bearer token. Admin endpoints are disabled
+//when no token is configured
+func isAdminRequest(r *http.Request) bool {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		return false
+	}
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(adminToken)) == 1
+}
+
+func isTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range splitList(os.Getenv("TRUSTED_PROXY_CIDRS")) {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
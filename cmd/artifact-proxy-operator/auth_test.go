@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAllowedGroups(t *testing.T) {
+	// httptest requests originate from 192.0.2.1
+	defer setEnv("TRUSTED_PROXY_CIDRS", "192.0.2.0/24")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("restricted", "android", map[string]string{openshift.AllowedGroups: "qa, release"})
+	env.addBuild("open", "android", nil)
+
+	cases := []struct {
+		name   string
+		target string
+		groups string
+		expect int
+	}{
+		{"member of allowed group", "/restricted/download?token=" + testToken, "dev,release", http.StatusOK},
+		{"not a member", "/restricted/download?token=" + testToken, "dev", http.StatusForbidden},
+		{"no groups header", "/restricted/download?token=" + testToken, "", http.StatusForbidden},
+		{"member with bad token", "/restricted/download?token=wrong", "qa", http.StatusForbidden},
+		{"member without token", "/restricted/download", "qa", http.StatusBadRequest},
+		{"no annotation is token only", "/open/download?token=" + testToken, "", http.StatusOK},
+	}
+	for _, tc := range cases {
+		rec := env.do("GET", tc.target, map[string]string{groupsHeader: tc.groups})
+		if rec.Code != tc.expect {
+			t.Errorf("%s: expected status %d but got %d", tc.name, tc.expect, rec.Code)
+		}
+	}
+}
+
+func TestAllowedGroupsUntrustedProxy(t *testing.T) {
+	defer setEnv("TRUSTED_PROXY_CIDRS", "10.0.0.0/8")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("restricted", "android", map[string]string{openshift.AllowedGroups: "qa"})
+
+	rec := env.do("GET", "/restricted/download?token="+testToken, map[string]string{groupsHeader: "qa"})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected groups from an untrusted address to be ignored, got status %d", rec.Code)
+	}
+}
+
+func TestAllowedGroupsReplaceToken(t *testing.T) {
+	defer setEnv("TRUSTED_PROXY_CIDRS", "192.0.2.0/24")()
+	defer setEnv("ALLOWED_GROUPS_REPLACE_TOKEN", "true")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("restricted", "android", map[string]string{openshift.AllowedGroups: "qa"})
+	env.addBuild("open", "android", nil)
+
+	if rec := env.do("GET", "/restricted/download", map[string]string{groupsHeader: "qa"}); rec.Code != http.StatusOK {
+		t.Fatalf("expected group member to download without a token, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/restricted/download", map[string]string{groupsHeader: "dev"}); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected non member to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/open/download", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a build without allowed groups to still require a token, got status %d", rec.Code)
+	}
+}
+
+func TestDefaultTokenTTL(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	created := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	env.addBuild("old", "android", nil).CreationTimestamp = created
+	env.addBuild("recent", "android", nil).CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+	env.addBuild("overridden", "android", map[string]string{openshift.TokenExpires: time.Now().Add(time.Hour).Format(time.RFC3339)}).CreationTimestamp = created
+
+	if rec := env.do("GET", "/old/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected tokens to never expire without DEFAULT_TOKEN_TTL, got status %d", rec.Code)
+	}
+	defer setEnv("DEFAULT_TOKEN_TTL", "1h")()
+	if rec := env.do("GET", "/old/download?token="+testToken, nil); rec.Code != http.StatusGone {
+		t.Fatalf("expected status %d for a token past the default ttl but got %d", http.StatusGone, rec.Code)
+	}
+	if rec := env.do("GET", "/recent/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d for a token within the default ttl but got %d", http.StatusOK, rec.Code)
+	}
+	if rec := env.do("GET", "/overridden/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected the expiry annotation to override the default ttl, got status %d", rec.Code)
+	}
+	defer setEnv("DEFAULT_TOKEN_TTL", "0")()
+	if rec := env.do("GET", "/old/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected a ttl of 0 to never expire tokens, got status %d", rec.Code)
+	}
+}
+
+func TestTokenAndSignature(t *testing.T) {
+	defer setEnv("TOKEN_COOKIE_SECRET", "secret")()
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("android-1", "android", nil)
+	sig := tokenSignature(build)
+
+	cases := []struct {
+		query    string
+		strict   bool
+		expected int
+	}{
+		{query: "token=" + testToken, expected: http.StatusOK},
+		{query: "sig=" + sig, expected: http.StatusOK},
+		// the signature takes precedence, the token is not checked
+		{query: "token=wrong&sig=" + sig, expected: http.StatusOK},
+		{query: "token=" + testToken + "&sig=invalid", expected: http.StatusForbidden},
+		{query: "token=" + testToken, strict: true, expected: http.StatusOK},
+		{query: "sig=" + sig, strict: true, expected: http.StatusOK},
+		{query: "token=" + testToken + "&sig=" + sig, strict: true, expected: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		restore := setEnv("STRICT_AUTH_PARAMS", strconv.FormatBool(c.strict))
+		if rec := env.do("GET", "/android-1/download?"+c.query, nil); rec.Code != c.expected {
+			t.Errorf("expected status %d for %s (strict %v) but got %d", c.expected, c.query, c.strict, rec.Code)
+		}
+		restore()
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/budget"
+)
+
+//retryBudget reads REQUEST_RETRY_BUDGET_SECONDS, the time a request may spend on calls to the API server and Jenkins
+//before its download starts. 0, the default, leaves requests unbounded
+func retryBudget() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("REQUEST_RETRY_BUDGET_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+//withRetryBudget starts a request's budget, every upstream call made for it shares what is left
+func withRetryBudget(r *http.Request) *http.Request {
+	limit := retryBudget()
+	if limit == 0 {
+		return r
+	}
+	return r.WithContext(budget.WithDeadline(r.Context(), time.Now().Add(limit)))
+}
+
+//excludeFromRetryBudget moves the end of a request's budget on by time spent waiting rather than calling upstream
+func excludeFromRetryBudget(r *http.Request, waited time.Duration) *http.Request {
+	deadline, ok := budget.Deadline(r.Context())
+	if !ok {
+		return r
+	}
+	return r.WithContext(budget.WithDeadline(r.Context(), deadline.Add(waited)))
+}
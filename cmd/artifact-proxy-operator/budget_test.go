@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+//slowApi delays every response of the fake API server
+func slowApi(env *testEnv, delay time.Duration) {
+	inner := env.api.Config.Handler
+	env.api.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		inner.ServeHTTP(rw, r)
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+	hung := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(3 * time.Second):
+			rw.Write([]byte(testArtifact))
+		case <-r.Context().Done():
+		}
+	}))
+	defer hung.Close()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: hung.URL + "/artifact"})
+	env.addBuild("android-2", "android", nil)
+	slowApi(env, 300*time.Millisecond)
+	defer setEnv("REQUEST_RETRY_BUDGET_SECONDS", "1")()
+
+	// the API lookups use up most of the budget, leaving Jenkins the rest of it
+	started := time.Now()
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status %d once the budget ran out but got %d", http.StatusGatewayTimeout, rec.Code)
+	}
+	if elapsed := time.Since(started); elapsed > 1500*time.Millisecond {
+		t.Fatalf("expected the request to fail within its budget but it took %s", elapsed)
+	}
+
+	slowApi(env, 600*time.Millisecond)
+	started = time.Now()
+	if rec := env.do("GET", "/android-2/download?token="+testToken, nil); rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status %d when the API lookups use up the budget but got %d", http.StatusGatewayTimeout, rec.Code)
+	}
+	if elapsed := time.Since(started); elapsed > 1500*time.Millisecond {
+		t.Fatalf("expected the request to fail within its budget but it took %s", elapsed)
+	}
+}
+
+func TestRetryBudgetDoesNotCutOffDownloads(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	defer setEnv("REQUEST_RETRY_BUDGET_SECONDS", "1")()
+
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+		t.Fatalf("expected a download within the budget to be served, got status %d", rec.Code)
+	}
+}
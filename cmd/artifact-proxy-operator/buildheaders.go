@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//buildMetadataHeaders describes a build in response headers on its download, so scripts can record where a binary
+//came from. The app version is taken from artifact-proxy/app-version, or the iOS bundle version, and left out when
+//neither is set
+func buildMetadataHeaders(build *apibuildv1.Build, buildType string) http.Header {
+	version := build.Annotations[openshift.AppVersion]
+	if version == "" {
+		version = build.Annotations[openshift.BundleVersion]
+	}
+	headers := http.Header{}
+	for name, value := range map[string]string{
+		"X-Build-Name":  build.Name,
+		"X-Build-Type":  buildType,
+		"X-App-Version": version,
+	} {
+		if value = headerSafe(value); value != "" {
+			headers.Set(name, value)
+		}
+	}
+	return headers
+}
+
+//headerSafe drops control characters, such as CR and LF, which would let a value break out of its header
+func headerSafe(value string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value))
+}
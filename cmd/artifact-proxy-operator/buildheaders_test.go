@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestDownloadBuildMetadataHeaders(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.AppVersion: "1.2.3\r\nSet-Cookie: x=y"})
+	env.addBuild("android-2", "android", nil)
+
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rec.Code)
+	}
+	for name, expected := range map[string]string{
+		"X-Build-Name":  "android-1",
+		"X-Build-Type":  "android",
+		"X-App-Version": "1.2.3Set-Cookie: x=y",
+	} {
+		if got := rec.Header().Get(name); got != expected {
+			t.Errorf("expected %s %q but got %q", name, expected, got)
+		}
+	}
+	rec = env.do("GET", "/android-2/download?token="+testToken, nil)
+	if _, ok := rec.Header()["X-App-Version"]; ok {
+		t.Fatal("expected X-App-Version to be left out when the version is unknown")
+	}
+	if rec.Header().Get("X-Build-Name") != "android-2" {
+		t.Fatalf("expected X-Build-Name on every download but got %v", rec.Header())
+	}
+}
+
+func TestHeaderSafe(t *testing.T) {
+	if got := headerSafe(" 1.0\r\n\tbeta\x00 "); got != "1.0beta" {
+		t.Fatalf("expected control characters to be dropped but got %q", got)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/checksum"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+const (
+	buildReady         = "ready"
+	buildNotComplete   = "not-complete"
+	buildMisconfigured = "misconfigured"
+	buildExpired       = "expired"
+)
+
+//buildStatus says whether a build can be served and, when it can not, why. It is the answer of /<build>/status and,
+//with WRITE_BUILD_STATUS, the value of the artifact-proxy/status annotation
+type buildStatus struct {
+	State   string   `json:"state"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+//writeBuildStatus is WRITE_BUILD_STATUS, keeping the artifact-proxy/status annotation of each build with a download
+//url up to date as the watcher sees it. External controllers can then watch builds for it rather than asking the proxy
+func writeBuildStatus() bool {
+	return os.Getenv("WRITE_BUILD_STATUS") == "true"
+}
+
+//servableStatus works out the status of a build with the same checks a download makes. A build which is not
+//complete is reported as such first, then one which is misconfigured and last one whose token or downloads ran out
+func servableStatus(ctx context.Context, build *apibuildv1.Build) buildStatus {
+	var notComplete, misconfigured, expired []string
+	if phase := osClient.GetBuildPhase(build); requireCompletePhase() && phase != apibuildv1.BuildPhaseComplete {
+		notComplete = append(notComplete, fmt.Sprintf("build is %s, not Complete", phase))
+	}
+	var artifactUrls []string
+	buildType, err := osClient.GetBuildTypeContext(ctx, build)
+	if err != nil {
+		misconfigured = append(misconfigured, "no build type found")
+	} else {
+		buildType = resolveBuildType(build.Name, buildType)
+		switch {
+		case isUniversalBuildType(buildType):
+			for _, platform := range []string{"android", "ios"} {
+				if artifactUrl, ok := platformArtifactUrl(build, platform); ok {
+					artifactUrls = append(artifactUrls, artifactUrl)
+				}
+			}
+			if len(artifactUrls) == 0 {
+				notComplete = append(notComplete, "no android or ios artifact url has been added yet")
+			}
+		case isServedBuildType(buildType):
+			if buildTypeDisabled(buildType) {
+				misconfigured = append(misconfigured, fmt.Sprintf("serving %s builds is disabled", buildType))
+			}
+			artifactUrl, ok := buildArtifactUrl(build)
+			if !ok && downloadUrlTemplate != nil {
+				misconfigured = append(misconfigured, "DOWNLOAD_URL_TEMPLATE could not be rendered for the build")
+			} else if artifactUrl == "" && osClient.GetBuildPhase(build) == apibuildv1.BuildPhaseComplete {
+				notComplete = append(notComplete, "no artifact was published by the completed build")
+			} else if artifactUrl == "" {
+				notComplete = append(notComplete, "no artifact url has been added yet")
+			} else {
+				artifactUrls = append(artifactUrls, artifactUrl)
+			}
+			if variant, _ := resolveVariant(build, ""); buildType == "ios" && requireBundleIdentifier() && !validBundleIdentifier(variant.bundleIdentifier) {
+				misconfigured = append(misconfigured, fmt.Sprintf("no valid %s annotation", openshift.BundleIdentifier))
+			}
+		case buildType == "":
+			misconfigured = append(misconfigured, fmt.Sprintf("its build config has an empty %s label", openshift.BuildType))
+		default:
+			misconfigured = append(misconfigured, fmt.Sprintf("unrecognized build type %q", buildType))
+		}
+	}
+	for _, artifactUrl := range artifactUrls {
+		if err := checkArtifactUrl(artifactUrl); err != nil {
+			misconfigured = append(misconfigured, "malformed download url: "+err.Error())
+		} else if !extensionAllowed(artifactUrl) {
+			misconfigured = append(misconfigured, fmt.Sprintf("artifact extension %q is not in SERVE_ALLOWED_EXTENSIONS", artifactExtension(artifactUrl)))
+		}
+	}
+	if val, ok := build.Annotations[openshift.Checksum]; ok {
+		if _, err := checksum.Parse(val); err != nil {
+			misconfigured = append(misconfigured, "invalid checksum annotation: "+err.Error())
+		}
+	}
+	if tokenExpired(build) {
+		expired = append(expired, "its download token has expired")
+	}
+	if limit, exhausted, err := downloadsExhausted(build); err != nil {
+		log.Printf("error reading download count of build %s: %s", build.Name, err.Error())
+	} else if exhausted {
+		expired = append(expired, fmt.Sprintf("it has reached its limit of %d downloads", limit))
+	}
+	switch {
+	case len(notComplete) > 0:
+		return buildStatus{State: buildNotComplete, Reasons: notComplete}
+	case len(misconfigured) > 0:
+		return buildStatus{State: buildMisconfigured, Reasons: misconfigured}
+	case len(expired) > 0:
+		return buildStatus{State: buildExpired, Reasons: expired}
+	}
+	return buildStatus{State: buildReady}
+}
+
+//buildStatusHandler serves /<build>/status to admins, the servable state of the build as JSON
+func buildStatusHandler(rw http.ResponseWriter, r *http.Request) {
+	if !isAdminRequest(r) {
+		httpError(rw, "admin authorization required", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpError(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	buildName, err := buildNameFromPath(r.URL.Path)
+	if err != nil {
+		httpError(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	build, err := osClient.GetBuildContext(r.Context(), buildName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			httpError(rw, fmt.Sprintf("no resources found for build %s", buildName), http.StatusNotFound)
+			return
+		}
+		httpError(rw, fmt.Sprintf("error fetching build %s", buildName), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("content-type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(servableStatus(r.Context(), build))
+}
+
+//publishBuildStatus writes the status of an observed build to its artifact-proxy/status annotation when it changed.
+//The update is seen by the watcher again, by then the annotation matches and nothing more is written
+func publishBuildStatus(build *apibuildv1.Build) {
+	status, err := json.Marshal(servableStatus(context.Background(), build))
+	if err != nil || build.Annotations[openshift.Status] == string(status) {
+		return
+	}
+	if _, err := osClient.SetStatus(build, string(status)); err != nil {
+		log.Printf("error writing the status of build %s: %s", build.Name, err.Error())
+	}
+}
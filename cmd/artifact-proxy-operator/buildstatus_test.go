@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+func TestBuildStatus(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	defer setEnv("REQUIRE_COMPLETE_PHASE", "true")()
+	defer useMemorySessions()()
+	env := newTestEnv(t)
+	defer env.close()
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	builds := map[string]*apibuildv1.Build{
+		"ready":          env.addBuild("ready", "android", nil),
+		"running":        env.addBuild("running", "android", nil),
+		"no-url":         env.addBuild("no-url", "android", nil),
+		"bad-checksum":   env.addBuild("bad-checksum", "android", map[string]string{openshift.Checksum: "md5:d41d8cd98f00b204e9800998ecf8427e"}),
+		"unknown-type":   env.addBuild("unknown-type", "windows", nil),
+		"token-expired":  env.addBuild("token-expired", "android", map[string]string{openshift.TokenExpires: past}),
+		"limit-reached":  env.addBuild("limit-reached", "android", map[string]string{openshift.MaxDownloads: "1"}),
+		"expired-config": env.addBuild("expired-config", "ios", map[string]string{openshift.TokenExpires: past, openshift.Checksum: "sha256:abc"}),
+	}
+	for name, build := range builds {
+		if name != "running" {
+			build.Status.Phase = apibuildv1.BuildPhaseComplete
+		}
+	}
+	delete(builds["no-url"].Annotations, openshift.JenkinsArtifactUri)
+	if rec := env.do("GET", "/limit-reached/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected the first download to be served but got %d", rec.Code)
+	}
+
+	if rec := env.do("GET", "/ready/status", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the status to need admin authorization but got %d", rec.Code)
+	}
+	for name, state := range map[string]string{
+		"ready":          buildReady,
+		"running":        buildNotComplete,
+		"no-url":         buildNotComplete,
+		"bad-checksum":   buildMisconfigured,
+		"unknown-type":   buildMisconfigured,
+		"token-expired":  buildExpired,
+		"limit-reached":  buildExpired,
+		"expired-config": buildMisconfigured,
+	} {
+		rec := env.do("GET", "/"+name+"/status", map[string]string{"Authorization": "Bearer admin"})
+		var status buildStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("expected the status of %s but got %d %s", name, rec.Code, rec.Body.String())
+		}
+		if status.State != state || (state != buildReady) != (len(status.Reasons) > 0) {
+			t.Errorf("expected %s to be %s with reasons unless ready but got %+v", name, state, status)
+		}
+	}
+}
+
+func TestWriteBuildStatus(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("bad-checksum", "android", map[string]string{openshift.Checksum: "sha256:abc"})
+
+	observeBuild(build)
+	if _, ok := env.builds["bad-checksum"].Annotations[openshift.Status]; ok {
+		t.Fatal("expected no status to be written without WRITE_BUILD_STATUS")
+	}
+	defer setEnv("WRITE_BUILD_STATUS", "true")()
+	observeBuild(build)
+	var status buildStatus
+	if err := json.Unmarshal([]byte(env.builds["bad-checksum"].Annotations[openshift.Status]), &status); err != nil || status.State != buildMisconfigured {
+		t.Fatalf("expected the misconfigured status to be written to the build but got %q", env.builds["bad-checksum"].Annotations[openshift.Status])
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+//servedBuildTypes are the build types with a handler of their own
+var servedBuildTypes = []string{"android", "ios", "web", "generic"}
+
+//resolveBuildType replaces a build type with no handler, or an empty one, by DEFAULT_BUILD_TYPE when it is set to a
+//type which has one. Without it builds of an unknown type are refused
+func resolveBuildType(buildName string, buildType string) string {
+	if isServedBuildType(buildType) || isUniversalBuildType(buildType) {
+		return buildType
+	}
+	fallback := os.Getenv("DEFAULT_BUILD_TYPE")
+	if !isServedBuildType(fallback) {
+		return buildType
+	}
+	if buildType == "" {
+		log.Printf("serving build %s with an empty build type as %s", buildName, fallback)
+	} else {
+		log.Printf("serving build %s of unknown type %q as %s", buildName, buildType, fallback)
+	}
+	return fallback
+}
+
+//handleUnservedBuildType refuses a build whose type has no handler, telling a build config with an empty type label
+//apart from one naming a type the proxy does not know
+func handleUnservedBuildType(rw http.ResponseWriter, buildName string, buildType string) {
+	if buildType == "" {
+		log.Printf("refusing download of build %s, its build config has an empty %s label", buildName, openshift.BuildType)
+		httpError(rw, fmt.Sprintf("build %s has no build type, its build config has an empty %s label", buildName, openshift.BuildType), http.StatusBadRequest)
+		return
+	}
+	log.Printf("refusing download of build %s of unrecognized type %q", buildName, buildType)
+	httpError(rw, fmt.Sprintf("unrecognized build type %q for build %s", buildType, buildName), http.StatusBadRequest)
+}
+
+func isServedBuildType(buildType string) bool {
+	for _, served := range servedBuildTypes {
+		if served == buildType {
+			return true
+		}
+	}
+	return false
+}
+
+//fallbackExtension reads FALLBACK_EXTENSION, the extension given to downloads which would otherwise have none
+func fallbackExtension() string {
+	ext := os.Getenv("FALLBACK_EXTENSION")
+	if ext == "" {
+		return ".bin"
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+//withExtension makes sure a download filename has an extension, taking it from the content type when that has a
+//well known one and using the fallback extension otherwise
+func withExtension(filename string, contentType string) string {
+	if path.Ext(filename) != "" {
+		return filename
+	}
+	if contentType != "" && contentType != binaryContentType && contentType != "application/octet-stream" {
+		if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+			return filename + exts[0]
+		}
+	}
+	return filename + fallbackExtension()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestDefaultBuildType(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("unknown", "cordova", map[string]string{openshift.JenkinsArtifactUri: env.jenkins.URL + "/artifact/output"})
+
+	if rec := env.do("GET", "/unknown/download?token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown build types to be refused by default, got status %d", rec.Code)
+	}
+	defer setEnv("DEFAULT_BUILD_TYPE", "generic")()
+	rec := env.do("GET", "/unknown/download?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+		t.Fatalf("expected unknown build type to be served as generic, got status %d", rec.Code)
+	}
+	if cd := rec.Header().Get("content-disposition"); cd != `attachment; filename="output.bin"` {
+		t.Fatalf("expected the fallback extension on the filename but got %q", cd)
+	}
+	defer setEnv("FALLBACK_EXTENSION", "dat")()
+	rec = env.do("GET", "/unknown/download?token="+testToken, nil)
+	if cd := rec.Header().Get("content-disposition"); cd != `attachment; filename="output.dat"` {
+		t.Fatalf("expected the configured fallback extension on the filename but got %q", cd)
+	}
+	defer setEnv("DEFAULT_BUILD_TYPE", "nonsense")()
+	if rec := env.do("GET", "/unknown/download?token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a default build type without a handler to be ignored, got status %d", rec.Code)
+	}
+}
+
+func TestEmptyBuildType(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("empty", "", nil)
+	env.addBuild("unknown", "cordova", nil)
+
+	rec := env.do("GET", "/empty/download?token="+testToken, nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "has no build type") {
+		t.Fatalf("expected an empty build type to be refused as missing but got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = env.do("GET", "/unknown/download?token="+testToken, nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `unrecognized build type "cordova"`) {
+		t.Fatalf("expected an unknown build type to be refused as unrecognized but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	defer setEnv("DEFAULT_BUILD_TYPE", "android")()
+	for _, name := range []string{"empty", "unknown"} {
+		if rec := env.do("GET", "/"+name+"/download?token="+testToken, nil); rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+			t.Fatalf("expected build %s to be served as android but got %d", name, rec.Code)
+		}
+	}
+}
+
+func TestWithExtension(t *testing.T) {
+	cases := []struct {
+		filename    string
+		contentType string
+		expected    string
+	}{
+		{"site.zip", "", "site.zip"},
+		{"site", "application/zip", "site.zip"},
+		{"site", binaryContentType, "site.bin"},
+		{"site", "application/octet-stream", "site.bin"},
+		{"site", "", "site.bin"},
+		{"site", "application/x-made-up", "site.bin"},
+	}
+	for _, tc := range cases {
+		if got := withExtension(tc.filename, tc.contentType); got != tc.expected {
+			t.Errorf("expected %q for %q with content type %q but got %q", tc.expected, tc.filename, tc.contentType, got)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	//cacheRefresh fetches the artifact from Jenkins again and replaces the cached copy with it
+	cacheRefresh = "refresh"
+	//cacheBypass fetches the artifact from Jenkins leaving the cache alone
+	cacheBypass = "bypass"
+	//cacheOnlyIfCached serves the cached copy and never goes to Jenkins
+	cacheOnlyIfCached = "only-if-cached"
+)
+
+//errNotCached is returned opening an artifact which must come from the cache when it is not there
+var errNotCached = errors.New("artifact is not cached")
+
+//requestCacheMode reads the Cache-Control header of a request from an admin: no-cache refreshes the cached artifact
+//from Jenkins, no-store fetches it without touching the cache and only-if-cached refuses to go to Jenkins at all.
+//Anyone else's Cache-Control is ignored, including one passed on by a trusted proxy as it is its client's header, so
+//clients can not send every download through to Jenkins
+func requestCacheMode(r *http.Request) string {
+	if !isAdminRequest(r) {
+		return ""
+	}
+	directives := map[string]bool{}
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		name := strings.SplitN(strings.TrimSpace(directive), "=", 2)[0]
+		directives[strings.ToLower(name)] = true
+	}
+	switch {
+	case directives["only-if-cached"]:
+		return cacheOnlyIfCached
+	case directives["no-store"]:
+		return cacheBypass
+	case directives["no-cache"]:
+		return cacheRefresh
+	}
+	return ""
+}
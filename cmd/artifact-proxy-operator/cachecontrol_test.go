@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCacheControlOverride(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	env.addBuild("android-2", "android", nil)
+	src := &memorySource{content: []byte("v1")}
+	defer useSource(src)()
+	download := func(build string, headers map[string]string) (int, string) {
+		rec := env.do("GET", "/"+build+"/download?token="+testToken, headers)
+		return rec.Code, rec.Body.String()
+	}
+	admin := func(cacheControl string) map[string]string {
+		return map[string]string{"Authorization": "Bearer admin", "Cache-Control": cacheControl}
+	}
+
+	download("android-1", nil)
+	src.content = []byte("v2")
+	if _, body := download("android-1", map[string]string{"Cache-Control": "no-cache"}); body != "v1" {
+		t.Fatalf("expected Cache-Control from an untrusted client to be ignored but got %q", body)
+	}
+	if _, body := download("android-1", admin("no-cache")); body != "v2" {
+		t.Fatalf("expected no-cache to refetch the artifact but got %q", body)
+	}
+	if _, body := download("android-1", nil); body != "v2" {
+		t.Fatalf("expected no-cache to refresh the cached artifact but got %q", body)
+	}
+	src.content = []byte("v3")
+	if _, body := download("android-1", admin("no-store")); body != "v3" {
+		t.Fatalf("expected no-store to refetch the artifact but got %q", body)
+	}
+	if _, body := download("android-1", nil); body != "v2" {
+		t.Fatalf("expected no-store to leave the cached artifact alone but got %q", body)
+	}
+
+	streams, _, _ := src.counts()
+	if code, body := download("android-1", admin("max-age=0, only-if-cached")); code != http.StatusOK || body != "v2" {
+		t.Fatalf("expected only-if-cached to serve the cached artifact but got %d %q", code, body)
+	}
+	if code, _ := download("android-2", admin("only-if-cached")); code != http.StatusGatewayTimeout {
+		t.Fatalf("expected only-if-cached to give 504 for an artifact which is not cached but got %d", code)
+	}
+	defer setEnv("TRUSTED_PROXY_CIDRS", "192.0.2.0/24")()
+	if after, _, _ := src.counts(); after != streams {
+		t.Fatalf("expected only-if-cached never to fetch from the source but it was fetched %d times", after-streams)
+	}
+	if code, _ := download("android-2", map[string]string{"Cache-Control": "only-if-cached"}); code != http.StatusOK {
+		t.Fatalf("expected Cache-Control passed on by a trusted proxy to be ignored but got %d", code)
+	}
+}
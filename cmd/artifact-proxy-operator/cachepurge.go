@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//cachePurgeHandler serves DELETE /<build>/cache, which forgets everything cached for a build: its artifacts, checksums
+//and ipa checks, so an artifact republished under the same name is fetched again. Downloads streaming the old
+//artifact finish reading it. Without a cache it only forgets the rest and answers 204 all the same
+func cachePurgeHandler(rw http.ResponseWriter, r *http.Request) {
+	if !isAdminRequest(r) {
+		httpError(rw, "admin authorization required", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		httpError(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	buildName, err := buildNameFromPath(r.URL.Path)
+	if err != nil {
+		httpError(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	build, err := osClient.GetBuildContext(r.Context(), buildName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			httpError(rw, fmt.Sprintf("no resources found for build %s", buildName), http.StatusNotFound)
+			return
+		}
+		httpError(rw, fmt.Sprintf("error fetching build %s", buildName), http.StatusInternalServerError)
+		return
+	}
+	for _, key := range buildCacheKeys(build) {
+		ipaChecks.forget(key)
+		if artifactCache == nil {
+			continue
+		}
+		if err := artifactCache.Remove(key); err != nil {
+			log.Printf("error purging %s from the cache: %s", key, err.Error())
+			httpError(rw, fmt.Sprintf("error purging the cache of build %s", build.Name), http.StatusInternalServerError)
+			return
+		}
+	}
+	precomputed.forget(build.Name)
+	prewarms.forget(build.Name)
+	log.Printf("audit: cache of build %s/%s purged from %s", build.Namespace, build.Name, r.RemoteAddr)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+//buildCacheKeys returns every key artifacts of the build can be cached under: the build itself, both platforms of a
+//universal build and each variant of an iOS build
+func buildCacheKeys(build *apibuildv1.Build) []string {
+	keys := []string{build.Name, build.Name + ".android", build.Name + ".ios"}
+	for annotation := range build.Annotations {
+		if strings.HasPrefix(annotation, openshift.VariantPrefix) && strings.HasSuffix(annotation, ".artifact-url") {
+			name := strings.TrimSuffix(strings.TrimPrefix(annotation, openshift.VariantPrefix), ".artifact-url")
+			keys = append(keys, build.Name+"."+name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
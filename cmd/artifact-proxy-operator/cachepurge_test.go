@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestCachePurge(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("android-1", "android", nil)
+	admin := map[string]string{"Authorization": "Bearer admin"}
+
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Body.String() != testArtifact || !artifactCache.Has("android-1") {
+		t.Fatalf("expected the artifact to be downloaded into the cache but got %d %q", rec.Code, rec.Body.String())
+	}
+	artifactUrl := build.Annotations[openshift.JenkinsArtifactUri]
+	ipaChecks.set("android-1 "+artifactUrl, errors.New("it is not a zip archive"))
+	precomputed.lock.Lock()
+	precomputed.computed["android-1"] = precomputedChecksum{url: artifactUrl, checksum: "sha256:" + testArtifactSha256}
+	precomputed.lock.Unlock()
+	env.setArtifact("/artifact/android-1", []byte("republished"))
+
+	if rec := env.do("DELETE", "/android-1/cache", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected purging to need admin authorization but got %d", rec.Code)
+	}
+	if rec := env.do("POST", "/android-1/cache", admin); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected only DELETE to be allowed but got %d", rec.Code)
+	}
+	if rec := env.do("DELETE", "/android-1/cache", admin); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the purge to succeed with %d but got %d: %s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+	if artifactCache.Has("android-1") {
+		t.Fatal("expected the artifact to be removed from the cache")
+	}
+	if _, ok := ipaChecks.get("android-1 " + artifactUrl); ok {
+		t.Fatal("expected the ipa check to be forgotten")
+	}
+	if _, ok := precomputed.get("android-1", artifactUrl); ok {
+		t.Fatal("expected the precomputed checksum to be forgotten")
+	}
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Body.String() != "republished" {
+		t.Fatalf("expected the republished artifact after the purge but got %q", rec.Body.String())
+	}
+	if rec := env.do("DELETE", "/missing/cache", admin); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected purging a missing build to get %d but got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestCachePurgeWhileStreaming(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	//a download still streaming the cached artifact
+	streaming, ok := artifactCache.Open("android-1")
+	if !ok {
+		t.Fatal("expected the artifact to be cached")
+	}
+	defer streaming.Close()
+	env.setArtifact("/artifact/android-1", []byte("republished"))
+
+	if rec := env.do("DELETE", "/android-1/cache", map[string]string{"Authorization": "Bearer admin"}); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the purge to succeed but got %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Body.String() != "republished" {
+		t.Fatalf("expected new downloads to get the republished artifact but got %q", rec.Body.String())
+	}
+	if body, err := ioutil.ReadAll(streaming); err != nil || string(body) != testArtifact {
+		t.Fatalf("expected the streaming download to finish with the old artifact but got %q %v", body, err)
+	}
+}
+
+func TestCachePurgeWithoutCache(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	if rec := env.do("DELETE", "/android-1/cache", map[string]string{"Authorization": "Bearer admin"}); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected purging without a cache to succeed with %d but got %d", http.StatusNoContent, rec.Code)
+	}
+}
+
+func TestBuildCacheKeys(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("ios-1", "ios", map[string]string{
+		openshift.VariantPrefix + "enterprise.artifact-url":      env.jenkins.URL + "/artifact/enterprise.ipa",
+		openshift.VariantPrefix + "enterprise.bundle-identifier": "com.example.app",
+	})
+	expected := []string{"ios-1", "ios-1.android", "ios-1.enterprise", "ios-1.ios"}
+	if keys := buildCacheKeys(build); !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected cache keys %v but got %v", expected, keys)
+	}
+}
+
+func TestCachePurgeDuringFill(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	streaming, release := make(chan struct{}), make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("republished") == "true" {
+			rw.Write([]byte("republished"))
+			return
+		}
+		rw.Write([]byte(testArtifact))
+		rw.(http.Flusher).Flush()
+		close(streaming)
+		<-release
+	}))
+	defer upstream.Close()
+	build := env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/artifact"})
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	//a download filling the cache with the old artifact
+	responses := make(chan streamResult, 1)
+	go func() {
+		res, err := http.Get(server.URL + "/android-1/download?token=" + testToken)
+		if err != nil {
+			responses <- streamResult{err: err}
+			return
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		responses <- streamResult{body: string(body), err: err}
+	}()
+	<-streaming
+	if rec := env.do("DELETE", "/android-1/cache", map[string]string{"Authorization": "Bearer admin"}); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the purge to succeed but got %d", rec.Code)
+	}
+	close(release)
+	if result := <-responses; result.err != nil || result.body != testArtifact {
+		t.Fatalf("expected the download under way to finish with the old artifact but got %q %v", result.body, result.err)
+	}
+	//the fill is committed, or not, once the handler has closed the stream
+	deadline := time.Now().Add(5 * time.Second)
+	for activeStreams.count() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if artifactCache.Has("android-1") {
+		t.Fatal("expected the fill started before the purge not to be cached")
+	}
+
+	env.lock.Lock()
+	build.Annotations[openshift.JenkinsArtifactUri] = upstream.URL + "/artifact?republished=true"
+	env.lock.Unlock()
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Body.String() != "republished" {
+		t.Fatalf("expected the republished artifact after the purge but got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/checksum"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+//checksumHandler serves /<build>/checksum, returning the expected digest of the build's artifact as
+//<algorithm>:<hex digest> so clients can verify what they downloaded. Builds without a checksum annotation get the
+//digest precomputed when they were observed, once there is one
+func checksumHandler(rw http.ResponseWriter, r *http.Request) {
+	build, _, ok := lookupAuthorizedBuild(rw, r)
+	if !ok {
+		return
+	}
+	val, ok := build.Annotations[openshift.Checksum]
+	if !ok {
+		if artifactUrl, hasUrl := buildArtifactUrl(build); hasUrl {
+			val, ok = precomputed.get(build.Name, artifactUrl)
+		}
+	}
+	if !ok {
+		httpError(rw, "no checksum published for build "+build.Name, http.StatusNotFound)
+		return
+	}
+	expected, err := checksum.Parse(val)
+	if err != nil {
+		log.Printf("invalid checksum annotation on build %s: %s", build.Name, err.Error())
+		httpError(rw, "invalid checksum annotation on build object", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("content-type", "text/plain")
+	rw.Write([]byte(expected.String()))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+const (
+	// digests of testArtifact
+	testArtifactSha256 = "sha256:e7ba55ec4b1cbb1e2a7f7c8a959e545f4db0230bf1e0a84396990601a1cd63ed"
+	testArtifactSha512 = "sha512:ea34d0583d3d16f4b9a2c208c77f170931c32cd56a2cf79f76cf7f07326fb32a97252d6139c630b3fe2dd3894f1a0e986fb03919ac3bac5dcc95fa1e1afe66a5"
+)
+
+func TestChecksumVerification(t *testing.T) {
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("good-256", "android", map[string]string{openshift.Checksum: testArtifactSha256})
+	env.addBuild("good-512", "android", map[string]string{openshift.Checksum: testArtifactSha512})
+	env.addBuild("bad", "android", map[string]string{openshift.Checksum: "sha256:0000000000000000000000000000000000000000000000000000000000000000"})
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	for _, name := range []string{"good-256", "good-512"} {
+		res, err := http.Get(server.URL + "/" + name + "/download?token=" + testToken)
+		if err != nil {
+			t.Fatal("unexpected error " + err.Error())
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || string(body) != testArtifact {
+			t.Fatalf("%s: expected verified download to complete, got %q, %v", name, body, err)
+		}
+		if !artifactCache.Has(name) {
+			t.Fatalf("%s: expected verified artifact to be cached", name)
+		}
+	}
+
+	res, err := http.Get(server.URL + "/bad/download?token=" + testToken)
+	if err == nil {
+		_, err = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	if err == nil {
+		t.Fatal("expected download not matching its checksum to be aborted")
+	}
+	if artifactCache.Has("bad") {
+		t.Fatal("expected artifact not matching its checksum not to be cached")
+	}
+}
+
+func TestChecksumEndpoint(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("sha512", "android", map[string]string{openshift.Checksum: testArtifactSha512})
+	env.addBuild("none", "android", nil)
+	env.addBuild("invalid", "android", map[string]string{openshift.Checksum: "md5:d41d8cd98f00b204e9800998ecf8427e"})
+
+	rec := env.do("GET", "/sha512/checksum?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifactSha512 {
+		t.Fatalf("expected digest %s but got %d %s", testArtifactSha512, rec.Code, rec.Body.String())
+	}
+	if rec := env.do("GET", "/sha512/checksum?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d for a bad token but got %d", http.StatusForbidden, rec.Code)
+	}
+	if rec := env.do("GET", "/none/checksum?token="+testToken, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d without a checksum but got %d", http.StatusNotFound, rec.Code)
+	}
+	if rec := env.do("GET", "/invalid/checksum?token="+testToken, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d for an unknown algorithm but got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
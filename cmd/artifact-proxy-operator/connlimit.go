@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+//maxConnections is MAX_CONNECTIONS, how many connections the download listener keeps open at once. It is not limited
+//when unset
+func maxConnections() int {
+	if configured, err := strconv.Atoi(os.Getenv("MAX_CONNECTIONS")); err == nil && configured > 0 {
+		return configured
+	}
+	return 0
+}
+
+//rejectExcessConnections closes connections beyond MAX_CONNECTIONS as soon as they are accepted when
+//MAX_CONNECTIONS_MODE is reject. By default they queue in the listen backlog until a connection closes
+func rejectExcessConnections() bool {
+	return os.Getenv("MAX_CONNECTIONS_MODE") == "reject"
+}
+
+//limitListener accepts at most cap(slots) connections at a time, whatever the requests on them do
+type limitListener struct {
+	net.Listener
+	slots  chan struct{}
+	reject bool
+	done   chan struct{}
+	close  sync.Once
+}
+
+//limitConnections wraps l so it keeps at most max connections open, l is returned as is when max is 0
+func limitConnections(l net.Listener, max int, reject bool) net.Listener {
+	if max <= 0 {
+		return l
+	}
+	return &limitListener{Listener: l, slots: make(chan struct{}, max), reject: reject, done: make(chan struct{})}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if l.reject {
+		for {
+			conn, err := l.Listener.Accept()
+			if err != nil {
+				return nil, err
+			}
+			select {
+			case l.slots <- struct{}{}:
+				return &limitConn{Conn: conn, release: l.release}, nil
+			default:
+				conn.Close()
+			}
+		}
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.done:
+		// the listener is closed, let Accept return its error
+		return l.Listener.Accept()
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: l.release}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.close.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+func (l *limitListener) release() {
+	<-l.slots
+}
+
+//limitConn gives its slot back to the listener when it is closed, only once however often Close is called
+type limitConn struct {
+	net.Conn
+	release func()
+	closed  sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.closed.Do(c.release)
+	return err
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+//acceptAsync accepts one connection from l in the background
+func acceptAsync(l net.Listener) chan net.Conn {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+	return accepted
+}
+
+func dial(t *testing.T, l net.Listener) net.Conn {
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("error connecting " + err.Error())
+	}
+	return conn
+}
+
+func TestLimitConnectionsQueues(t *testing.T) {
+	defer setEnv("MAX_CONNECTIONS", "1")()
+	defer setEnv("ARTIFACT_PROXY_OPERATOR_SERVICE_PORT", "0")()
+	l, _, err := newListener()
+	if err != nil {
+		t.Fatal("error listening " + err.Error())
+	}
+	defer l.Close()
+	defer dial(t, l).Close()
+	defer dial(t, l).Close()
+
+	first := <-acceptAsync(l)
+	second := acceptAsync(l)
+	select {
+	case <-second:
+		t.Fatal("expected the connection beyond MAX_CONNECTIONS to wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+	first.Close()
+	first.Close()
+	select {
+	case conn := <-second:
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the waiting connection to be accepted once the first closed")
+	}
+
+	// a closed listener must not leave Accept waiting for a slot
+	defer dial(t, l).Close()
+	held := <-acceptAsync(l)
+	defer held.Close()
+	waiting := acceptAsync(l)
+	l.Close()
+	select {
+	case <-waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected closing the listener to stop Accept waiting")
+	}
+}
+
+func TestLimitConnectionsRejects(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("error listening " + err.Error())
+	}
+	l := limitConnections(inner, 1, true)
+	defer l.Close()
+	kept := dial(t, l)
+	defer kept.Close()
+	first := <-acceptAsync(l)
+	defer first.Close()
+
+	rejected := dial(t, l)
+	defer rejected.Close()
+	accepted := acceptAsync(l)
+	rejected.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := rejected.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the connection beyond MAX_CONNECTIONS to be closed but got %v", err)
+	}
+	select {
+	case <-accepted:
+		t.Fatal("expected the rejected connection not to be handed to the server")
+	default:
+	}
+}
+
+func TestLimitConnectionsUnset(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("error listening " + err.Error())
+	}
+	defer inner.Close()
+	if l := limitConnections(inner, maxConnections(), false); l != inner {
+		t.Fatal("expected the listener not to be limited without MAX_CONNECTIONS")
+	}
+}
+
+func TestIdleConnectionGivesBackSlot(t *testing.T) {
+	defer setEnv("MAX_CONNECTIONS", "1")()
+	defer setEnv("CONNECTION_IDLE_TIMEOUT_SECONDS", "1")()
+	defer setEnv("ARTIFACT_PROXY_OPERATOR_SERVICE_PORT", "0")()
+	l, _, err := newListener()
+	if err != nil {
+		t.Fatal("error listening " + err.Error())
+	}
+	server := newServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { rw.Write([]byte("ok")) }))
+	go server.Serve(l)
+	defer server.Close()
+	get := func(conn net.Conn) error {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: proxy.example.com\r\n\r\n")); err != nil {
+			return err
+		}
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+
+	// the first connection is kept alive after its request without sending another
+	idle := dial(t, l)
+	defer idle.Close()
+	if err := get(idle); err != nil {
+		t.Fatal("error making a request on the first connection " + err.Error())
+	}
+	next := dial(t, l)
+	defer next.Close()
+	if err := get(next); err != nil {
+		t.Fatalf("expected the idle connection to give its slot back but got %v", err)
+	}
+}
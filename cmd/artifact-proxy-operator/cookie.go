@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+const (
+	tokenCookieName       = "artifact-proxy-token"
+	tokenSignatureParam   = "sig"
+	defaultTokenCookieTTL = 5 * time.Minute
+)
+
+//tokenCookiesEnabled reports whether a valid token on the iOS landing page is swapped for a signed cookie, and for a
+//signed sig parameter in the manifest and ipa links, so the token does not need to travel in the query string of every
+//later hop. TOKEN_COOKIE_SECRET signs both
+func tokenCookiesEnabled() bool {
+	return os.Getenv("TOKEN_COOKIE_SECRET") != ""
+}
+
+func tokenCookieTTL() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("TOKEN_COOKIE_TTL_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultTokenCookieTTL
+}
+
+//setTokenCookie gives the client a short lived cookie standing in for the build's token, scoped to the build's path
+func setTokenCookie(rw http.ResponseWriter, build *apibuildv1.Build) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     tokenCookieName,
+		Value:    tokenSignature(build),
+		Path:     "/" + build.Name + "/",
+		MaxAge:   int(tokenCookieTTL() / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+	})
+}
+
+//tokenSignature returns a value standing in for the build's token until it expires after TOKEN_COOKIE_TTL_SECONDS,
+//both as the token cookie and as the sig parameter
+func tokenSignature(build *apibuildv1.Build) string {
+	expires := time.Now().Add(tokenCookieTTL()).Unix()
+	return strconv.FormatInt(expires, 10) + "." + signTokenCookie(build, expires)
+}
+
+func hasTokenCookie(r *http.Request) bool {
+	_, err := r.Cookie(tokenCookieName)
+	return tokenCookiesEnabled() && err == nil
+}
+
+//hasTokenSignature reports whether the request carries a sig parameter in place of the token. iOS fetches the
+//manifest and the ipa outside of the browser, without its cookies, so the landing page signs their links instead
+func hasTokenSignature(r *http.Request) bool {
+	_, ok := r.URL.Query()[tokenSignatureParam]
+	return tokenCookiesEnabled() && ok
+}
+
+//validTokenCookie checks the cookie was issued for this build and its current token and has not expired
+func validTokenCookie(r *http.Request, build *apibuildv1.Build) bool {
+	cookie, err := r.Cookie(tokenCookieName)
+	if err != nil {
+		return false
+	}
+	return validTokenSignature(cookie.Value, build)
+}
+
+//validTokenSignature checks a signature made by tokenSignature was made for this build and its current token and has
+//not expired
+func validTokenSignature(value string, build *apibuildv1.Build) bool {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(parts[1]), []byte(signTokenCookie(build, expires)))
+}
+
+//signTokenCookie signs the build, the expiry and the build's token, so rotating the token invalidates its cookies
+func signTokenCookie(build *apibuildv1.Build, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("TOKEN_COOKIE_SECRET")))
+	mac.Write([]byte(build.Name + "\n" + strconv.FormatInt(expires, 10) + "\n" + build.Annotations[osClient.GetTokenConst()]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTokenCookie(t *testing.T) {
+	defer setEnv("TOKEN_COOKIE_SECRET", "secret")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+	env.addBuild("ios-2", "ios", nil)
+
+	landing := env.do("GET", "/ios-1/download?token="+testToken, nil)
+	if landing.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, landing.Code)
+	}
+	cookies := (&http.Response{Header: landing.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != tokenCookieName {
+		t.Fatalf("expected the landing page to set the token cookie but got %v", cookies)
+	}
+	cookie := cookies[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.Path != "/ios-1/" || cookie.MaxAge != 300 {
+		t.Fatalf("unexpected cookie attributes %+v", cookie)
+	}
+	if strings.Contains(landing.Body.String(), testToken) {
+		t.Fatal("expected the token to be left out of the manifest url")
+	}
+
+	header := map[string]string{"Cookie": cookie.Name + "=" + cookie.Value}
+	plistReq := env.do("GET", "/ios-1/download?plist=true", header)
+	if plistReq.Code != http.StatusOK {
+		t.Fatalf("expected the cookie to be accepted on the plist hop, got status %d", plistReq.Code)
+	}
+	if strings.Contains(plistReq.Body.String(), "token=") {
+		t.Fatalf("expected the artifact url to rely on the cookie but got \n%s", plistReq.Body.String())
+	}
+	if rec := env.do("GET", "/ios-1/download?artifact=true", header); rec.Code != http.StatusOK {
+		t.Fatalf("expected the cookie to be accepted on the artifact hop, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/ios-2/download?plist=true", header); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a cookie for another build to be refused, got status %d", rec.Code)
+	}
+	tampered := map[string]string{"Cookie": cookie.Name + "=9999999999." + strings.SplitN(cookie.Value, ".", 2)[1]}
+	if rec := env.do("GET", "/ios-1/download?plist=true", tampered); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a tampered cookie to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/ios-1/download?plist=true&token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected the query token to still be accepted, got status %d", rec.Code)
+	}
+}
+
+//TestTokenSignatureWithoutCookie follows the links of the landing page the way iOS does, outside of the browser which
+//holds the token cookie
+func TestTokenSignatureWithoutCookie(t *testing.T) {
+	defer setEnv("TOKEN_COOKIE_SECRET", "secret")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+	env.addBuild("ios-2", "ios", nil)
+	const host = "https://proxy.example.com"
+
+	landing := env.do("GET", "/ios-1/download?token="+testToken, nil)
+	manifest := regexp.MustCompile(`encodeURIComponent\("([^"]+)"\)`).FindStringSubmatch(landing.Body.String())
+	if manifest == nil || !strings.HasPrefix(manifest[1], host) || !strings.Contains(manifest[1], tokenSignatureParam+"=") {
+		t.Fatalf("expected a signed manifest url on the landing page but got \n%s", landing.Body.String())
+	}
+	plistReq := env.do("GET", strings.TrimPrefix(manifest[1], host), nil)
+	if plistReq.Code != http.StatusOK {
+		t.Fatalf("expected the manifest url to work without the cookie, got status %d", plistReq.Code)
+	}
+	ipa := regexp.MustCompile(`<string>(` + regexp.QuoteMeta(host) + `[^<]+)</string>`).FindStringSubmatch(plistReq.Body.String())
+	if ipa == nil || strings.Contains(ipa[1], "token=") {
+		t.Fatalf("expected a signed ipa url without the token in the manifest but got \n%s", plistReq.Body.String())
+	}
+	rec := env.do("GET", strings.TrimPrefix(html.UnescapeString(ipa[1]), host), nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+		t.Fatalf("expected the ipa url to work without the cookie, got status %d", rec.Code)
+	}
+
+	signature := regexp.MustCompile(tokenSignatureParam + `=([^&"]+)`).FindStringSubmatch(manifest[1])[1]
+	if rec := env.do("GET", "/ios-2/download?artifact=true&sig="+signature, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a signature for another build to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/ios-1/download?artifact=true&sig=9999999999."+strings.SplitN(signature, ".", 2)[1], nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a tampered signature to be refused, got status %d", rec.Code)
+	}
+}
+
+func TestTokenCookieDisabled(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+
+	landing := env.do("GET", "/ios-1/download?token="+testToken, nil)
+	if cookies := (&http.Response{Header: landing.Header()}).Cookies(); len(cookies) != 0 {
+		t.Fatalf("expected no cookie without TOKEN_COOKIE_SECRET but got %v", cookies)
+	}
+	if !strings.Contains(landing.Body.String(), testToken) {
+		t.Fatal("expected the token to be kept in the manifest url")
+	}
+}
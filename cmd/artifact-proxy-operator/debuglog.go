@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//query parameters and headers whose values are never logged
+var (
+	redactedParams  = []string{"token", tokenSignatureParam}
+	redactedHeaders = []string{"Authorization", "Cookie"}
+	//loggedHeaders are the request headers included in debug logs of failed requests
+	loggedHeaders = []string{"User-Agent", "Range", "X-Forwarded-For", groupsHeader, "Authorization", "Cookie"}
+)
+
+//debugLogRequestsOnError enables logging the whole of failed requests with DEBUG_LOG_REQUESTS_ON_ERROR, to help
+//triage 4xx/5xx responses. It is off by default as it is noisy
+func debugLogRequestsOnError() bool {
+	return os.Getenv("DEBUG_LOG_REQUESTS_ON_ERROR") == "true"
+}
+
+//errorLoggingWriter records the status of a response and the build it resolved to, so a failed request can be logged
+type errorLoggingWriter struct {
+	http.ResponseWriter
+	status int
+	build  *apibuildv1.Build
+}
+
+func (w *errorLoggingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorLoggingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *errorLoggingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *errorLoggingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//logRequestsOnError wraps next so failed requests are logged in full when DEBUG_LOG_REQUESTS_ON_ERROR is set
+func logRequestsOnError(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if !debugLogRequestsOnError() {
+			next(rw, r)
+			return
+		}
+		w := &errorLoggingWriter{ResponseWriter: rw}
+		next(w, r)
+		if w.status >= 400 {
+			logFailedRequest(r, w.status, w.build)
+		}
+	}
+}
+
+//noteBuild records the build a request resolved to for the debug log of the request
+func noteBuild(rw http.ResponseWriter, build *apibuildv1.Build) {
+	if w, ok := rw.(*errorLoggingWriter); ok {
+		w.build = build
+	}
+}
+
+func logFailedRequest(r *http.Request, status int, build *apibuildv1.Build) {
+	rules := logRedactRules()
+	var headers []string
+	for _, h := range loggedHeaders {
+		name := h
+		if strings.EqualFold(h, "X-Forwarded-For") && rules[strings.ToLower(h)] == "" {
+			//the forwarded addresses are the client's, they follow its rule unless the header has one of its own
+			name = clientIPField
+		}
+		if v := r.Header.Get(h); v != "" {
+			if v, ok := redactField(rules, name, v); ok {
+				headers = append(headers, h+"="+v)
+			}
+		}
+	}
+	client := ""
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if host, ok := redactField(rules, clientIPField, host); ok {
+			client = " client=" + host
+		}
+	}
+	state := "unresolved"
+	if build != nil {
+		// annotation values include the download token, only their names are logged
+		var annotations []string
+		for k := range build.Annotations {
+			annotations = append(annotations, k)
+		}
+		sort.Strings(annotations)
+		state = "phase=" + string(osClient.GetBuildPhase(build)) + " annotations=" + strings.Join(annotations, ",")
+		if name, ok := redactField(rules, buildField, build.Name); ok {
+			state = "build=" + name + " " + state
+		}
+	}
+	log.Printf("request failed with status %d: %s %s %s%s headers=[%s] %s", status, r.Method, redactURL(r.URL, rules), r.Proto, client, strings.Join(headers, " "), state)
+}
+
+//redactURL returns the request URI with the fields the rules hide redacted, hashed or left out. The build name in the
+//path can not be left out and is redacted instead
+func redactURL(u *url.URL, rules map[string]string) string {
+	query := u.Query()
+	for k, vals := range query {
+		for i := range vals {
+			v, ok := redactField(rules, k, vals[i])
+			if !ok {
+				delete(query, k)
+				break
+			}
+			vals[i] = v
+		}
+	}
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	if splitPath := strings.SplitN(u.Path, "/", 3); len(splitPath) > 1 && rules[buildField] != "" {
+		name, ok := redactField(rules, buildField, splitPath[1])
+		if !ok {
+			name = "[redacted]"
+		}
+		splitPath[1] = name
+		redacted.Path, redacted.RawPath = strings.Join(splitPath, "/"), ""
+	}
+	return redacted.RequestURI()
+}
+
+func redactValue(name string, sensitive []string, value string) string {
+	for _, s := range sensitive {
+		if strings.EqualFold(name, s) {
+			return "[redacted]"
+		}
+	}
+	return value
+}
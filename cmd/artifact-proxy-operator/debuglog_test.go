@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func captureLog() (*bytes.Buffer, func()) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	return &buf, func() { log.SetOutput(os.Stderr) }
+}
+
+func TestDebugLogRequestsOnError(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	defer setEnv("DEBUG_LOG_REQUESTS_ON_ERROR", "true")()
+	logs, restore := captureLog()
+	defer restore()
+
+	rec := env.do("GET", "/android-1/download?token=not-the-token", map[string]string{"Authorization": "Bearer secret", "User-Agent": "test-agent"})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d but got %d", http.StatusForbidden, rec.Code)
+	}
+	out := logs.String()
+	for _, expected := range []string{"request failed with status 403", "GET /android-1/download?token=%5Bredacted%5D", "User-Agent=test-agent", "Authorization=[redacted]", "build=android-1 phase=Unknown"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in debug log but got\n%s", expected, out)
+		}
+	}
+	for _, secret := range []string{"not-the-token", "secret", testToken} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q to be redacted from debug log but got\n%s", secret, out)
+		}
+	}
+
+	logs.Reset()
+	env.do("GET", "/android-1/download?token=not-the-token&sig=not-the-signature", nil)
+	if out := logs.String(); !strings.Contains(out, "sig=%5Bredacted%5D") || strings.Contains(out, "not-the-signature") {
+		t.Errorf("expected the token signature to be redacted from debug log but got\n%s", out)
+	}
+
+	logs.Reset()
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	if strings.Contains(logs.String(), "request failed") {
+		t.Fatalf("expected successful requests not to be logged but got\n%s", logs.String())
+	}
+}
+
+func TestDebugLogRequestsOnErrorDisabled(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	logs, restore := captureLog()
+	defer restore()
+
+	env.do("GET", "/android-1/download?token=wrong", nil)
+	if strings.Contains(logs.String(), "request failed") {
+		t.Fatalf("expected no debug log by default but got\n%s", logs.String())
+	}
+}
+
+//failedRequestLine is the line of logs written by the debug log of a failed request
+func failedRequestLine(logs string) string {
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.Contains(line, "request failed") {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestLogRedactFields(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	defer setEnv("DEBUG_LOG_REQUESTS_ON_ERROR", "true")()
+	defer setEnv("LOG_REDACT_FIELDS", "client_ip=hash, build, user-agent=omit, reason=hash, token=hash, range=bogus")()
+	defer setEnv("LOG_REDACT_HASH_KEY", "test-key")()
+	logs, restore := captureLog()
+	defer restore()
+
+	headers := map[string]string{"User-Agent": "test-agent", "X-Forwarded-For": "198.51.100.7", "Range": "bytes=0-1"}
+	env.do("GET", "/android-1/download?token=not-the-token&reason=qa", headers)
+	out := failedRequestLine(logs.String())
+	clientHash, forwardedHash := hashField("192.0.2.1"), hashField("198.51.100.7")
+	for _, expected := range []string{
+		"GET /%5Bredacted%5D/download?reason=" + url.QueryEscape(hashField("qa")) + "&token=%5Bredacted%5D",
+		"client=" + clientHash,
+		"X-Forwarded-For=" + forwardedHash,
+		"Range=[redacted]",
+		"build=[redacted] phase=",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in debug log but got\n%s", expected, out)
+		}
+	}
+	for _, hidden := range []string{"android-1", "192.0.2.1", "198.51.100.7", "User-Agent", "test-agent", "not-the-token", "=qa"} {
+		if strings.Contains(out, hidden) {
+			t.Errorf("expected %q to be hidden from debug log but got\n%s", hidden, out)
+		}
+	}
+	if clientHash == hashField("192.0.2.2") || !strings.HasPrefix(clientHash, "hash:") {
+		t.Fatalf("expected distinct keyed hashes but got %s", clientHash)
+	}
+
+	logs.Reset()
+	defer setEnv("LOG_REDACT_FIELDS", "build=omit,client_ip=omit")()
+	env.do("GET", "/android-1/download?token=wrong", nil)
+	out = failedRequestLine(logs.String())
+	if strings.Contains(out, "build=") || strings.Contains(out, "client=") || !strings.Contains(out, "GET /%5Bredacted%5D/download") {
+		t.Fatalf("expected the build and client to be left out of the debug log but got\n%s", out)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// transliterations of common accented latin letters for the ascii filename, anything else non ascii becomes _
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae", 'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'œ': "oe",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y", 'ß': "ss",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Æ': "AE", 'Ç': "C",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Œ': "OE",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ý': "Y",
+}
+
+//dispositionEncoding is how filenames are written in Content-Disposition, DISPOSITION_ENCODING: ascii for a
+//transliterated filename only, rfc5987 for the extended filename* only, or both (the default). Names which are
+//already plain ascii are sent as filename in both mode
+func dispositionEncoding() string {
+	switch encoding := os.Getenv("DISPOSITION_ENCODING"); encoding {
+	case "ascii", "rfc5987":
+		return encoding
+	default:
+		return "both"
+	}
+}
+
+//inlineSafeContentTypes are the only artifacts which may be shown inline. Anything a browser could run, such as html
+//or svg, would run on the proxy's origin and is always sent as an attachment
+var inlineSafeContentTypes = map[string]bool{
+	"text/plain":       true,
+	"application/pdf":  true,
+	"application/json": true,
+	"image/png":        true,
+	"image/jpeg":       true,
+	"image/gif":        true,
+}
+
+//defaultDisposition is the disposition downloads of a build type get, from DISPOSITION_TYPES, a comma separated list
+//of type=disposition e.g. web=inline. Types it does not list are downloaded as attachments
+func defaultDisposition(buildType string) string {
+	for _, entry := range splitList(os.Getenv("DISPOSITION_TYPES")) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !validDisposition(parts[1]) {
+			log.Printf("ignoring invalid DISPOSITION_TYPES entry %q", entry)
+			continue
+		}
+		if parts[0] == buildType {
+			return parts[1]
+		}
+	}
+	return "attachment"
+}
+
+//downloadDisposition is the disposition asked for by the disposition query parameter, falling back to the default of
+//the build type
+func downloadDisposition(r *http.Request, buildType string) (string, error) {
+	requested := r.URL.Query().Get("disposition")
+	if requested == "" {
+		return defaultDisposition(buildType), nil
+	}
+	if !validDisposition(requested) {
+		return "", errors.New("invalid request, disposition must be attachment or inline")
+	}
+	return requested, nil
+}
+
+func validDisposition(disposition string) bool {
+	return disposition == "attachment" || disposition == "inline"
+}
+
+//safeDisposition downgrades inline to attachment for content types which are not safe to show inline
+func safeDisposition(disposition string, contentType string) string {
+	if disposition != "inline" {
+		return "attachment"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !inlineSafeContentTypes[mediaType] {
+		return "attachment"
+	}
+	return "inline"
+}
+
+//contentDisposition returns a Content-Disposition header of the given type, attachment or inline, for filename
+func contentDisposition(dispositionType string, filename string) string {
+	ascii := asciiFilename(filename)
+	switch dispositionEncoding() {
+	case "ascii":
+		return fmt.Sprintf("%s; filename=\"%s\"", dispositionType, ascii)
+	case "rfc5987":
+		return fmt.Sprintf("%s; filename*=UTF-8''%s", dispositionType, rfc5987Encode(filename))
+	default:
+		if ascii == filename {
+			return fmt.Sprintf("%s; filename=\"%s\"", dispositionType, ascii)
+		}
+		return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", dispositionType, ascii, rfc5987Encode(filename))
+	}
+}
+
+//asciiFilename transliterates filename to printable ascii which is safe inside a quoted string
+func asciiFilename(filename string) string {
+	var b strings.Builder
+	for _, r := range filename {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteRune('_')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case transliterations[r] != "":
+			b.WriteString(transliterations[r])
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+//rfc5987Encode percent encodes the UTF-8 bytes of val which are not attr-chars as defined by RFC 5987
+func rfc5987Encode(val string) string {
+	var b strings.Builder
+	for _, c := range []byte(val) {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
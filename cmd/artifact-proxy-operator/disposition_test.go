@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestContentDisposition(t *testing.T) {
+	for encoding, expected := range map[string]string{
+		"ascii":   `attachment; filename="Resume_v2 (final).apk"`,
+		"rfc5987": `attachment; filename*=UTF-8''R%C3%A9sum%C3%A9%E2%98%85v2%20%28final%29.apk`,
+		"both":    `attachment; filename="Resume_v2 (final).apk"; filename*=UTF-8''R%C3%A9sum%C3%A9%E2%98%85v2%20%28final%29.apk`,
+		"":        `attachment; filename="Resume_v2 (final).apk"; filename*=UTF-8''R%C3%A9sum%C3%A9%E2%98%85v2%20%28final%29.apk`,
+	} {
+		restore := setEnv("DISPOSITION_ENCODING", encoding)
+		if header := contentDisposition("attachment", "Résumé★v2 (final).apk"); header != expected {
+			t.Errorf("expected %s for encoding %q but got %s", expected, encoding, header)
+		}
+		restore()
+	}
+}
+
+func TestContentDispositionAsciiName(t *testing.T) {
+	if header := contentDisposition("inline", "app.apk"); header != `inline; filename="app.apk"` {
+		t.Fatalf("expected a plain filename for an ascii name by default but got %s", header)
+	}
+	defer setEnv("DISPOSITION_ENCODING", "rfc5987")()
+	if header := contentDisposition("inline", "app.apk"); header != `inline; filename*=UTF-8''app.apk` {
+		t.Fatalf("expected only the extended filename but got %s", header)
+	}
+}
+
+func TestAsciiFilenameEscapesQuotes(t *testing.T) {
+	if name := asciiFilename(`a"b\c.apk`); name != "a_b_c.apk" {
+		t.Fatalf("expected quotes and backslashes to be replaced but got %q", name)
+	}
+}
+
+func TestDispositionPerBuildType(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	env.addBuild("web-pdf", "web", map[string]string{openshift.ContentType: "application/pdf"})
+	env.addBuild("web-html", "web", map[string]string{openshift.ContentType: "text/html; charset=utf-8"})
+	env.addBuild("generic-1", "generic", map[string]string{openshift.ContentType: "text/plain"})
+	disposition := func(target string) string {
+		rec := env.do("GET", target, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected %s to be downloaded but got %d", target, rec.Code)
+		}
+		header := rec.Header().Get("content-disposition")
+		if strings.HasPrefix(header, "inline;") && rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Fatalf("expected %s to be shown inline with nosniff", target)
+		}
+		return strings.SplitN(header, ";", 2)[0]
+	}
+
+	if got := disposition("/web-pdf/download?token=" + testToken); got != "attachment" {
+		t.Fatalf("expected downloads to be attachments by default but got %s", got)
+	}
+	defer setEnv("DISPOSITION_TYPES", "web=inline,nonsense,android=sideways")()
+	cases := []struct {
+		target   string
+		expected string
+	}{
+		{"/web-pdf/download?token=" + testToken, "inline"},
+		{"/web-html/download?token=" + testToken, "attachment"},
+		{"/android-1/download?token=" + testToken, "attachment"},
+		{"/generic-1/download?token=" + testToken, "attachment"},
+		{"/web-pdf/download?disposition=attachment&token=" + testToken, "attachment"},
+		{"/generic-1/download?disposition=inline&token=" + testToken, "inline"},
+		{"/web-html/download?disposition=inline&token=" + testToken, "attachment"},
+	}
+	for _, c := range cases {
+		if got := disposition(c.target); got != c.expected {
+			t.Errorf("%s: expected %s but got %s", c.target, c.expected, got)
+		}
+	}
+	if rec := env.do("GET", "/web-pdf/download?disposition=sideways&token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid disposition to be refused but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//downloadLimit returns the artifact-proxy/max-downloads annotation of build, 0 when it may be downloaded any number
+//of times. A limit which can not be parsed is logged and treated as no limit
+func downloadLimit(build *apibuildv1.Build) int64 {
+	value, ok := build.Annotations[openshift.MaxDownloads]
+	if !ok || value == "" {
+		return 0
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		log.Printf("ignoring invalid %s annotation %q on build %s", openshift.MaxDownloads, value, build.Name)
+		return 0
+	}
+	return limit
+}
+
+func downloadCountKey(build *apibuildv1.Build) string {
+	return "downloads/" + build.Namespace + "/" + build.Name
+}
+
+//downloadsExhausted reports whether build has used up its download limit without counting a download, along with the
+//limit to report
+func downloadsExhausted(build *apibuildv1.Build) (int64, bool, error) {
+	limit := downloadLimit(build)
+	if limit == 0 {
+		return 0, false, nil
+	}
+	count, err := sessions.Count(downloadCountKey(build))
+	if err != nil {
+		return limit, false, err
+	}
+	return limit, count >= limit, nil
+}
+
+//withinDownloadLimit counts a download of build against its limit in the session store, answering 410 once the
+//limit has been reached. HEAD requests only check the limit, they do not use up a download
+func withinDownloadLimit(rw http.ResponseWriter, r *http.Request, build *apibuildv1.Build) bool {
+	limit := downloadLimit(build)
+	if limit == 0 {
+		return true
+	}
+	var count int64
+	var allowed bool
+	var err error
+	if r.Method == http.MethodHead {
+		count, err = sessions.Count(downloadCountKey(build))
+		allowed = count < limit
+	} else {
+		count, allowed, err = sessions.IncrementWithinLimit(downloadCountKey(build), limit)
+	}
+	if err != nil {
+		log.Printf("error counting download of build %s: %s", build.Name, err.Error())
+		httpError(rw, "error counting download", http.StatusServiceUnavailable)
+		return false
+	}
+	if !allowed {
+		httpError(rw, fmt.Sprintf("build %s has reached its limit of %d downloads", build.Name, count), http.StatusGone)
+		return false
+	}
+	return true
+}
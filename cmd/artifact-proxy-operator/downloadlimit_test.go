@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+//useMemorySessions gives a test a fresh in-memory session store, the returned func restores the previous one
+func useMemorySessions() func() {
+	old := sessions
+	sessions = newMemorySessionStore()
+	return func() { sessions = old }
+}
+
+func TestDownloadLimit(t *testing.T) {
+	defer useMemorySessions()()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("limited", "android", map[string]string{openshift.MaxDownloads: "2"})
+	env.addBuild("unlimited", "android", nil)
+
+	for i := 0; i < 2; i++ {
+		if rec := env.do("GET", "/limited/download?token="+testToken, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected download %d to be served but got %d", i+1, rec.Code)
+		}
+	}
+	if rec := env.do("GET", "/limited/download?token="+testToken, nil); rec.Code != http.StatusGone {
+		t.Fatalf("expected status %d once the limit is reached but got %d", http.StatusGone, rec.Code)
+	}
+	for i := 0; i < 3; i++ {
+		if rec := env.do("GET", "/unlimited/download?token="+testToken, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected a build without a limit to always be served but got %d", rec.Code)
+		}
+	}
+}
+
+func TestDownloadLimitConcurrent(t *testing.T) {
+	defer useMemorySessions()()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("limited", "android", map[string]string{openshift.MaxDownloads: "3"})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- env.do("GET", "/limited/download?token="+testToken, nil).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	served := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			served++
+		}
+	}
+	if served != 3 {
+		t.Fatalf("expected exactly 3 concurrent downloads to be served but got %d", served)
+	}
+}
+
+func TestDownloadLimitOnlyCountsArtifacts(t *testing.T) {
+	defer useMemorySessions()()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", map[string]string{openshift.MaxDownloads: "1"})
+
+	// the landing page, the manifest and HEAD requests lead up to the download without using it up
+	for _, target := range []string{"/ios-1/download?token=" + testToken, "/ios-1/download?plist=true&token=" + testToken} {
+		if rec := env.do("GET", target, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected %s to be served but got %d", target, rec.Code)
+		}
+	}
+	if rec := env.do("HEAD", "/ios-1/download?artifact=true&token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected a HEAD request to be served but got %d", rec.Code)
+	}
+	if rec := env.do("GET", "/ios-1/download?artifact=true&token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected the ipa to be served but got %d", rec.Code)
+	}
+	if rec := env.do("HEAD", "/ios-1/download?artifact=true&token="+testToken, nil); rec.Code != http.StatusGone {
+		t.Fatalf("expected a HEAD request to report the used up limit with %d but got %d", http.StatusGone, rec.Code)
+	}
+}
+
+func TestDownloadLimitInvalid(t *testing.T) {
+	defer useMemorySessions()()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("invalid", "android", map[string]string{openshift.MaxDownloads: "lots"})
+
+	for i := 0; i < 2; i++ {
+		if rec := env.do("GET", "/invalid/download?token="+testToken, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected an invalid limit to be ignored but got %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+//streamTracker counts the downloads currently streaming to clients, so shutdown can wait for them to finish
+type streamTracker struct {
+	lock   sync.Mutex
+	active int
+	//idle is closed whenever no streams are active, and replaced when one starts
+	idle chan struct{}
+}
+
+var activeStreams = newStreamTracker()
+
+func newStreamTracker() *streamTracker {
+	idle := make(chan struct{})
+	close(idle)
+	return &streamTracker{idle: idle}
+}
+
+//track records a stream as active until the returned func is called
+func (s *streamTracker) track() func() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.active == 0 {
+		s.idle = make(chan struct{})
+	}
+	s.active++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			s.active--
+			if s.active == 0 {
+				close(s.idle)
+			}
+		})
+	}
+}
+
+func (s *streamTracker) count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.active
+}
+
+//wait blocks until no streams are active or the context is done, returning the context's error in that case
+func (s *streamTracker) wait(ctx context.Context) error {
+	s.lock.Lock()
+	idle := s.idle
+	s.lock.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
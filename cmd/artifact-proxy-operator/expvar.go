@@ -0,0 +1,27 @@
+package main
+
+import (
+	"expvar"
+	"os"
+)
+
+//expvarEnabled is ENABLE_EXPVAR, serving the download counters on /debug/vars for deployments which do not run
+//Prometheus. It is off by default
+func expvarEnabled() bool {
+	return os.Getenv("ENABLE_EXPVAR") == "true"
+}
+
+func init() {
+	expvar.Publish("artifact_proxy", expvar.Func(expvarCounters))
+}
+
+//expvarCounters sums the download metrics over all namespaces, they are read when /debug/vars is served so they are
+//always as current as /metrics
+func expvarCounters() interface{} {
+	return map[string]int64{
+		"downloads":       int64(downloadsTotal.Total()),
+		"download_errors": int64(downloadErrorsTotal.Total()),
+		"download_bytes":  int64(downloadBytesTotal.Total()),
+		"active_streams":  int64(activeStreams.count()),
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func expvarCountersFrom(t *testing.T, router http.Handler) map[string]int64 {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /debug/vars to be served but got %d", rec.Code)
+	}
+	var vars struct {
+		ArtifactProxy map[string]int64 `json:"artifact_proxy"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal("expected valid JSON " + err.Error())
+	}
+	return vars.ArtifactProxy
+}
+
+func TestExpvarCounters(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	if rec := env.do("GET", "/debug/vars", nil); rec.Code == http.StatusOK {
+		t.Fatal("expected /debug/vars to be off by default")
+	}
+
+	defer setEnv("ENABLE_EXPVAR", "true")()
+	before := expvarCountersFrom(t, newRouter())
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	after := expvarCountersFrom(t, newRouter())
+	if after["downloads"] != before["downloads"]+1 || after["download_bytes"] != before["download_bytes"]+int64(len(testArtifact)) {
+		t.Fatalf("expected the download to be counted, got %v before and %v after", before, after)
+	}
+	if after["active_streams"] != 0 || after["download_errors"] != before["download_errors"] {
+		t.Fatalf("expected no active streams or errors after the download but got %v", after)
+	}
+
+	defer setEnv("ADMIN_LISTEN_ADDR", ":9090")()
+	expvarCountersFrom(t, newAdminRouter())
+	if rec := env.do("GET", "/debug/vars", nil); rec.Code == http.StatusOK {
+		t.Fatal("expected /debug/vars only on the admin port when it has a listener of its own")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+//allowedExtensions is SERVE_ALLOWED_EXTENSIONS, a comma separated list of the artifact file extensions the proxy
+//serves e.g. apk,aab,ipa,dmg,zip. It is nil when not set and any artifact is served
+func allowedExtensions() []string {
+	var allowed []string
+	for _, ext := range splitList(os.Getenv("SERVE_ALLOWED_EXTENSIONS")) {
+		allowed = append(allowed, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+	return allowed
+}
+
+//artifactExtension is the extension of the file the artifact url names, lower cased and without its dot
+func artifactExtension(artifactUrl string) string {
+	u, err := url.Parse(artifactUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(path.Ext(path.Base(u.Path)), "."))
+}
+
+//extensionAllowed reports whether the artifact at artifactUrl may be served under SERVE_ALLOWED_EXTENSIONS, so the
+//proxy can not be used to fetch arbitrary files from Jenkins
+func extensionAllowed(artifactUrl string) bool {
+	allowed := allowedExtensions()
+	if allowed == nil {
+		return true
+	}
+	ext := artifactExtension(artifactUrl)
+	for _, a := range allowed {
+		if ext != "" && ext == a {
+			return true
+		}
+	}
+	return false
+}
+
+//refuseExtension answers 415 when the artifact of a build has an extension which is not allowed, reporting whether
+//it did
+func refuseExtension(rw http.ResponseWriter, buildName string, artifactUrl string) bool {
+	if extensionAllowed(artifactUrl) {
+		return false
+	}
+	ext := artifactExtension(artifactUrl)
+	log.Printf("refusing the artifact of build %s, extension %q is not in SERVE_ALLOWED_EXTENSIONS", buildName, ext)
+	if ext == "" {
+		httpError(rw, fmt.Sprintf("the artifact of build %s has no file extension, which is not allowed", buildName), http.StatusUnsupportedMediaType)
+		return true
+	}
+	httpError(rw, fmt.Sprintf("serving .%s artifacts is not allowed", ext), http.StatusUnsupportedMediaType)
+	return true
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestServeAllowedExtensions(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: env.jenkins.URL + "/artifact/app-release.APK"})
+	env.addBuild("generic-1", "generic", map[string]string{openshift.JenkinsArtifactUri: env.jenkins.URL + "/artifact/config/credentials.xml"})
+	env.addBuild("generic-2", "generic", nil)
+	env.addBuild("ios-1", "ios", map[string]string{
+		openshift.JenkinsArtifactUri:                        env.jenkins.URL + "/artifact/app.ipa",
+		openshift.VariantPrefix + "enterprise.artifact-url": env.jenkins.URL + "/artifact/install.sh",
+	})
+
+	for _, target := range []string{"/android-1/download?", "/generic-1/download?", "/generic-2/download?", "/ios-1/download?artifact=true&variant=enterprise&"} {
+		if rec := env.do("GET", target+"token="+testToken, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected %s to be served without SERVE_ALLOWED_EXTENSIONS but got %d", target, rec.Code)
+		}
+	}
+
+	defer setEnv("SERVE_ALLOWED_EXTENSIONS", "apk, .aab,ipa,zip")()
+	cases := map[string]int{
+		"/android-1/download?":                              http.StatusOK,
+		"/ios-1/download?artifact=true&":                    http.StatusOK,
+		"/generic-1/download?":                              http.StatusUnsupportedMediaType,
+		"/generic-2/download?":                              http.StatusUnsupportedMediaType,
+		"/ios-1/download?artifact=true&variant=enterprise&": http.StatusUnsupportedMediaType,
+	}
+	for target, code := range cases {
+		rec := env.do("GET", target+"token="+testToken, nil)
+		if rec.Code != code {
+			t.Errorf("expected %d for %s but got %d", code, target, rec.Code)
+		}
+		if code == http.StatusUnsupportedMediaType && rec.Body.String() == testArtifact {
+			t.Errorf("expected the refused artifact of %s not to be streamed", target)
+		}
+	}
+}
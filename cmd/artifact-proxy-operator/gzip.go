@@ -0,0 +1,168 @@
+package main
+
+import (
+	"compress/gzip"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//defaultGzipMinBytes is the smallest response compressed when GZIP_MIN_BYTES is not set
+const defaultGzipMinBytes = 1024
+
+//gzipMinBytes reads GZIP_MIN_BYTES, responses smaller than it are not worth compressing
+func gzipMinBytes() int {
+	val := os.Getenv("GZIP_MIN_BYTES")
+	if val == "" {
+		return defaultGzipMinBytes
+	}
+	min, err := strconv.Atoi(val)
+	if err != nil || min < 0 {
+		log.Printf("ignoring invalid GZIP_MIN_BYTES %q", val)
+		return defaultGzipMinBytes
+	}
+	return min
+}
+
+//compressible reports whether a content type is text which gzip shrinks. Binaries, which are already compressed,
+//are always sent as they are
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/xml", "application/json", "application/x-plist":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+//withGzip compresses text responses such as manifests and landing pages for clients which accept gzip. Responses are
+//held back until GZIP_MIN_BYTES have been written, and ones which turn out smaller are sent uncompressed
+func withGzip(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			next(rw, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: rw, min: gzipMinBytes()}
+		defer gw.close()
+		next(gw, r)
+	}
+}
+
+//gzipWriter buffers a compressible response until it knows whether it is big enough to compress
+type gzipWriter struct {
+	http.ResponseWriter
+	min    int
+	status int
+	buf    []byte
+	//decided is set once the response is being passed on, gz is set when that is compressed
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	h := w.Header()
+	if status != http.StatusOK || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" || !compressible(h.Get("Content-Type")) {
+		w.passThrough()
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.min {
+		w.compress()
+		buffered := w.buf
+		w.buf = nil
+		if _, err := w.gz.Write(buffered); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *gzipWriter) compress() {
+	w.decided = true
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	// the compressed bytes differ from the ones the upstream validator describes, so it can only be a weak match
+	if etag := w.Header().Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		w.Header().Set("ETag", "W/"+etag)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+//passThrough sends the response uncompressed, along with anything buffered so far
+func (w *gzipWriter) passThrough() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+//close finishes the response once the handler is done, sending a response which stayed below the threshold as it is
+func (w *gzipWriter) close() {
+	if w.status == 0 {
+		// nothing was written, leave the default response to the server
+		return
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		return
+	}
+	w.passThrough()
+}
+
+func (w *gzipWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	} else {
+		w.passThrough()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Unwrap lets http.ResponseController reach the underlying writer
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
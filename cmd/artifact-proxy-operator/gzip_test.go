@@ -0,0 +1,97 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func serveGzip(contentType string, body string, acceptEncoding string) *httptest.ResponseRecorder {
+	handler := withGzip(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("content-type", contentType)
+		// written in pieces so the threshold is crossed part way through
+		for i := 0; i < len(body); i += 100 {
+			end := i + 100
+			if end > len(body) {
+				end = len(body)
+			}
+			rw.Write([]byte(body[i:end]))
+		}
+	})
+	req := httptest.NewRequest("GET", "/build/download", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestGzipThreshold(t *testing.T) {
+	small := strings.Repeat("a", defaultGzipMinBytes-1)
+	rec := serveGzip("application/xml", small, "gzip")
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != small {
+		t.Fatalf("expected a response below the threshold to be sent uncompressed but got encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+
+	large := strings.Repeat("<plist/>", defaultGzipMinBytes)
+	rec = serveGzip("application/xml", large, "deflate, gzip;q=0.8")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a response above the threshold to be compressed but got encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Body.Len() >= len(large) {
+		t.Fatalf("expected the compressed body to be smaller than %d bytes but it is %d", len(large), rec.Body.Len())
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal("error reading compressed response " + err.Error())
+	}
+	if body, _ := ioutil.ReadAll(gz); string(body) != large {
+		t.Fatal("expected the compressed body to decompress to the response")
+	}
+}
+
+func TestGzipSkipped(t *testing.T) {
+	large := strings.Repeat("a", 4*defaultGzipMinBytes)
+	if rec := serveGzip("application/xml", large, ""); rec.Header().Get("Content-Encoding") != "" {
+		t.Fatal("expected no compression for a client which does not accept gzip")
+	}
+	if rec := serveGzip(binaryContentType, large, "gzip"); rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != large {
+		t.Fatal("expected binaries to be sent uncompressed")
+	}
+
+	defer setEnv("GZIP_MIN_BYTES", "0")()
+	if rec := serveGzip("text/plain", "tiny", "gzip"); rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected every text response to be compressed with a threshold of zero")
+	}
+}
+
+func TestGzipWeakensETag(t *testing.T) {
+	defer setEnv("GZIP_MIN_BYTES", "0")()
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("ETag", `"abc"`)
+		rw.Write([]byte(testArtifact))
+	}))
+	defer upstream.Close()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("web-1", "web", map[string]string{
+		openshift.JenkinsArtifactUri: upstream.URL + "/notes.txt",
+		openshift.ContentType:        "text/plain",
+		openshift.NoCache:            "true",
+	})
+
+	rec := env.do("GET", "/web-1/download?token="+testToken, map[string]string{"Accept-Encoding": "gzip"})
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("ETag") != `W/"abc"` {
+		t.Fatalf("expected a compressed response with a weak ETag but got encoding %q and ETag %q", rec.Header().Get("Content-Encoding"), rec.Header().Get("ETag"))
+	}
+	rec = env.do("GET", "/web-1/download?token="+testToken, nil)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Header().Get("ETag") != `"abc"` {
+		t.Fatalf("expected an uncompressed response to keep the strong ETag but got encoding %q and ETag %q", rec.Header().Get("Content-Encoding"), rec.Header().Get("ETag"))
+	}
+}
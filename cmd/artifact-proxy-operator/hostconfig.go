@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+//operatorHostReloadInterval is how often OPERATOR_HOSTNAME_FILE is checked for a new hostname
+var operatorHostReloadInterval = 10 * time.Second
+
+//watchOperatorHostFile applies changes to the operator hostname in OPERATOR_HOSTNAME_FILE until stop is closed. The
+//file is usually a key of a mounted ConfigMap, which the kubelet updates in place, so a new ingress hostname takes
+//effect without restarting the pod
+func watchOperatorHostFile(file string, stop <-chan struct{}) {
+	ticker := time.NewTicker(operatorHostReloadInterval)
+	defer ticker.Stop()
+	rejected := ""
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			rejected = reloadOperatorHost(file, rejected)
+		}
+	}
+}
+
+//reloadOperatorHost applies the hostname in file when it changed. A hostname which is not valid is logged once and
+//the current one kept, the rejected hostname is returned so it is not logged again on every check
+func reloadOperatorHost(file string, rejected string) string {
+	host, err := openshift.ReadOperatorHostFile(file)
+	if err != nil {
+		log.Printf("error reading operator hostname from %s: %s", file, err.Error())
+		return rejected
+	}
+	current := osClient.GetOperatorHost()
+	if host == current || host == rejected {
+		return rejected
+	}
+	if err := osClient.SetOperatorHost(host); err != nil {
+		log.Printf("keeping operator hostname %s, %s", current, err.Error())
+		return host
+	}
+	log.Printf("operator hostname changed from %s to %s", current, host)
+	return ""
+}
+
+//operatorHostFile is OPERATOR_HOSTNAME_FILE, empty when the hostname is fixed by OPERATOR_HOSTNAME
+func operatorHostFile() string {
+	return os.Getenv("OPERATOR_HOSTNAME_FILE")
+}
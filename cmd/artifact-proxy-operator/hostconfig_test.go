@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOperatorHostFromFile(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+	dir, err := ioutil.TempDir("", "operator-host")
+	if err != nil {
+		t.Fatal("error creating config dir " + err.Error())
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hostname")
+	writeHost := func(host string) {
+		if err := ioutil.WriteFile(file, []byte(host+"\n"), 0644); err != nil {
+			t.Fatal("error writing hostname " + err.Error())
+		}
+	}
+	itmsHost := func() string {
+		rec := env.do("GET", "/ios-1/itms?token="+testToken, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected the itms url but got %d", rec.Code)
+		}
+		return strings.SplitN(strings.TrimPrefix(rec.Body.String(), "itms-services://?action=download-manifest&url=https%3A%2F%2F"), "%2F", 2)[0]
+	}
+	defer func(interval time.Duration) { operatorHostReloadInterval = interval }(operatorHostReloadInterval)
+	operatorHostReloadInterval = 10 * time.Millisecond
+	writeHost("proxy.example.com")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchOperatorHostFile(file, stop)
+	}()
+	// the watcher uses the global client, it must have stopped before the next test replaces it
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	waitForHost := func(expected string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for itmsHost() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected urls to use %s but got %s", expected, itmsHost())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	writeHost("apps.new-ingress.example.com")
+	waitForHost("apps.new-ingress.example.com")
+	if rec := env.do("GET", "/ios-1/download?plist=true&token="+testToken, nil); !strings.Contains(rec.Body.String(), "https://apps.new-ingress.example.com/ios-1/download") {
+		t.Fatalf("expected the manifest to use the new hostname but got \n%s", rec.Body.String())
+	}
+
+	for _, invalid := range []string{"", "https://proxy.example.com", "proxy.example.com/path", "proxy example.com"} {
+		writeHost(invalid)
+		time.Sleep(5 * operatorHostReloadInterval)
+		if host := itmsHost(); host != "apps.new-ingress.example.com" {
+			t.Fatalf("expected invalid hostname %q to be rejected but urls use %s", invalid, host)
+		}
+	}
+	writeHost("proxy.example.com:8443")
+	waitForHost("proxy.example.com%3A8443")
+}
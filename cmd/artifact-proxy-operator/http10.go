@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const defaultHttp10BufferMax = 256 << 20
+
+//http10Strategy is HTTP10_STRATEGY, how a download is sent to an HTTP/1.0 client, which can not take a chunked body:
+//"close" (the default) ends the body by closing the connection, "buffer" spools the artifact first to send it with a
+//Content-Length, for download managers which treat a closed connection as a failed download
+func http10Strategy() string {
+	switch strategy := os.Getenv("HTTP10_STRATEGY"); strategy {
+	case "", "close":
+		return "close"
+	case "buffer":
+		return strategy
+	default:
+		log.Printf("ignoring unknown HTTP10_STRATEGY %q, closing the connection after the body instead", strategy)
+		return "close"
+	}
+}
+
+//http10BufferMax is HTTP10_BUFFER_MAX_BYTES, the largest artifact the buffer strategy spools (default 256MiB).
+//Larger artifacts are sent by closing the connection after the body
+func http10BufferMax() int64 {
+	if configured, err := strconv.ParseInt(os.Getenv("HTTP10_BUFFER_MAX_BYTES"), 10, 64); err == nil && configured > 0 {
+		return configured
+	}
+	return defaultHttp10BufferMax
+}
+
+//prepareHttp10Body readies body to be sent to an HTTP/1.0 client. The buffer strategy spools it to a temporary file
+//and sets its Content-Length, otherwise the connection is closed after the body so the client sees where it ends. The
+//returned func removes the spooled file once the body has been sent
+func prepareHttp10Body(rw http.ResponseWriter, body io.Reader) (io.Reader, func(), error) {
+	if http10Strategy() != "buffer" {
+		rw.Header().Set("Connection", "close")
+		return body, func() {}, nil
+	}
+	spool, err := ioutil.TempFile("", "artifact-proxy-http10-")
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	max := http10BufferMax()
+	spooled, err := io.CopyN(spool, body, max+1)
+	if err != nil && err != io.EOF {
+		release()
+		return nil, nil, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		release()
+		return nil, nil, err
+	}
+	if spooled > max {
+		log.Printf("artifact is larger than HTTP10_BUFFER_MAX_BYTES, closing the connection after the body instead")
+		rw.Header().Set("Connection", "close")
+		return io.MultiReader(spool, body), release, nil
+	}
+	rw.Header().Set("Content-Length", strconv.FormatInt(spooled, 10))
+	return spool, release, nil
+}
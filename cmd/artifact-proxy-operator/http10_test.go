@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+//http10Get sends a keep-alive HTTP/1.0 request to server and reads until the server closes the connection, failing
+//if it is left open
+func http10Get(t *testing.T, server *httptest.Server, target string) *http.Response {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("error connecting " + err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("GET " + target + " HTTP/1.0\r\nHost: proxy.example.com\r\nConnection: keep-alive\r\n\r\n")); err != nil {
+		t.Fatal("error sending request " + err.Error())
+	}
+	raw, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal("expected the connection to be closed after the body but got " + err.Error())
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		t.Fatal("error reading response " + err.Error())
+	}
+	return resp
+}
+
+func TestHttp10Close(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	resp := http10Get(t, server, "/android-1/download?token="+testToken)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != testArtifact {
+		t.Fatalf("expected the artifact but got %d %q", resp.StatusCode, body)
+	}
+	if len(resp.TransferEncoding) != 0 || resp.Header.Get("Connection") != "close" {
+		t.Fatalf("expected an unchunked body ended by closing the connection but got %v %v", resp.TransferEncoding, resp.Header)
+	}
+}
+
+func TestHttp10Buffer(t *testing.T) {
+	defer setEnv("HTTP10_STRATEGY", "buffer")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("error connecting " + err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		conn.Write([]byte("GET /android-1/download?token=" + testToken + " HTTP/1.0\r\nHost: proxy.example.com\r\nConnection: keep-alive\r\n\r\n"))
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal("expected the connection to be kept alive but got " + err.Error())
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != testArtifact || resp.Header.Get("Content-Length") != strconv.Itoa(len(testArtifact)) {
+			t.Fatalf("expected the artifact with its length but got %q %v", body, resp.Header)
+		}
+	}
+
+	defer setEnv("HTTP10_BUFFER_MAX_BYTES", "4")()
+	resp := http10Get(t, server, "/android-1/download?token="+testToken)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != testArtifact || resp.Header.Get("Connection") != "close" {
+		t.Fatalf("expected an artifact too large to buffer to be ended by closing the connection but got %q %v", body, resp.Header)
+	}
+}
+
+func TestHttp10BufferCountsAsActiveStream(t *testing.T) {
+	defer setEnv("HTTP10_STRATEGY", "buffer")()
+	env := newTestEnv(t)
+	defer env.close()
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(testArtifact))
+		rw.(http.Flusher).Flush()
+		<-release
+	}))
+	defer upstream.Close()
+	env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/artifact"})
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("error connecting " + err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET /android-1/download?token=" + testToken + " HTTP/1.0\r\nHost: proxy.example.com\r\n\r\n"))
+	// nothing is sent to the client while the artifact is spooled, a shutdown must still wait for it
+	deadline := time.Now().Add(5 * time.Second)
+	for activeStreams.count() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if active := activeStreams.count(); active != 1 {
+		close(release)
+		t.Fatalf("expected the buffered download to be an active stream but got %d", active)
+	}
+	close(release)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("error reading response " + err.Error())
+	}
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != testArtifact {
+		t.Fatalf("expected the artifact but got %q", body)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+const defaultErrorMessageMaxLength = 256
+
+// urlPattern matches absolute URLs in error messages, e.g. Jenkins download URLs
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+//errorMessageMaxLength is the longest error message sent in a response, ERROR_MESSAGE_MAX_LENGTH (default 256)
+func errorMessageMaxLength() int {
+	if configured, err := strconv.Atoi(os.Getenv("ERROR_MESSAGE_MAX_LENGTH")); err == nil && configured > 0 {
+		return configured
+	}
+	return defaultErrorMessageMaxLength
+}
+
+//httpError replies with an error message which has been made safe to send by sanitizeErrorMessage. All error
+//responses go through it rather than http.Error
+func httpError(rw http.ResponseWriter, message string, code int) {
+	http.Error(rw, sanitizeErrorMessage(message), code)
+}
+
+//sanitizeErrorMessage reduces URLs in an error message to their host, so paths and tokens in them are not leaked, and
+//truncates it to errorMessageMaxLength
+func sanitizeErrorMessage(message string) string {
+	message = urlPattern.ReplaceAllStringFunc(message, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return "[url]"
+		}
+		return u.Scheme + "://" + u.Host
+	})
+	max := errorMessageMaxLength()
+	if runes := []rune(message); len(runes) > max {
+		return string(runes[:max]) + "..."
+	}
+	return message
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeErrorMessage(t *testing.T) {
+	msg := sanitizeErrorMessage("error fetching https://jenkins.example.com:8443/job/app/1/artifact/app.apk?token=secret from Jenkins")
+	if msg != "error fetching https://jenkins.example.com:8443 from Jenkins" {
+		t.Fatalf("expected the URL to be reduced to its host but got %q", msg)
+	}
+
+	long := strings.Repeat("x", defaultErrorMessageMaxLength*2)
+	if msg := sanitizeErrorMessage(long); msg != long[:defaultErrorMessageMaxLength]+"..." {
+		t.Fatalf("expected the message to be truncated to %d characters but got %d", defaultErrorMessageMaxLength, len(msg))
+	}
+
+	defer setEnv("ERROR_MESSAGE_MAX_LENGTH", "5")()
+	if msg := sanitizeErrorMessage("much too long"); msg != "much ..." {
+		t.Fatalf("expected ERROR_MESSAGE_MAX_LENGTH to be respected but got %q", msg)
+	}
+}
+
+func TestHttpError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	httpError(rec, "artifact http://jenkins/job/secret-path not found "+strings.Repeat("y", 1000), http.StatusNotFound)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d but got %d", http.StatusNotFound, rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "secret-path") || len(body) > defaultErrorMessageMaxLength+10 {
+		t.Fatalf("expected a redacted and truncated body but got %q", body)
+	}
+}
+
+func TestErrorBodiesDoNotDumpBuilds(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("unknown-type", "not-a-type", nil)
+
+	rec := env.do("GET", "/unknown-type/download?token="+testToken, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d but got %d", http.StatusBadRequest, rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, env.jenkins.URL) || strings.Contains(body, testToken) {
+		t.Fatalf("expected the build not to be dumped into the error but got %q", body)
+	}
+}
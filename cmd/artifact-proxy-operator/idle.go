@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+//streamIdleTimeout is how long a client may go without accepting any of a download before it is aborted,
+//STREAM_IDLE_TIMEOUT_SECONDS. It is disabled by default
+func streamIdleTimeout() time.Duration {
+	if configured, err := strconv.Atoi(os.Getenv("STREAM_IDLE_TIMEOUT_SECONDS")); err == nil && configured > 0 {
+		return time.Duration(configured) * time.Second
+	}
+	return 0
+}
+
+//idleTimeoutWriter pushes the write deadline of the connection back before every write, so a client which stops
+//reading fails the write instead of tying up the stream from Jenkins indefinitely
+type idleTimeoutWriter struct {
+	http.ResponseWriter
+	controller *http.ResponseController
+	timeout    time.Duration
+}
+
+//withIdleTimeout wraps rw with the configured idle timeout, the returned func clears the deadline again once the
+//response has been written so it does not apply to later requests on the same connection
+func withIdleTimeout(rw http.ResponseWriter) (http.ResponseWriter, func()) {
+	timeout := streamIdleTimeout()
+	if timeout == 0 {
+		return rw, func() {}
+	}
+	controller := http.NewResponseController(rw)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		// not supported by the underlying writer, e.g. in tests
+		return rw, func() {}
+	}
+	return &idleTimeoutWriter{ResponseWriter: rw, controller: controller, timeout: timeout}, func() {
+		controller.SetWriteDeadline(time.Time{})
+	}
+}
+
+func (w *idleTimeoutWriter) Write(p []byte) (int, error) {
+	w.controller.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *idleTimeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
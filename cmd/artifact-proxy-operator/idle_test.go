@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSlowClientIsAborted(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	// far more than the socket buffers hold, so the client has to read for the download to finish
+	env.setArtifact("/artifact/android-1", bytes.Repeat([]byte("x"), 64<<20))
+	defer setEnv("STREAM_IDLE_TIMEOUT_SECONDS", "1")()
+
+	done := make(chan struct{})
+	router := newRouter()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		router.ServeHTTP(rw, r)
+	}))
+	defer server.Close()
+
+	errors := downloadErrorsTotal.Value(testNamespace)
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("error connecting " + err.Error())
+	}
+	defer conn.Close()
+	// never read the response
+	fmt.Fprintf(conn, "GET /android-1/download?token=%s HTTP/1.1\r\nHost: proxy\r\n\r\n", testToken)
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the download to a client which stopped reading to be aborted")
+	}
+	if downloadErrorsTotal.Value(testNamespace) != errors+1 {
+		t.Fatal("expected the aborted download to be counted as an error")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/links"
+	"github.com/aerogear/artifact-proxy-operator/pkg/plist"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//isIndexPath reports whether urlPath is the index of a build, /<build>/ with nothing after the build name
+func isIndexPath(urlPath string) bool {
+	splitPath := strings.Split(urlPath, "/")
+	return len(splitPath) == 3 && splitPath[1] != "" && splitPath[2] == ""
+}
+
+//indexHandler serves /<build>/, a page with a button for each platform the build can be downloaded for, so a share
+//link does not need to know the routes of each platform. The token is checked once here and put in every link
+func indexHandler(rw http.ResponseWriter, r *http.Request) {
+	build, token, ok := lookupAuthorizedBuild(rw, r)
+	if !ok {
+		return
+	}
+	buildType, err := osClient.GetBuildType(build)
+	if err != nil {
+		httpError(rw, fmt.Sprintf("unable to determine the type of build %s", build.Name), http.StatusInternalServerError)
+		return
+	}
+	platforms := indexPlatforms(build, resolveBuildType(build.Name, buildType), token)
+	if len(platforms) == 0 {
+		httpError(rw, fmt.Sprintf("build %s has no platforms to download", build.Name), http.StatusConflict)
+		return
+	}
+	body, err := plist.ProduceIndexHTML(plist.IndexPage{Build: build.Name, Platforms: platforms})
+	if err != nil {
+		log.Printf("error rendering index page for build %s: %s", build.Name, err.Error())
+		httpError(rw, "error rendering index page", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("content-type", "text/html")
+	rw.Write([]byte(body))
+}
+
+//indexPlatforms returns the buttons of the index page of a build. Universal builds get one for each platform with an
+//artifact, other builds one for their own type. Disabled build types are left out
+func indexPlatforms(build *apibuildv1.Build, buildType string, token string) []plist.PlatformLink {
+	host := osClient.GetOperatorHost()
+	var platforms []plist.PlatformLink
+	for _, platform := range []string{"android", "ios"} {
+		link := links.Link{Host: host, Build: build.Name, Token: token}
+		if isUniversalBuildType(buildType) {
+			if _, ok := platformArtifactUrl(build, platform); !ok {
+				continue
+			}
+			link.Params = url.Values{"platform": {platform}}
+		} else if buildType != platform {
+			continue
+		}
+		if buildTypeDisabled(platform) {
+			continue
+		}
+		if platform == "ios" {
+			platforms = append(platforms, plist.PlatformLink{Platform: platform, Label: "Install on iOS", Url: template.URL(link.ItmsServices())})
+		} else {
+			platforms = append(platforms, plist.PlatformLink{Platform: platform, Label: "Download for Android", Url: template.URL(link.Download())})
+		}
+	}
+	return platforms
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestIndexPage(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("flutter-1", "flutter", map[string]string{
+		openshift.AndroidArtifactUri: env.jenkins.URL + "/artifact/app.apk",
+		openshift.IosArtifactUri:     env.jenkins.URL + "/artifact/app.ipa",
+	})
+	env.addBuild("flutter-2", "flutter", nil)
+	env.addBuild("android-1", "android", nil)
+
+	rec := env.do("GET", "/flutter-1/?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("content-type") != "text/html" {
+		t.Fatalf("expected the index page but got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	androidLink := `<a id="android" href="https://proxy.example.com/flutter-1/download?platform=android&amp;token=` + testToken + `">`
+	if !strings.Contains(body, androidLink) {
+		t.Fatalf("expected android link in page but got \n%s", body)
+	}
+	iosLink := `<a id="ios" href="itms-services://?action=download-manifest&amp;url=https%3A%2F%2Fproxy.example.com%2Fflutter-1%2Fdownload%3Fplatform%3Dios%26plist%3Dtrue%26token%3D` + testToken + `">`
+	if !strings.Contains(body, iosLink) {
+		t.Fatalf("expected ios link in page but got \n%s", body)
+	}
+
+	body = env.do("GET", "/android-1/?token="+testToken, nil).Body.String()
+	if !strings.Contains(body, `id="android"`) || strings.Contains(body, `id="ios"`) {
+		t.Fatalf("expected only the android link for an android build but got \n%s", body)
+	}
+	defer setEnv("DISABLED_BUILD_TYPES", "ios")()
+	body = env.do("GET", "/flutter-1/?token="+testToken, nil).Body.String()
+	if strings.Contains(body, `id="ios"`) {
+		t.Fatalf("expected no link for a disabled build type but got \n%s", body)
+	}
+
+	if rec := env.do("GET", "/flutter-1/?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a wrong token to get %d but got %d", http.StatusForbidden, rec.Code)
+	}
+	if rec := env.do("GET", "/flutter-2/?token="+testToken, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected a build without platform artifacts to get %d but got %d", http.StatusConflict, rec.Code)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+//maxIpaChecks bounds how many ipa check results are remembered, they are all forgotten once it is reached
+const maxIpaChecks = 1000
+
+//validateIpa is VALIDATE_IPA, checking that an ipa looks installable before serving its install manifest. iOS gives no
+//reason when an install fails, so a clear error up front saves a lot of guessing
+func validateIpa() bool {
+	return os.Getenv("VALIDATE_IPA") == "true"
+}
+
+//ipaCheckCache remembers the outcome of checking each ipa, keyed by its cache key and url so a new artifact url is
+//checked again
+type ipaCheckCache struct {
+	lock    sync.Mutex
+	results map[string]error
+}
+
+var ipaChecks = &ipaCheckCache{results: map[string]error{}}
+
+func (c *ipaCheckCache) get(key string) (error, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	err, ok := c.results[key]
+	return err, ok
+}
+
+func (c *ipaCheckCache) set(key string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.results) >= maxIpaChecks {
+		c.results = map[string]error{}
+	}
+	c.results[key] = err
+}
+
+//forget drops the outcomes of checking the ipas cached under cacheKey, whatever their url
+func (c *ipaCheckCache) forget(cacheKey string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key := range c.results {
+		if strings.HasPrefix(key, cacheKey+" ") {
+			delete(c.results, key)
+		}
+	}
+}
+
+//checkIpa reports why the ipa of a would not install, nil when it looks fine. The check is best effort, an ipa which
+//can not be fetched right now, or is in S3, is let through for the install to find out
+func checkIpa(a artifact) error {
+	key := a.cacheKey + " " + a.url
+	if err, ok := ipaChecks.get(key); ok {
+		return err
+	}
+	if isS3Location(a.url) || ((artifactCache == nil || a.noCache) && lowOnMemory()) {
+		return nil
+	}
+	archive, closeArchive, err := openZip(a)
+	if err == zip.ErrFormat {
+		err = errors.New("it is not a zip archive")
+		ipaChecks.set(key, err)
+		return err
+	}
+	if err != nil {
+		log.Printf("skipping the check of ipa %s, it could not be read: %s", a.cacheKey, err.Error())
+		return nil
+	}
+	defer closeArchive()
+	err = inspectIpa(archive)
+	ipaChecks.set(key, err)
+	return err
+}
+
+//inspectIpa checks an ipa has the layout of a signed app: a Payload/<name>.app bundle with the provisioning profile
+//it was signed for in it
+func inspectIpa(archive *zip.Reader) error {
+	apps := map[string]bool{}
+	provisioned := map[string]bool{}
+	for _, f := range archive.File {
+		parts := strings.Split(f.Name, "/")
+		if len(parts) < 3 || parts[0] != "Payload" || !strings.HasSuffix(parts[1], ".app") {
+			continue
+		}
+		apps[parts[1]] = true
+		if len(parts) == 3 && parts[2] == "embedded.mobileprovision" {
+			provisioned[parts[1]] = true
+		}
+	}
+	if len(apps) == 0 {
+		return errors.New("it has no Payload/<name>.app bundle")
+	}
+	for app := range apps {
+		if !provisioned[app] {
+			return errors.New("Payload/" + app + " has no embedded.mobileprovision so it is not signed for distribution")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func ipaBytes(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal("error creating ipa " + err.Error())
+		}
+		f.Write([]byte(name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("error creating ipa " + err.Error())
+	}
+	return buf.Bytes()
+}
+
+func TestValidateIpa(t *testing.T) {
+	defer setEnv("VALIDATE_IPA", "true")()
+	cases := []struct {
+		name    string
+		content []byte
+		code    int
+		reason  string
+	}{
+		{"valid", ipaBytes(t, "Payload/App.app/App", "Payload/App.app/Info.plist", "Payload/App.app/embedded.mobileprovision"), http.StatusOK, ""},
+		{"unsigned", ipaBytes(t, "Payload/App.app/App", "Payload/App.app/Info.plist"), http.StatusConflict, "Payload/App.app has no embedded.mobileprovision"},
+		{"no-payload", ipaBytes(t, "App.app/App", "App.app/embedded.mobileprovision"), http.StatusConflict, "no Payload/<name>.app bundle"},
+		{"not-zip", []byte("<html>login</html>"), http.StatusConflict, "not a zip archive"},
+	}
+	for _, c := range cases {
+		ipaChecks = &ipaCheckCache{results: map[string]error{}}
+		env := newTestEnv(t)
+		env.addBuild("ios-"+c.name, "ios", nil)
+		src := &memorySource{content: c.content}
+		restore := useSource(src)
+
+		for i := 0; i < 2; i++ {
+			rec := env.do("GET", "/ios-"+c.name+"/download?plist=true&token="+testToken, nil)
+			if rec.Code != c.code || !strings.Contains(rec.Body.String(), c.reason) {
+				t.Fatalf("%s: expected %d mentioning %q but got %d %s", c.name, c.code, c.reason, rec.Code, rec.Body.String())
+			}
+		}
+		if _, ranged, _ := src.counts(); ranged != 1 {
+			t.Fatalf("%s: expected the check result to be cached but the ipa was opened %d times", c.name, ranged)
+		}
+		restore()
+		env.close()
+	}
+}
+
+func TestValidateIpaBestEffort(t *testing.T) {
+	defer setEnv("VALIDATE_IPA", "true")()
+	ipaChecks = &ipaCheckCache{results: map[string]error{}}
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+	defer useSource(&memorySource{err: errors.New("unexpected response code from Jenkins download 503 Service Unavailable")})()
+
+	rec := env.do("GET", "/ios-1/download?plist=true&token="+testToken, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<plist") {
+		t.Fatalf("expected the manifest when the ipa can not be read but got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(ipaChecks.results) != 0 {
+		t.Fatal("expected an ipa which could not be read not to be remembered")
+	}
+}
+
+func TestValidateIpaDisabled(t *testing.T) {
+	ipaChecks = &ipaCheckCache{results: map[string]error{}}
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+	src := &memorySource{content: []byte("not an ipa")}
+	defer useSource(src)()
+
+	if rec := env.do("GET", "/ios-1/download?plist=true&token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected the manifest without VALIDATE_IPA but got %d", rec.Code)
+	}
+	if _, ranged, _ := src.counts(); ranged != 0 {
+		t.Fatal("expected the ipa not to be opened without VALIDATE_IPA")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+//itmsHandler serves /<build>/itms, returning the itms-services URL which installs an iOS build as plain text so it
+//can be copied into MDM tooling
+func itmsHandler(rw http.ResponseWriter, r *http.Request) {
+	build, token, ok := lookupAuthorizedBuild(rw, r)
+	if !ok {
+		return
+	}
+	if buildType, err := osClient.GetBuildType(build); err != nil || buildType != "ios" {
+		httpError(rw, fmt.Sprintf("build %s is not an ios build", build.Name), http.StatusBadRequest)
+		return
+	}
+	rw.Header().Set("content-type", "text/plain")
+	rw.Write([]byte(osClient.GenerateItmsUrl(build.Name, token)))
+}
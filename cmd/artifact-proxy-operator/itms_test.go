@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestItmsUrl(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+	env.addBuild("android-1", "android", nil)
+
+	rec := env.do("GET", "/ios-1/itms?token="+testToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	expected := "itms-services://?action=download-manifest&url=https%3A%2F%2Fproxy.example.com%2Fios-1%2Fdownload%3Fplist%3Dtrue%26token%3D" + testToken
+	if rec.Body.String() != expected {
+		t.Fatalf("expected %q but got %q", expected, rec.Body.String())
+	}
+	if ct := rec.Header().Get("content-type"); ct != "text/plain" {
+		t.Fatalf("expected content type text/plain but got %q", ct)
+	}
+
+	if rec := env.do("GET", "/ios-1/itms?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a bad token to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/itms?token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an android build to be refused, got status %d", rec.Code)
+	}
+}
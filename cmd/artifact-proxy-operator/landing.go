@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/plist"
+)
+
+//landingTemplatePath reads LANDING_TEMPLATE_<TYPE>_PATH, a custom landing page template for a build type
+func landingTemplatePath(buildType string) string {
+	return os.Getenv("LANDING_TEMPLATE_" + strings.ToUpper(buildType) + "_PATH")
+}
+
+//androidLandingEnabled shows android downloads a landing page with a download button before the apk, when
+//ANDROID_LANDING_PAGE is set or a custom android template is configured. Otherwise they get the apk straight away
+func androidLandingEnabled() bool {
+	return os.Getenv("ANDROID_LANDING_PAGE") == "true" || landingTemplatePath("android") != ""
+}
+
+//serveLanding renders the landing page for a build type, with the template configured for the type or the built in
+//one. A configured template which can not be rendered is an error rather than falling back, so it gets noticed
+func serveLanding(rw http.ResponseWriter, page plist.LandingPage) {
+	var body string
+	var err error
+	if file := landingTemplatePath(page.BuildType); file != "" {
+		t, loadErr := plist.LoadLandingTemplate(file)
+		if loadErr != nil {
+			err = loadErr
+		} else {
+			body, err = plist.RenderLanding(t, page)
+		}
+	} else {
+		body, err = plist.ProduceLandingHTML(page)
+	}
+	if err != nil {
+		log.Printf("error rendering %s landing page for build %s: %s", page.BuildType, page.Build, err.Error())
+		httpError(rw, "error rendering landing page", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("content-type", "text/html")
+	rw.Write([]byte(body))
+}
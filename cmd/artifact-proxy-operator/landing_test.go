@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeLandingTemplate(t *testing.T, dir string, name string, content string) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal("error writing template " + err.Error())
+	}
+	return file
+}
+
+func TestLandingTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "landing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	env.addBuild("ios-1", "ios", nil)
+
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Body.String() != testArtifact {
+		t.Fatal("expected android builds to be downloaded straight away by default")
+	}
+	if rec := env.do("GET", "/ios-1/download?token="+testToken, nil); !strings.Contains(rec.Body.String(), "itms-services://") {
+		t.Fatalf("expected the built in ios landing page but got \n%s", rec.Body.String())
+	}
+
+	defer setEnv("ANDROID_LANDING_PAGE", "true")()
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if !strings.Contains(rec.Body.String(), `href="https://proxy.example.com/android-1/download?artifact=true&amp;token=`+testToken+`"`) {
+		t.Fatalf("expected the built in android landing page but got \n%s", rec.Body.String())
+	}
+	if rec := env.do("GET", "/android-1/download?artifact=true&token="+testToken, nil); rec.Body.String() != testArtifact {
+		t.Fatal("expected the download button to download the apk")
+	}
+
+	defer setEnv("LANDING_TEMPLATE_ANDROID_PATH", writeLandingTemplate(t, dir, "android.html", `<a href="{{.DownloadUrl}}">Get {{.Build}}</a>`))()
+	defer setEnv("LANDING_TEMPLATE_IOS_PATH", writeLandingTemplate(t, dir, "ios.html", `<a href="{{.ItmsServicesUrl}}">Install {{.Build}}</a> <a href="{{.ManifestUrl}}">manifest</a>`))()
+	rec = env.do("GET", "/android-1/download?token="+testToken, nil)
+	if !strings.HasPrefix(rec.Body.String(), `<a href="https://proxy.example.com/android-1/download?artifact=true&amp;token=`) || !strings.HasSuffix(rec.Body.String(), "Get android-1</a>") {
+		t.Fatalf("expected the custom android template but got \n%s", rec.Body.String())
+	}
+	rec = env.do("GET", "/ios-1/download?token="+testToken, nil)
+	if !strings.HasPrefix(rec.Body.String(), `<a href="itms-services://?action=download-manifest&amp;url=https%3A%2F%2F`) || !strings.Contains(rec.Body.String(), "Install ios-1</a>") {
+		t.Fatalf("expected the custom ios template but got %d \n%s", rec.Code, rec.Body.String())
+	}
+
+	defer setEnv("LANDING_TEMPLATE_IOS_PATH", writeLandingTemplate(t, dir, "broken.html", `{{.Missing`))()
+	if rec := env.do("GET", "/ios-1/download?token="+testToken, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d for a broken template but got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
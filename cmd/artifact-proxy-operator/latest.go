@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//latestAliasPath parses /app/<stream>/latest/<route>, which stands in for /<latest build of stream>/<route>
+func latestAliasPath(urlPath string) (string, string, bool) {
+	parts := strings.SplitN(urlPath, "/", 5)
+	if len(parts) != 5 || parts[1] != "app" || parts[2] == "" || parts[3] != "latest" {
+		return "", "", false
+	}
+	return parts[2], parts[4], true
+}
+
+//resolveLatestAlias rewrites a request for the latest build of a stream into one for the build itself. When the stream
+//has no completed build an error response is written and false returned
+func resolveLatestAlias(rw http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	stream, rest, ok := latestAliasPath(r.URL.Path)
+	if !ok {
+		return r, true
+	}
+	name, ok := osClient.Streams.Latest(stream)
+	if !ok {
+		httpError(rw, fmt.Sprintf("no completed build for stream %s", stream), http.StatusNotFound)
+		return nil, false
+	}
+	resolved := new(http.Request)
+	*resolved = *r
+	u := *r.URL
+	u.Path = "/" + name + "/" + rest
+	u.RawPath = ""
+	resolved.URL = &u
+	return resolved, true
+}
+
+//validStreamToken reports whether token is the stream token of the build's stream and the build is the latest of it,
+//so a stream's link follows its latest build without knowing each build's own token
+func validStreamToken(build *apibuildv1.Build, token string) bool {
+	stream := build.Labels[openshift.StreamLabel]
+	streamToken := build.Annotations[openshift.StreamToken]
+	if stream == "" || streamToken == "" || token != streamToken {
+		return false
+	}
+	latest, ok := osClient.Streams.Latest(stream)
+	return ok && latest == build.Name
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func addStreamBuild(env *testEnv, name string, completed time.Time) *apibuildv1.Build {
+	build := env.addBuild(name, "android", map[string]string{openshift.StreamToken: "stream-token"})
+	build.Labels = map[string]string{openshift.StreamLabel: "myapp"}
+	build.Status.Phase = apibuildv1.BuildPhaseComplete
+	build.Status.CompletionTimestamp = &metav1.Time{Time: completed}
+	env.setArtifact("/artifact/"+name, []byte(name))
+	return build
+}
+
+func TestLatestAlias(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	now := time.Now()
+
+	if rec := env.do("GET", "/app/myapp/latest/download?token=stream-token", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a stream without builds but got %d", http.StatusNotFound, rec.Code)
+	}
+
+	osClient.Streams.Record(addStreamBuild(env, "myapp-1", now.Add(-time.Hour)))
+	rec := env.do("GET", "/app/myapp/latest/download?token=stream-token", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "myapp-1" {
+		t.Fatalf("expected the only build of the stream but got %d %q", rec.Code, rec.Body.String())
+	}
+
+	osClient.Streams.Record(addStreamBuild(env, "myapp-2", now))
+	if rec := env.do("GET", "/app/myapp/latest/download?token=stream-token", nil); rec.Body.String() != "myapp-2" {
+		t.Fatalf("expected the newly completed build but got %q", rec.Body.String())
+	}
+	// an update to an older build does not take over
+	osClient.Streams.Record(addStreamBuild(env, "myapp-1", now.Add(-time.Hour)))
+	if rec := env.do("GET", "/app/myapp/latest/download?token=stream-token", nil); rec.Body.String() != "myapp-2" {
+		t.Fatalf("expected the latest build to stay the same but got %q", rec.Body.String())
+	}
+
+	// the stream token only grants access to the latest build
+	if rec := env.do("GET", "/myapp-1/download?token=stream-token", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the stream token to be refused for an older build but got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/app/myapp/latest/download?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a wrong stream token to be refused but got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/app/other/latest/download?token=stream-token", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for an unknown stream but got %d", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+//actions LOG_REDACT_FIELDS can take on a field of the request log
+const (
+	redactMask = "redact"
+	redactHash = "hash"
+	redactOmit = "omit"
+)
+
+//fields of the request log which are not query parameters or headers
+const (
+	clientIPField = "client_ip"
+	buildField    = "build"
+)
+
+var (
+	redactHashKey     []byte
+	redactHashKeyOnce sync.Once
+)
+
+//logRedactRules reads LOG_REDACT_FIELDS, a comma separated list of the fields to hide in the request log, each
+//optionally followed by =redact (the default), =hash or =omit, e.g. "client_ip=hash,build=omit,user-agent". A field is
+//a query parameter, a request header, client_ip or build. The token and credential headers are always redacted, they
+//can be omitted but not hashed. An unknown action redacts the field
+func logRedactRules() map[string]string {
+	rules := map[string]string{}
+	for _, name := range append(append([]string{}, redactedParams...), redactedHeaders...) {
+		rules[strings.ToLower(name)] = redactMask
+	}
+	for _, rule := range splitList(os.Getenv("LOG_REDACT_FIELDS")) {
+		name, action := rule, redactMask
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, action = strings.TrimSpace(rule[:i]), strings.TrimSpace(rule[i+1:])
+		}
+		name = strings.ToLower(name)
+		switch action {
+		case redactMask, redactHash, redactOmit:
+		default:
+			log.Printf("unknown LOG_REDACT_FIELDS action %q for %s, redacting it", action, name)
+			action = redactMask
+		}
+		if action == redactHash && alwaysRedacted(name) {
+			//a hash of a token could be checked against guesses
+			continue
+		}
+		rules[name] = action
+	}
+	return rules
+}
+
+func alwaysRedacted(name string) bool {
+	for _, sensitive := range append(append([]string{}, redactedParams...), redactedHeaders...) {
+		if strings.EqualFold(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+//redactField applies the rule for the field to its value. It is false when the field is to be left out of the log
+func redactField(rules map[string]string, name string, value string) (string, bool) {
+	switch rules[strings.ToLower(name)] {
+	case redactMask:
+		return "[redacted]", true
+	case redactHash:
+		return hashField(value), true
+	case redactOmit:
+		return "", false
+	}
+	return value, true
+}
+
+//hashField returns a keyed hash of value, so requests from the same client or for the same build can be correlated
+//without logging them. The key is LOG_REDACT_HASH_KEY, replicas sharing it log the same hashes. Without it a random
+//key is used, which only correlates within the process, as unkeyed hashes of ip addresses are easily reversed
+func hashField(value string) string {
+	redactHashKeyOnce.Do(func() {
+		if key := os.Getenv("LOG_REDACT_HASH_KEY"); key != "" {
+			redactHashKey = []byte(key)
+			return
+		}
+		redactHashKey = make([]byte, 32)
+		if _, err := rand.Read(redactHashKey); err != nil {
+			log.Printf("error generating a log redaction hash key: %s", err.Error())
+		}
+	})
+	mac := hmac.New(sha256.New, redactHashKey)
+	mac.Write([]byte(value))
+	return "hash:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
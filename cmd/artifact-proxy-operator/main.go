@@ -1,24 +1,45 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/aerogear/artifact-proxy-operator/pkg/budget"
+	"github.com/aerogear/artifact-proxy-operator/pkg/cache"
+	"github.com/aerogear/artifact-proxy-operator/pkg/checksum"
 	"github.com/aerogear/artifact-proxy-operator/pkg/jenkins"
+	"github.com/aerogear/artifact-proxy-operator/pkg/links"
 	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
 	"github.com/aerogear/artifact-proxy-operator/pkg/plist"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+const (
+	defaultNotReadyRetryAfter = 30
+	//binaryContentType is used for the apk and ipa types the proxy knows about
+	binaryContentType = "octet/stream"
 )
 
 var osClient *openshift.OpenShiftClient
 var jenkinsClient *jenkins.JenkinsClient
 
+//artifactCache is nil when caching is disabled
+var artifactCache *cache.DiskCache
+
 func main() {
 	var err error
 	jenkinsClient = jenkins.NewJenkinsClient()
@@ -26,103 +47,506 @@ func main() {
 	if err != nil {
 		log.Fatal("error instantiating OpenShiftClient - error " + err.Error())
 	}
+	downloadUrlTemplate, err = parseDownloadUrlTemplate(os.Getenv("DOWNLOAD_URL_TEMPLATE"))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	sessions, err = newSessionStore()
+	if err != nil {
+		log.Fatal("error instantiating session store - error " + err.Error())
+	}
+	if dir := os.Getenv("ARTIFACT_CACHE_DIR"); dir != "" {
+		artifactCache, err = cache.NewDiskCache(dir)
+		if err != nil {
+			log.Fatal("error instantiating artifact cache - error " + err.Error())
+		}
+		if max := os.Getenv("ARTIFACT_CACHE_MAX_BYTES"); max != "" {
+			maxBytes, err := strconv.ParseInt(max, 10, 64)
+			if err != nil || maxBytes < 0 {
+				log.Fatal("invalid ARTIFACT_CACHE_MAX_BYTES " + max)
+			}
+			artifactCache.SetMaxBytes(maxBytes)
+		}
+	}
+	registerMetrics()
+	if file := operatorHostFile(); file != "" {
+		go watchOperatorHostFile(file, nil)
+	}
+	if probes := sourceProbes(); len(probes) > 0 {
+		go watchSources(probes, nil)
+	}
+	osClient.Observed = observeBuild
 	go osClient.WatchBuilds()
+	awaitSync(osClient.Synced())
 	serveHttp()
 }
 
+//observeBuild is called by the watcher with each tracked build which has a download url
+func observeBuild(build *apibuildv1.Build) {
+	if writeBuildStatus() {
+		publishBuildStatus(build)
+	}
+	queueChecksum(build)
+}
+
+//awaitSync blocks until the watcher has processed the existing builds when WAIT_FOR_CACHE_SYNC is set, so requests
+//are only accepted once they can be answered correctly. By default serving starts straight away for a fast startup
+func awaitSync(synced <-chan struct{}) {
+	if os.Getenv("WAIT_FOR_CACHE_SYNC") != "true" {
+		return
+	}
+	log.Printf("waiting for build watcher to sync before serving")
+	<-synced
+}
+
 func serveHttp() {
-	http.HandleFunc("/", handler)
-	listen := os.Getenv("ARTIFACT_PROXY_OPERATOR_SERVICE_PORT")
-	if len(listen) == 0 {
-		listen = ":8080"
+	listener, addr, err := newListener()
+	if err != nil {
+		log.Fatalf("error starting http server on %s, (%s)", addr, err.Error())
+	}
+	server := newServer(withServerHeader(newRouter()))
+	servers := []*http.Server{server}
+	if adminAddr := adminListenAddr(); adminAddr != "" {
+		adminListener, err := net.Listen("tcp", adminAddr)
+		if err != nil {
+			log.Fatalf("error starting admin http server on %s, (%s)", adminAddr, err.Error())
+		}
+		admin := newServer(withServerHeader(newAdminRouter()))
+		servers = append(servers, admin)
+		log.Printf("admin endpoints listening on %s", adminAddr)
+		go func() {
+			if err := admin.Serve(adminListener); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("error starting admin http server on %s, (%s)", adminAddr, err.Error())
+			}
+		}()
+	}
+	shutdownDone := make(chan struct{})
+	go shutdownOnSignal(notifyShutdown(), shutdownDone, servers...)
+	log.Printf("listening on %s", addr)
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile != "" || keyFile != "" {
+		server.TLSConfig, err = tlsConfig()
+		if err != nil {
+			log.Fatalf("invalid TLS configuration (%s)", err.Error())
+		}
+		err = server.ServeTLS(listener, certFile, keyFile)
 	} else {
-		listen = ":" + listen
+		err = server.Serve(listener)
 	}
-	err := http.ListenAndServe(listen, nil)
-	if err != nil {
-		log.Fatalf("error starting http server on %s, (%s)", listen, err.Error())
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatalf("error starting http server on %s, (%s)", addr, err.Error())
+	}
+	// Serve returns as soon as the shutdown starts, the downloads still streaming are waited for here
+	<-shutdownDone
+}
+
+//newRouter serves the downloads, and the operational endpoints too unless they have a listener of their own
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", logRequestsOnError(withGzip(route)))
+	if adminListenAddr() == "" {
+		registerOperationalRoutes(mux)
+	}
+	return mux
+}
+
+func route(rw http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		handleOptions(rw, r)
+		return
+	}
+	r = withRetryBudget(r)
+	r = withTrace(r)
+	if strictQuery() {
+		if unknown := unknownQueryParams(r.URL); len(unknown) > 0 {
+			httpError(rw, "unexpected query parameters "+strings.Join(unknown, ", "), http.StatusBadRequest)
+			return
+		}
+	}
+	r, ok := resolveLatestAlias(rw, r)
+	if !ok {
+		return
+	}
+	if isIndexPath(r.URL.Path) {
+		indexHandler(rw, r)
+		return
+	}
+	switch path.Base(r.URL.Path) {
+	case "prewarm":
+		prewarmHandler(rw, r)
+	case "rotate-token":
+		rotateTokenHandler(rw, r)
+	case "support-bundle":
+		supportBundleHandler(rw, r)
+	case "checksum":
+		checksumHandler(rw, r)
+	case "notes":
+		notesHandler(rw, r)
+	case "itms":
+		itmsHandler(rw, r)
+	case "mdm":
+		mdmHandler(rw, r)
+	case "validate":
+		validateHandler(rw, r)
+	case "status":
+		buildStatusHandler(rw, r)
+	case "cache":
+		cachePurgeHandler(rw, r)
+	case "universal":
+		universalHandler(rw, r)
+	default:
+		handler(rw, r)
 	}
-	fmt.Printf("listening on %s", listen)
 }
 
 func handler(rw http.ResponseWriter, r *http.Request) {
 	isValid, err := validateURLPath(r.URL)
 	if err != nil {
-		http.Error(rw, "error parsing request", http.StatusInternalServerError)
+		httpError(rw, "error parsing request", http.StatusInternalServerError)
 		return
 	}
 	if !isValid {
-		http.Error(rw, "bad request. route should be called with /<build-id>/download?token=eg-token", http.StatusBadRequest)
+		httpError(rw, "bad request. route should be called with /<build-id>/download?token=eg-token", http.StatusBadRequest)
+		return
+	}
+	if isAnonymousHead(r) {
+		handleAnonymousHead(rw, r)
 		return
 	}
 
-	token, err := parseToken(r.URL)
+	build, token, ok := lookupAuthorizedBuild(rw, r)
+	if !ok {
+		return
+	}
+	reason, err := downloadReason(r)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		httpError(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	auditDownload(r, build, reason)
+	if r, build, ok = awaitArtifact(rw, r, build); !ok {
 		return
 	}
 
-	splitPath := strings.Split(r.URL.Path, "/")
-	if len(splitPath) < 2 {
-		http.Error(rw, "unable to parse build name from path", http.StatusInternalServerError)
+	if tooManyRanges(r) {
+		httpError(rw, fmt.Sprintf("too many ranges requested, at most %d are allowed", maxRanges()), http.StatusRequestedRangeNotSatisfiable)
 		return
 	}
-	build, err := osClient.GetBuild(splitPath[1])
+
+	if requireCompletePhase() && osClient.GetBuildPhase(build) != apibuildv1.BuildPhaseComplete {
+		rw.Header().Set("Retry-After", strconv.Itoa(notReadyRetryAfter(build)))
+		httpError(rw, fmt.Sprintf("build %s is not complete yet", build.Name), http.StatusConflict)
+		return
+	}
+
+	buildType, err := osClient.GetBuildTypeContext(r.Context(), build)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(rw, fmt.Sprintf("no resources found for build %s", splitPath[1]), http.StatusNotFound)
+		if budget.Exceeded(r.Context()) {
+			httpError(rw, "request budget exceeded", http.StatusGatewayTimeout)
 			return
 		}
-		http.Error(rw, fmt.Sprintf("error fetching build %s", build.Name), http.StatusInternalServerError)
+		httpError(rw, fmt.Sprintf("no build type found for build %s", build.Name), http.StatusBadRequest)
 		return
 	}
+	buildType = resolveBuildType(build.Name, buildType)
 
-	tokenAnnotationVal, ok := build.Annotations[osClient.GetTokenConst()]
-	if tokenAnnotationVal != token || !ok {
-		http.Error(rw, fmt.Sprintf("invalid token provided for build %s", build.Name), http.StatusForbidden)
+	cacheKey := build.Name
+	platform := ""
+	artifactUrl, ok := buildArtifactUrl(build)
+	if isUniversalBuildType(buildType) {
+		// universal builds carry an artifact per platform, the link chosen on the universal landing page says which
+		platform = r.URL.Query().Get("platform")
+		artifactUrl, ok = platformArtifactUrl(build, platform)
+		if !ok {
+			httpError(rw, fmt.Sprintf("no %s artifact for build %s", platform, build.Name), http.StatusNotFound)
+			return
+		}
+		buildType, cacheKey = platform, build.Name+"."+platform
+	}
+	if buildTypeDisabled(buildType) {
+		log.Printf("refusing download of build %s, %s builds are disabled", build.Name, buildType)
+		disabledRequestsTotal.Inc(buildType)
+		httpError(rw, fmt.Sprintf("serving %s builds is disabled", buildType), http.StatusForbidden)
 		return
 	}
-
-	artifactUrl, ok := build.Annotations[osClient.GetDownloadConst()]
-	if !ok || artifactUrl == "" {
-		http.Error(rw, "missing annotation on build object", http.StatusInternalServerError)
+	if !ok && downloadUrlTemplate != nil {
+		httpError(rw, "missing annotation on build object", http.StatusInternalServerError)
+		return
+	}
+	if artifactUrl == "" {
+		refuseMissingArtifact(rw, build)
+		return
+	}
+	if err := checkArtifactUrl(artifactUrl); err != nil {
+		log.Printf("malformed download url %q on build %s: %s", redactRawUrl(artifactUrl), build.Name, err.Error())
+		httpError(rw, fmt.Sprintf("malformed download url annotation on build %s", build.Name), http.StatusInternalServerError)
+		return
+	}
+	if refuseExtension(rw, build.Name, artifactUrl) {
 		return
 	}
 
-	buildType, err := osClient.GetBuildType(build)
+	disposition, err := downloadDisposition(r, buildType)
 	if err != nil {
-		http.Error(rw, fmt.Sprintf("no build type found for build %s", build), http.StatusBadRequest)
+		httpError(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
+
+	checksum := build.Annotations[openshift.Checksum]
+	if checksum == "" {
+		checksum, _ = precomputed.get(build.Name, artifactUrl)
+	}
+	noCache, conditions, ctx := isNoCache(build), conditionalHeaders(r), r.Context()
+	metadata, app := buildMetadataHeaders(build, buildType), build.Annotations[openshift.App]
 	switch buildType {
 	case "android":
-		handleBinaryResponse(rw, artifactUrl, fmt.Sprintf("%s.apk", build.Name))
+		if androidLandingEnabled() && !isArtifactRequest(r.URL) {
+			serveLanding(rw, plist.LandingPage{Build: build.Name, BuildType: "android", DownloadUrl: linkFromUrl(r.URL).Artifact(), ReleaseNotes: releaseNotes(build)})
+			return
+		}
+		if !withinDownloadLimit(rw, r, build) {
+			return
+		}
+		handleBinaryResponse(rw, artifact{
+			build:       build.Name,
+			namespace:   build.Namespace,
+			app:         app,
+			cacheKey:    cacheKey,
+			url:         artifactUrl,
+			filename:    fmt.Sprintf("%s.apk", build.Name),
+			contentType: binaryContentType,
+			checksum:    checksum,
+			noCache:     noCache,
+			conditions:  conditions,
+			metadata:    metadata,
+			disposition: disposition,
+			cacheMode:   requestCacheMode(r),
+			http10:      !r.ProtoAtLeast(1, 1),
+			ctx:         ctx,
+		})
 		return
 	case "ios":
+		variantName := r.URL.Query().Get("variant")
+		variant, ok := resolveVariant(build, variantName)
+		if !ok {
+			httpError(rw, fmt.Sprintf("unknown variant %s for build %s", variantName, build.Name), http.StatusNotFound)
+			return
+		}
+		if variantName == "" {
+			variant.artifactUrl, variant.cacheKey, variant.checksum = artifactUrl, cacheKey, checksum
+		} else if refuseExtension(rw, build.Name, variant.artifactUrl) {
+			return
+		}
+		if requireBundleIdentifier() && !validBundleIdentifier(variant.bundleIdentifier) && !isArtifactRequest(r.URL) {
+			handleMisconfiguredBundle(rw, r, build.Name)
+			return
+		}
 		if isArtifactRequest(r.URL) {
-			handleBinaryResponse(rw, artifactUrl, fmt.Sprintf("%s.ipa", build.Name))
+			if !withinDownloadLimit(rw, r, build) {
+				return
+			}
+			handleBinaryResponse(rw, artifact{
+				build:       build.Name,
+				namespace:   build.Namespace,
+				app:         app,
+				cacheKey:    variant.cacheKey,
+				url:         variant.artifactUrl,
+				filename:    fmt.Sprintf("%s.ipa", build.Name),
+				contentType: binaryContentType,
+				checksum:    variant.checksum,
+				noCache:     noCache,
+				conditions:  conditions,
+				metadata:    metadata,
+				disposition: disposition,
+				cacheMode:   requestCacheMode(r),
+				http10:      !r.ProtoAtLeast(1, 1),
+				ctx:         ctx,
+			})
 			return
 		}
 		if isPlistRequest(r.URL) {
-			xmlResp := plist.ProduceXML(osClient.GenerateArtifactUrl(build.Name, token, true), build.Name)
+			link := links.Link{Host: osClient.GetOperatorHost(), Build: build.Name, Token: token, Params: url.Values{}}
+			if token == "" && hasTokenSignature(r) {
+				// iOS fetches the ipa without the landing page's cookie, the signature carries on in its place
+				link.Params.Set(tokenSignatureParam, r.URL.Query().Get(tokenSignatureParam))
+			}
+			if variantName != "" {
+				link.Params.Set("variant", variantName)
+			}
+			if platform != "" {
+				link.Params.Set("platform", platform)
+			}
+			if reason != "" {
+				// iOS fetches the ipa without the header, so the reason goes in the url
+				link.Params.Set("reason", reason)
+			}
+			if validateIpa() {
+				ipa := artifact{build: build.Name, cacheKey: variant.cacheKey, url: variant.artifactUrl, checksum: variant.checksum, noCache: noCache, ctx: ctx}
+				if err := checkIpa(ipa); err != nil {
+					log.Printf("not serving the install manifest of build %s, its ipa looks invalid: %s", build.Name, err.Error())
+					httpError(rw, fmt.Sprintf("the ipa of build %s can not be installed, %s. Check the build exports a signed ipa", build.Name, err.Error()), http.StatusConflict)
+					return
+				}
+			}
+			ipaUrl := link.IosArtifact()
+			if err := plist.ValidateManifestUrl(ipaUrl); err != nil {
+				log.Printf("not serving the install manifest of build %s: %s", build.Name, err.Error())
+				httpError(rw, "unable to generate a valid install manifest, check the operator hostname", http.StatusInternalServerError)
+				return
+			}
+			xmlResp := plist.ProduceManifest(ipaUrl, manifestMetadata(build, variant))
 			rw.Header().Set("content-type", "application/xml")
 			rw.Write([]byte(xmlResp))
 			return
 		}
-		htmlResp := plist.ProduceHTML(encodeItmsUrl(r.URL))
-		rw.Header().Set("content-type", "text/html")
-		rw.Write([]byte(htmlResp))
+		landing := r.URL
+		if tokenCookiesEnabled() && token != "" {
+			// later hops authenticate with the cookie or, as iOS fetches the manifest and ipa without it, a short
+			// lived signature in place of the token in their urls
+			setTokenCookie(rw, build)
+			signed := *r.URL
+			query := signed.Query()
+			query.Del("token")
+			query.Set(tokenSignatureParam, tokenSignature(build))
+			signed.RawQuery = query.Encode()
+			landing = &signed
+		}
+		link := linkFromUrl(landing)
+		serveLanding(rw, plist.LandingPage{
+			Build:           build.Name,
+			BuildType:       "ios",
+			DownloadUrl:     link.Artifact(),
+			ManifestUrl:     link.IosManifest(),
+			ItmsServicesUrl: template.URL(link.ItmsServices()),
+			ReleaseNotes:    releaseNotes(build),
+		})
+	case "web", "generic":
+		// an empty content type is sniffed from the artifact itself
+		a := artifact{
+			build:       build.Name,
+			namespace:   build.Namespace,
+			app:         app,
+			cacheKey:    build.Name,
+			url:         artifactUrl,
+			filename:    withExtension(artifactFilename(build.Name, artifactUrl), build.Annotations[openshift.ContentType]),
+			contentType: build.Annotations[openshift.ContentType],
+			checksum:    checksum,
+			noCache:     noCache,
+			conditions:  conditions,
+			metadata:    metadata,
+			disposition: disposition,
+			cacheMode:   requestCacheMode(r),
+			http10:      !r.ProtoAtLeast(1, 1),
+			ctx:         ctx,
+		}
+		if !withinDownloadLimit(rw, r, build) {
+			return
+		}
+		if entry := r.URL.Query().Get("entry"); entry != "" {
+			handleZipEntry(rw, a, entry)
+			return
+		}
+		handleBinaryResponse(rw, a)
 	default:
-		http.Error(rw, fmt.Sprintf("invalid build type found for build %s", build), http.StatusBadRequest)
+		handleUnservedBuildType(rw, build.Name, buildType)
 		return
 	}
 
 }
 
-func handleBinaryResponse(rw http.ResponseWriter, artifactUrl string, extension string) {
-	artifactStreamer, err := jenkinsClient.StreamArtifact(artifactUrl, osClient.AuthToken)
+//artifact describes a binary to stream back to the client
+type artifact struct {
+	//build is the name of the build the artifact belongs to
+	build    string
+	cacheKey string
+	//namespace of the build, used to label metrics
+	namespace string
+	//app is the artifact-proxy/app annotation of the build, used to label metrics when it is set
+	app string
+	url string
+	//filename is used unless Jenkins gives the artifact a name of its own
+	filename string
+	//contentType is sniffed from the stream when empty
+	contentType string
+	//checksum is the expected digest from the build annotations, if any
+	checksum string
+	//noCache streams the artifact fresh from Jenkins every time, leaving the cache untouched
+	noCache bool
+	//conditions are the client's conditional request headers, passed on to Jenkins for noCache artifacts
+	conditions http.Header
+	//metadata headers describing the build are added to the response
+	metadata http.Header
+	//disposition is the Content-Disposition type asked for, it is only inline when the content type is safe to show
+	disposition string
+	//cacheMode is how a trusted client asked for the cache to be used, the default when empty
+	cacheMode string
+	//http10 is set for HTTP/1.0 requests, whose clients can not take a chunked body
+	http10 bool
+	//ctx is the context of the request, the background context when it is nil
+	ctx context.Context
+}
+
+func (a artifact) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+//expectedChecksum parses the checksum the artifact is verified against, nil when it has none
+func (a artifact) expectedChecksum() (*checksum.Checksum, error) {
+	if a.checksum == "" {
+		return nil, nil
+	}
+	return checksum.Parse(a.checksum)
+}
+
+func handleBinaryResponse(rw http.ResponseWriter, a artifact) {
+	started := time.Now()
+	// tracked from the start, so a shutdown also waits for artifacts still being opened or buffered
+	defer activeStreams.track()()
+	if isS3Location(a.url) {
+		handleS3Redirect(rw, a)
+		return
+	}
+	expected, err := a.expectedChecksum()
 	if err != nil {
-		http.Error(rw, "error when streaming atifact", http.StatusInternalServerError)
+		httpError(rw, "invalid checksum annotation on build object", http.StatusInternalServerError)
+		return
+	}
+	artifactStreamer, err := openArtifact(a, expected)
+	if err != nil {
+		recordDownload(a, 0, err)
+		if budget.Exceeded(a.context()) {
+			httpError(rw, "request budget exceeded", http.StatusGatewayTimeout)
+			return
+		}
+		if err == jenkins.ErrTooManyConnections {
+			rw.Header().Set("Retry-After", "5")
+			httpError(rw, "too many downloads from Jenkins in progress, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		if err == errNotCached {
+			httpError(rw, "artifact is not cached", http.StatusGatewayTimeout)
+			return
+		}
+		if err == jenkins.ErrTooManyRedirects {
+			log.Printf("download of artifact %s exceeded the redirect limit, check where Jenkins redirects it", a.cacheKey)
+			httpError(rw, "too many redirects fetching the artifact", http.StatusBadGateway)
+			return
+		}
+		httpError(rw, "error when streaming atifact", http.StatusInternalServerError)
+		return
+	}
+	if artifactStreamer.ETag != "" {
+		rw.Header().Set("ETag", artifactStreamer.ETag)
+	}
+	if artifactStreamer.LastModified != "" {
+		rw.Header().Set("Last-Modified", artifactStreamer.LastModified)
+	}
+	if artifactStreamer.NotModified {
+		artifactStreamer.Close()
+		rw.WriteHeader(http.StatusNotModified)
 		return
 	}
 	defer func() {
@@ -130,40 +554,194 @@ func handleBinaryResponse(rw http.ResponseWriter, artifactUrl string, extension
 			fmt.Printf("error. failed to close file handle. could be leaking resources %s", err)
 		}
 	}()
-	rw.Header().Set("content-type", "octet/stream")
-	rw.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=\"%s\"", extension))
-	if _, err := io.Copy(rw, artifactStreamer); err != nil {
+	var body io.Reader = artifactStreamer
+	contentType := a.contentType
+	if contentType == "" {
+		contentType, body, err = sniffContentType(artifactStreamer)
+		if err != nil {
+			recordDownload(a, 0, err)
+			httpError(rw, "error when streaming atifact", http.StatusInternalServerError)
+			return
+		}
+	}
+	rw.Header().Set("content-type", contentType)
+	for k, v := range a.metadata {
+		rw.Header()[k] = v
+	}
+	filename := a.filename
+	if artifactStreamer.Filename != "" {
+		filename = artifactStreamer.Filename
+	}
+	disposition := safeDisposition(a.disposition, contentType)
+	if disposition == "inline" {
+		rw.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	rw.Header().Set("content-disposition", contentDisposition(disposition, filename))
+	if a.http10 {
+		legacyBody, release, err := prepareHttp10Body(rw, body)
+		if err != nil {
+			recordDownload(a, 0, err)
+			log.Printf("error buffering artifact %s for an HTTP/1.0 client: %s", a.cacheKey, err.Error())
+			httpError(rw, "error when streaming atifact", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		body = legacyBody
+	}
+	out, clearDeadline := withIdleTimeout(rw)
+	defer clearDeadline()
+	written, err := io.Copy(out, body)
+	recordDownload(a, written, err)
+	if err == nil {
+		observeDownloadDuration(a.context(), a.namespace, started)
+	}
+	if err != nil {
+		if err == checksum.ErrMismatch {
+			// the body has already been sent, abort so the client does not treat it as a complete download
+			log.Printf("artifact %s did not match its checksum %s, aborting download", a.cacheKey, a.checksum)
+			panic(http.ErrAbortHandler)
+		}
 		fmt.Println("error writing download of application binary")
 		return
 	}
 }
 
+//sniffContentType peeks at the start of the stream to detect its content type. The returned reader still yields the
+//whole stream, including the peeked bytes
+func sniffContentType(stream io.Reader) (string, io.Reader, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(stream, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), stream), nil
+}
+
+//artifactFilename names a download after the artifact in Jenkins, falling back to the build name
+func artifactFilename(buildName string, artifactUrl string) string {
+	if u, err := url.Parse(artifactUrl); err == nil {
+		if name := path.Base(u.Path); name != "/" && name != "." {
+			return name
+		}
+	}
+	return buildName
+}
+
+//openArtifact returns the cached artifact for a build when there is one, otherwise it streams it from Jenkins and
+//fills the cache on the way through. When a checksum is given the stream is verified against it, and an artifact which
+//does not match is never cached. Artifacts marked noCache skip the cache altogether and are requested from Jenkins
+//with the client's conditional headers, so the stream may come back NotModified. The cacheMode of a trusted client can
+//refresh or bypass the cached copy, or insist on it
+func openArtifact(a artifact, expected *checksum.Checksum) (*jenkins.ArtifactStream, error) {
+	useCache := artifactCache != nil && !a.noCache && a.cacheMode != cacheBypass
+	if useCache && a.cacheMode != cacheRefresh {
+		if cached, ok := artifactCache.Open(a.cacheKey); ok {
+			return &jenkins.ArtifactStream{ReadCloser: verified(cached, expected), Filename: artifactCache.Filename(a.cacheKey)}, nil
+		}
+	}
+	if a.cacheMode == cacheOnlyIfCached {
+		return nil, errNotCached
+	}
+	var conditions http.Header
+	if a.noCache {
+		conditions = a.conditions
+	}
+	upstream, err := source.Stream(a.context(), a.url, conditions)
+	if err != nil {
+		return nil, err
+	}
+	if upstream.NotModified {
+		return upstream, nil
+	}
+	upstream.ReadCloser = verified(upstream.ReadCloser, expected)
+	if useCache {
+		upstream.ReadCloser = artifactCache.FillNamed(a.cacheKey, upstream.Filename, upstream.ReadCloser)
+	}
+	return upstream, nil
+}
+
+func verified(stream io.ReadCloser, expected *checksum.Checksum) io.ReadCloser {
+	if expected == nil {
+		return stream
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{expected.Verify(stream), stream}
+}
+
+//encodeItmsUrl returns the manifest URL for the landing page request, passing along its query parameters
 func encodeItmsUrl(toEncode *url.URL) string {
-	var directTo *url.URL
-	directTo, _ = url.Parse("https://" + os.Getenv("OPERATOR_HOSTNAME"))
-	directTo.Path = toEncode.Path
+	return linkFromUrl(toEncode).IosManifest()
+}
+
+//linkFromUrl describes the build a landing page request is for, passing along its query parameters
+func linkFromUrl(u *url.URL) links.Link {
+	buildName, _ := buildNameFromPath(u.Path)
 	params := url.Values{}
-	for k, v := range toEncode.Query() {
-		params.Add(k, v[0])
+	for k, v := range u.Query() {
+		params.Set(k, v[0])
 	}
-	params.Add("plist", "true")
-	directTo.RawQuery = params.Encode()
-	return directTo.String()
+	token := params.Get("token")
+	params.Del("token")
+	return links.Link{Host: osClient.GetOperatorHost(), Build: buildName, Token: token, Params: params}
 }
 
+//parseToken returns the token query parameter. Repeating the parameter is rejected rather than picking one of the
+//values, as it is ambiguous which one the client meant
 func parseToken(url *url.URL) (string, error) {
 	token, ok := url.Query()["token"]
 
-	if !ok || len(token) != 1 {
+	if !ok || len(token) == 0 {
 		return "", errors.New("invalid request, missing token")
 	}
+	if len(token) > 1 {
+		return "", errors.New("invalid request, token parameter provided more than once")
+	}
 	return token[0], nil
 }
 
+func buildNameFromPath(urlPath string) (string, error) {
+	splitPath := strings.Split(urlPath, "/")
+	if len(splitPath) < 2 || splitPath[1] == "" {
+		return "", errors.New("unable to parse build name from path")
+	}
+	return splitPath[1], nil
+}
+
 func validateURLPath(url *url.URL) (bool, error) {
 	return regexp.MatchString("/.*/download", url.Path)
 }
 
+//buildTypeDisabled reports whether downloads of the build type are turned off with DISABLED_BUILD_TYPES, a comma
+//separated list of build types, e.g. to stop serving ios builds while keeping android
+func buildTypeDisabled(buildType string) bool {
+	for _, disabled := range splitList(os.Getenv("DISABLED_BUILD_TYPES")) {
+		if disabled == buildType {
+			return true
+		}
+	}
+	return false
+}
+
+func requireCompletePhase() bool {
+	return os.Getenv("REQUIRE_COMPLETE_PHASE") == "true"
+}
+
+//notReadyRetryAfter returns the number of seconds a client should wait before asking for an incomplete build again.
+//The estimate from previous build durations is best effort, when there is none NOT_READY_RETRY_AFTER_SECONDS is used
+func notReadyRetryAfter(build *apibuildv1.Build) int {
+	seconds := defaultNotReadyRetryAfter
+	if configured, err := strconv.Atoi(os.Getenv("NOT_READY_RETRY_AFTER_SECONDS")); err == nil && configured > 0 {
+		seconds = configured
+	}
+	if remaining, ok := osClient.EstimateRemainingBuildTime(build); ok {
+		seconds = int((remaining + time.Second - 1) / time.Second)
+	}
+	return seconds
+}
+
 func isArtifactRequest(url *url.URL) bool {
 	return url.Query().Get("artifact") == "true"
 }
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/cache"
+	"github.com/aerogear/artifact-proxy-operator/pkg/jenkins"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	testNamespace = "test"
+	testToken     = "test-token"
+	testArtifact  = "artifact-content"
+)
+
+//testEnv fakes the OpenShift build API and Jenkins so the handler can be exercised end to end
+type testEnv struct {
+	t            *testing.T
+	api          *httptest.Server
+	jenkins      *httptest.Server
+	lock         sync.Mutex
+	artifacts    map[string][]byte
+	builds       map[string]*apibuildv1.Build
+	buildConfigs map[string]*apibuildv1.BuildConfig
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	env := &testEnv{
+		t:            t,
+		artifacts:    map[string][]byte{},
+		builds:       map[string]*apibuildv1.Build{},
+		buildConfigs: map[string]*apibuildv1.BuildConfig{},
+	}
+	env.api = httptest.NewServer(http.HandlerFunc(env.serveAPI))
+	env.jenkins = httptest.NewServer(http.HandlerFunc(env.serveJenkins))
+	jenkinsClient = jenkins.NewJenkinsClient()
+	source = jenkinsSource{}
+	var err error
+	osClient, err = openshift.NewOpenShiftClientForConfig(jenkinsClient, &rest.Config{Host: env.api.URL}, "auth-token", testNamespace, "proxy.example.com")
+	if err != nil {
+		t.Fatal("error creating test OpenShift client " + err.Error())
+	}
+	return env
+}
+
+func (e *testEnv) close() {
+	e.api.Close()
+	e.jenkins.Close()
+}
+
+//addBuild registers a build of the given type with a valid token and download url, extra annotations override the defaults
+func (e *testEnv) addBuild(name string, buildType string, annotations map[string]string) *apibuildv1.Build {
+	build := &apibuildv1.Build{
+		TypeMeta: metav1.TypeMeta{Kind: "Build", APIVersion: "build.openshift.io/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Annotations: map[string]string{
+				openshift.BuildConfig:           name,
+				openshift.ArtifactDownloadToken: testToken,
+				openshift.JenkinsArtifactUri:    e.jenkins.URL + "/artifact/" + name,
+			},
+		},
+	}
+	for k, v := range annotations {
+		build.Annotations[k] = v
+	}
+	bc := &apibuildv1.BuildConfig{
+		TypeMeta: metav1.TypeMeta{Kind: "BuildConfig", APIVersion: "build.openshift.io/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Labels:    map[string]string{openshift.BuildType: buildType},
+		},
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.builds[name] = build
+	e.buildConfigs[name] = bc
+	return build
+}
+
+//setArtifact serves content from Jenkins at path instead of testArtifact
+func (e *testEnv) setArtifact(path string, content []byte) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.artifacts[path] = content
+}
+
+func (e *testEnv) serveJenkins(rw http.ResponseWriter, r *http.Request) {
+	e.lock.Lock()
+	content, ok := e.artifacts[r.URL.Path]
+	e.lock.Unlock()
+	if !ok {
+		content = []byte(testArtifact)
+	}
+	rw.Write(content)
+}
+
+func (e *testEnv) serveAPI(rw http.ResponseWriter, r *http.Request) {
+	prefix := "/apis/build.openshift.io/v1/namespaces/" + testNamespace + "/"
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if !strings.HasPrefix(r.URL.Path, prefix) || len(parts) != 2 {
+		http.NotFound(rw, r)
+		return
+	}
+	if r.Method == http.MethodPut && parts[0] == "builds" {
+		e.updateBuild(rw, r, parts[1])
+		return
+	}
+	e.lock.Lock()
+	var obj interface{}
+	switch parts[0] {
+	case "builds":
+		if b, ok := e.builds[parts[1]]; ok {
+			obj = b
+		}
+	case "buildconfigs":
+		if bc, ok := e.buildConfigs[parts[1]]; ok {
+			obj = bc
+		}
+	}
+	e.lock.Unlock()
+	rw.Header().Set("content-type", "application/json")
+	if obj == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(rw, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404,"message":"%s \"%s\" not found"}`, parts[0], parts[1])
+		return
+	}
+	json.NewEncoder(rw).Encode(obj)
+}
+
+//updateBuild stores a build PUT by the client, as the API server would
+func (e *testEnv) updateBuild(rw http.ResponseWriter, r *http.Request, name string) {
+	build := &apibuildv1.Build{}
+	if err := json.NewDecoder(r.Body).Decode(build); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	build.TypeMeta = metav1.TypeMeta{Kind: "Build", APIVersion: "build.openshift.io/v1"}
+	e.lock.Lock()
+	e.builds[name] = build
+	e.lock.Unlock()
+	rw.Header().Set("content-type", "application/json")
+	json.NewEncoder(rw).Encode(build)
+}
+
+//do runs a request through the handler, header values are set on the request before it is served
+func (e *testEnv) do(method string, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	return rec
+}
+
+//enableCache turns on the artifact cache in a temporary directory, the returned func disables it again
+func enableCache(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "artifact-cache")
+	if err != nil {
+		t.Fatal("error creating cache dir " + err.Error())
+	}
+	artifactCache, err = cache.NewDiskCache(dir)
+	if err != nil {
+		t.Fatal("error creating cache " + err.Error())
+	}
+	return func() {
+		artifactCache = nil
+		os.RemoveAll(dir)
+	}
+}
+
+//setEnv sets an environment variable for the duration of a test, the returned func restores the old value
+func setEnv(key string, value string) func() {
+	old, existed := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if existed {
+			os.Setenv(key, old)
+			return
+		}
+		os.Unsetenv(key)
+	}
+}
+
+func TestHandlerAndroidDownload(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if rec.Body.String() != testArtifact {
+		t.Fatalf("expected artifact body %q but got %q", testArtifact, rec.Body.String())
+	}
+
+	rec = env.do("GET", "/android-1/download?token=wrong", nil)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d but got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestHandlerRequireCompletePhase(t *testing.T) {
+	defer setEnv("REQUIRE_COMPLETE_PHASE", "true")()
+	defer setEnv("NOT_READY_RETRY_AFTER_SECONDS", "45")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("running", "android", nil).Status.Phase = apibuildv1.BuildPhaseRunning
+	env.addBuild("complete", "android", nil).Status.Phase = apibuildv1.BuildPhaseComplete
+	env.addBuild("new", "android", nil)
+
+	rec := env.do("GET", "/running/download?token="+testToken, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status %d but got %d", http.StatusConflict, rec.Code)
+	}
+	// a freshly created build without a status is not complete either
+	if rec := env.do("GET", "/new/download?token="+testToken, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for a build without a status but got %d", http.StatusConflict, rec.Code)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "45" {
+		t.Fatalf("expected Retry-After of 45 but got %q", retry)
+	}
+
+	rec = env.do("GET", "/complete/download?token="+testToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestHandlerFillsCache(t *testing.T) {
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rec.Code)
+	}
+	if !artifactCache.Has("android-1") {
+		t.Fatal("expected download to fill the cache")
+	}
+	env.jenkins.Close()
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+		t.Fatalf("expected cached download to be served without Jenkins, got status %d", rec.Code)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	cases := []struct {
+		query  string
+		token  string
+		errMsg string
+	}{
+		{"", "", "invalid request, missing token"},
+		{"token=a", "a", ""},
+		{"token=a&token=b", "", "invalid request, token parameter provided more than once"},
+	}
+	for _, tc := range cases {
+		token, err := parseToken(&url.URL{RawQuery: tc.query})
+		if tc.errMsg != "" {
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("query %q: expected error %q but got %v", tc.query, tc.errMsg, err)
+			}
+			continue
+		}
+		if err != nil || token != tc.token {
+			t.Errorf("query %q: expected token %q but got %q, %v", tc.query, tc.token, token, err)
+		}
+	}
+}
+
+func TestHandlerDuplicateToken(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	rec := env.do("GET", "/android-1/download?token="+testToken+"&token=other", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d but got %d", http.StatusBadRequest, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "more than once") {
+		t.Fatalf("expected duplicate token message but got %q", rec.Body.String())
+	}
+}
+
+func TestEncodeItmsUrl(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+
+	landing, _ := url.Parse("/ios-1/download?token=" + testToken + "&variant=enterprise")
+	expect := "https://proxy.example.com/ios-1/download?plist=true&token=" + testToken + "&variant=enterprise"
+	if got := encodeItmsUrl(landing); got != expect {
+		t.Fatalf("expected %s but got %s", expect, got)
+	}
+}
+
+func TestHandlerSniffsContentType(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	zip := append([]byte("PK\x03\x04"), bytes.Repeat([]byte{0}, 600)...)
+	env.setArtifact("/artifact/site.zip", zip)
+	env.addBuild("web-1", "web", map[string]string{openshift.JenkinsArtifactUri: env.jenkins.URL + "/artifact/site.zip"})
+	env.addBuild("web-2", "web", map[string]string{openshift.ContentType: "application/x-custom"})
+	env.addBuild("android-1", "android", nil)
+
+	rec := env.do("GET", "/web-1/download?token="+testToken, nil)
+	if ct := rec.Header().Get("content-type"); ct != "application/zip" {
+		t.Fatalf("expected sniffed content type application/zip but got %s", ct)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), zip) {
+		t.Fatal("expected the sniffed bytes to still be part of the body")
+	}
+	if cd := rec.Header().Get("content-disposition"); cd != `attachment; filename="site.zip"` {
+		t.Fatalf("unexpected content disposition %s", cd)
+	}
+
+	rec = env.do("GET", "/web-2/download?token="+testToken, nil)
+	if ct := rec.Header().Get("content-type"); ct != "application/x-custom" {
+		t.Fatalf("expected annotated content type but got %s", ct)
+	}
+
+	rec = env.do("GET", "/android-1/download?token="+testToken, nil)
+	if ct := rec.Header().Get("content-type"); ct != binaryContentType {
+		t.Fatalf("expected known type to keep content type %s but got %s", binaryContentType, ct)
+	}
+}
+
+func TestAwaitSync(t *testing.T) {
+	synced := make(chan struct{})
+	awaitSync(synced)
+
+	defer setEnv("WAIT_FOR_CACHE_SYNC", "true")()
+	serving := make(chan struct{})
+	go func() {
+		awaitSync(synced)
+		close(serving)
+	}()
+	select {
+	case <-serving:
+		t.Fatal("expected serving to wait for the watcher to sync")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(synced)
+	select {
+	case <-serving:
+	case <-time.After(time.Second):
+		t.Fatal("expected serving to start once the watcher synced")
+	}
+}
+
+func TestDisabledBuildTypes(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+	env.addBuild("android-1", "android", nil)
+	defer setEnv("DISABLED_BUILD_TYPES", "ios, web")()
+
+	before := disabledRequestsTotal.Value("ios")
+	rec := env.do("GET", "/ios-1/download?artifact=true&token="+testToken, nil)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "serving ios builds is disabled") {
+		t.Fatalf("expected a disabled ios build to be refused but got %d %q", rec.Code, rec.Body.String())
+	}
+	if disabledRequestsTotal.Value("ios") != before+1 {
+		t.Fatal("expected the refused download to be counted")
+	}
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected android builds to still be served but got status %d", rec.Code)
+	}
+}
+
+func TestHandlerUsesUpstreamFilename(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Disposition", `attachment; filename="app-release.apk"`)
+		rw.Write([]byte(testArtifact))
+	}))
+	defer upstream.Close()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("named", "android", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/artifact"})
+	env.addBuild("unnamed", "android", nil)
+	defer enableCache(t)()
+
+	// the second download of each is served from the cache
+	for i := 0; i < 2; i++ {
+		rec := env.do("GET", "/named/download?token="+testToken, nil)
+		if cd := rec.Header().Get("content-disposition"); cd != `attachment; filename="app-release.apk"` {
+			t.Fatalf("expected the filename from Jenkins on download %d but got %q", i+1, cd)
+		}
+		rec = env.do("GET", "/unnamed/download?token="+testToken, nil)
+		if cd := rec.Header().Get("content-disposition"); cd != `attachment; filename="unnamed.apk"` {
+			t.Fatalf("expected the synthesized filename on download %d but got %q", i+1, cd)
+		}
+	}
+	if stats := artifactCache.Stats(); stats.Hits != 2 {
+		t.Fatalf("expected the second downloads to be cache hits, got %+v", stats)
+	}
+}
+
+func TestHandlerJenkinsConnectionsExhausted(t *testing.T) {
+	defer setEnv("JENKINS_MAX_CONNECTIONS", "1")()
+	defer setEnv("JENKINS_CONNECTION_WAIT_MS", "0")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	held, err := jenkinsClient.StreamArtifact(env.jenkins.URL+"/artifact/android-1", "auth-token")
+	if err != nil {
+		t.Fatal("unexpected error streaming artifact " + err.Error())
+	}
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected status %d with Retry-After while Jenkins connections are exhausted but got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	held.Close()
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d once the connection is free but got %d", http.StatusOK, rec.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/links"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//mdmManifest describes an app to MDM systems enrolling it, unlike the install manifest which is only read by iOS
+type mdmManifest struct {
+	Identifier string `json:"identifier"`
+	Version    string `json:"version"`
+	Title      string `json:"title"`
+	Platform   string `json:"platform"`
+	InstallUrl string `json:"installUrl"`
+	IconUrl    string `json:"iconUrl,omitempty"`
+}
+
+//mdmHandler serves /<build>/mdm, the MDM manifest of an android or ios build as JSON. The identifier and version have
+//no defaults here, MDM systems key apps on them, so a build without them gets a 400 naming the missing annotations
+func mdmHandler(rw http.ResponseWriter, r *http.Request) {
+	build, token, ok := lookupAuthorizedBuild(rw, r)
+	if !ok {
+		return
+	}
+	buildType, err := osClient.GetBuildTypeContext(r.Context(), build)
+	if err != nil {
+		httpError(rw, fmt.Sprintf("no build type found for build %s", build.Name), http.StatusBadRequest)
+		return
+	}
+	buildType = resolveBuildType(build.Name, buildType)
+	if buildType != "android" && buildType != "ios" {
+		httpError(rw, fmt.Sprintf("build %s is not an android or ios build", build.Name), http.StatusBadRequest)
+		return
+	}
+	manifest := newMdmManifest(build, buildType, token)
+	if missing := missingMdmAnnotations(manifest); len(missing) > 0 {
+		httpError(rw, fmt.Sprintf("build %s is missing %s for an MDM manifest", build.Name, strings.Join(missing, ", ")), http.StatusBadRequest)
+		return
+	}
+	rw.Header().Set("content-type", "application/json")
+	json.NewEncoder(rw).Encode(manifest)
+}
+
+//newMdmManifest describes a build from the same annotations as its install manifest
+func newMdmManifest(build *apibuildv1.Build, buildType string, token string) mdmManifest {
+	title := build.Annotations[openshift.Title]
+	if title == "" {
+		title = build.Name
+	}
+	link := links.Link{Host: osClient.GetOperatorHost(), Build: build.Name, Token: token}
+	installUrl := link.Artifact()
+	if buildType == "ios" {
+		installUrl = link.ItmsServices()
+	}
+	return mdmManifest{
+		Identifier: build.Annotations[openshift.BundleIdentifier],
+		Version:    build.Annotations[openshift.BundleVersion],
+		Title:      title,
+		Platform:   buildType,
+		InstallUrl: installUrl,
+		IconUrl:    build.Annotations[openshift.IconUrl],
+	}
+}
+
+func missingMdmAnnotations(m mdmManifest) []string {
+	missing := []string{}
+	if m.Identifier == "" {
+		missing = append(missing, openshift.BundleIdentifier)
+	}
+	if m.Version == "" {
+		missing = append(missing, openshift.BundleVersion)
+	}
+	return missing
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestMdmManifest(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", map[string]string{
+		openshift.BundleIdentifier: "org.aerogear.app",
+		openshift.BundleVersion:    "2.1",
+		openshift.IconUrl:          "https://example.com/icon.png",
+	})
+	env.addBuild("android-1", "android", map[string]string{
+		openshift.BundleIdentifier: "org.aerogear.app",
+		openshift.BundleVersion:    "2.1",
+		openshift.Title:            "AeroGear App",
+	})
+
+	rec := env.do("GET", "/ios-1/mdm?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("content-type") != "application/json" {
+		t.Fatalf("expected a JSON manifest but got %d %q: %s", rec.Code, rec.Header().Get("content-type"), rec.Body.String())
+	}
+	var ios map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &ios); err != nil {
+		t.Fatal("expected valid JSON " + err.Error())
+	}
+	expected := map[string]string{
+		"identifier": "org.aerogear.app",
+		"version":    "2.1",
+		"title":      "ios-1",
+		"platform":   "ios",
+		"installUrl": "itms-services://?action=download-manifest&url=https%3A%2F%2Fproxy.example.com%2Fios-1%2Fdownload%3Fplist%3Dtrue%26token%3D" + testToken,
+		"iconUrl":    "https://example.com/icon.png",
+	}
+	if len(ios) != len(expected) {
+		t.Fatalf("expected the fields %v but got %v", expected, ios)
+	}
+	for k, v := range expected {
+		if ios[k] != v {
+			t.Errorf("expected %s to be %q but got %q", k, v, ios[k])
+		}
+	}
+
+	var android map[string]string
+	rec = env.do("GET", "/android-1/mdm?token="+testToken, nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &android); err != nil {
+		t.Fatal("expected valid JSON " + err.Error())
+	}
+	if android["installUrl"] != "https://proxy.example.com/android-1/download?artifact=true&token="+testToken || android["title"] != "AeroGear App" {
+		t.Fatalf("unexpected android manifest %v", android)
+	}
+	if _, ok := android["iconUrl"]; ok {
+		t.Fatal("expected no icon url for a build without one")
+	}
+
+	if rec := env.do("GET", "/ios-1/mdm?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a bad token to be refused, got status %d", rec.Code)
+	}
+}
+
+func TestMdmManifestRequiredFields(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+	env.addBuild("ios-2", "ios", map[string]string{openshift.BundleIdentifier: "org.aerogear.app"})
+	env.addBuild("web-1", "web", map[string]string{openshift.BundleIdentifier: "org.aerogear.app", openshift.BundleVersion: "2.1"})
+
+	rec := env.do("GET", "/ios-1/mdm?token="+testToken, nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), openshift.BundleIdentifier) || !strings.Contains(rec.Body.String(), openshift.BundleVersion) {
+		t.Fatalf("expected both missing annotations to be named but got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = env.do("GET", "/ios-2/mdm?token="+testToken, nil)
+	if rec.Code != http.StatusBadRequest || strings.Contains(rec.Body.String(), openshift.BundleIdentifier) || !strings.Contains(rec.Body.String(), openshift.BundleVersion) {
+		t.Fatalf("expected only the version to be named but got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := env.do("GET", "/web-1/mdm?token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a web build to be refused, got status %d", rec.Code)
+	}
+}
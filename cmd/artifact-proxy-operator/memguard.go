@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//cgroupMemoryFiles are the limit and usage files of the container's memory cgroup, for cgroup v2 and v1
+var cgroupMemoryFiles = [][2]string{
+	{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory.current"},
+	{"/sys/fs/cgroup/memory/memory.limit_in_bytes", "/sys/fs/cgroup/memory/memory.usage_in_bytes"},
+}
+
+//memoryAvailable reports how much memory the pod has left before its cgroup limit, false when there is no limit
+var memoryAvailable = cgroupMemoryAvailable
+
+func cgroupMemoryAvailable() (uint64, bool) {
+	for _, files := range cgroupMemoryFiles {
+		limit, ok := readCgroupValue(files[0])
+		if !ok {
+			continue
+		}
+		usage, ok := readCgroupValue(files[1])
+		if !ok {
+			continue
+		}
+		if usage >= limit {
+			return 0, true
+		}
+		return limit - usage, true
+	}
+	return 0, false
+}
+
+//readCgroupValue reads a byte count from a cgroup file. v2 writes "max" and v1 a huge number when there is no limit
+func readCgroupValue(file string) (uint64, bool) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	val := strings.TrimSpace(string(raw))
+	if val == "max" {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(val, 10, 64)
+	if err != nil || n >= 1<<62 {
+		return 0, false
+	}
+	return n, true
+}
+
+//minAvailableMemory reads MIN_AVAILABLE_MEMORY_BYTES, the memory which must be left before a buffered fetch is
+//started. 0, the default, turns the guard off
+func minAvailableMemory() uint64 {
+	min, err := strconv.ParseUint(os.Getenv("MIN_AVAILABLE_MEMORY_BYTES"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return min
+}
+
+//lowOnMemory reports whether a fetch which buffers the artifact in memory should be refused
+func lowOnMemory() bool {
+	min := minAvailableMemory()
+	if min == 0 {
+		return false
+	}
+	available, limited := memoryAvailable()
+	if !limited || available >= min {
+		return false
+	}
+	log.Printf("refusing buffered fetch, only %d bytes of memory available", available)
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestLowMemoryRefusesBufferedFetch(t *testing.T) {
+	upstream := zipServer(t, map[string]string{"reports/index.html": "<h1>report</h1>"})
+	defer upstream.Close()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("web-1", "web", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/site.zip"})
+	available := uint64(10 << 20)
+	memoryAvailable = func() (uint64, bool) { return available, true }
+	defer func() { memoryAvailable = cgroupMemoryAvailable }()
+	defer setEnv("MIN_AVAILABLE_MEMORY_BYTES", "67108864")()
+
+	rec := env.do("GET", "/web-1/download?entry=reports/index.html&token="+testToken, nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected status %d with Retry-After under memory pressure but got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if rec := env.do("GET", "/web-1/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected streamed downloads not to be guarded, got status %d", rec.Code)
+	}
+	available = 128 << 20
+	if rec := env.do("GET", "/web-1/download?entry=reports/index.html&token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected the fetch to be accepted with enough memory, got status %d", rec.Code)
+	}
+}
+
+func TestReadCgroupValue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{"limited": "536870912\n", "v2-unlimited": "max\n", "v1-unlimited": "9223372036854771712\n"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+	}
+
+	if n, ok := readCgroupValue(filepath.Join(dir, "limited")); !ok || n != 536870912 {
+		t.Fatalf("expected a limit of 536870912 but got %d %v", n, ok)
+	}
+	for _, name := range []string{"v2-unlimited", "v1-unlimited", "missing"} {
+		if _, ok := readCgroupValue(filepath.Join(dir, name)); ok {
+			t.Errorf("expected %s to count as no limit", name)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/cache"
+	"github.com/aerogear/artifact-proxy-operator/pkg/metrics"
+)
+
+// metrics are only labelled by bounded values such as namespace or build type, build names are unbounded and must
+// never be used as a label
+var (
+	downloadsTotal = metrics.NewCounterVec("artifact_proxy_downloads_total",
+		"Artifact downloads completed.", "namespace")
+	downloadBytesTotal = metrics.NewCounterVec("artifact_proxy_download_bytes_total",
+		"Bytes of artifacts sent to clients.", "namespace")
+	downloadErrorsTotal = metrics.NewCounterVec("artifact_proxy_download_errors_total",
+		"Artifact downloads which failed.", "namespace")
+	disabledRequestsTotal = metrics.NewCounterVec("artifact_proxy_disabled_requests_total",
+		"Downloads refused because their build type is disabled.", "build_type")
+	unpublishedArtifactsTotal = metrics.NewCounterVec("artifact_proxy_unpublished_artifact_requests_total",
+		"Downloads refused because the completed build has no artifact published.", "namespace")
+	appDownloadsTotal = metrics.NewCounterVec("artifact_proxy_app_downloads_total",
+		"Artifact downloads completed, by the artifact-proxy/app annotation of the build.", "app")
+	appDownloadBytesTotal = metrics.NewCounterVec("artifact_proxy_app_download_bytes_total",
+		"Bytes of artifacts sent to clients, by the artifact-proxy/app annotation of the build.", "app")
+	downloadDurationSeconds = metrics.NewHistogramVec("artifact_proxy_download_duration_seconds",
+		"Time taken to send artifacts to clients.", []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300}, "namespace")
+)
+
+//registerMetrics adds the operator's metrics to the registry served on /metrics. It is safe to call more than once,
+//metrics which are already registered keep being used rather than failing
+func registerMetrics() {
+	downloadsTotal = registerCounter(downloadsTotal)
+	downloadBytesTotal = registerCounter(downloadBytesTotal)
+	downloadErrorsTotal = registerCounter(downloadErrorsTotal)
+	disabledRequestsTotal = registerCounter(disabledRequestsTotal)
+	unpublishedArtifactsTotal = registerCounter(unpublishedArtifactsTotal)
+	appDownloadsTotal = registerCounter(appDownloadsTotal)
+	appDownloadBytesTotal = registerCounter(appDownloadBytesTotal)
+	if existing, ok := register(downloadDurationSeconds).(*metrics.HistogramVec); ok {
+		downloadDurationSeconds = existing
+	}
+	if existing, ok := register(sourceReachable).(*metrics.GaugeVec); ok {
+		sourceReachable = existing
+	}
+	if artifactCache != nil {
+		for _, c := range cacheMetrics() {
+			register(c)
+		}
+	}
+	if jenkinsClient != nil {
+		register(metrics.NewGaugeFunc("artifact_proxy_jenkins_active_connections",
+			"Requests currently open to Jenkins, only tracked when JENKINS_MAX_CONNECTIONS is set.",
+			func() float64 { return float64(jenkinsClient.ActiveConnections()) }))
+	}
+	if osClient != nil {
+		register(metrics.NewCounterFunc("artifact_proxy_watch_events_coalesced_total",
+			"Build updates replaced by a later update of the same build before being handled.",
+			func() float64 { return float64(osClient.CoalescedEvents()) }))
+	}
+}
+
+//register adds c to the default registry, returning the collector already registered under its name if there is one
+func register(c metrics.Collector) metrics.Collector {
+	err := metrics.DefaultRegistry.Register(c)
+	if are, ok := err.(metrics.AlreadyRegisteredError); ok {
+		return are.Existing
+	}
+	if err != nil {
+		log.Printf("error registering metric %s: %v", c.Name(), err)
+	}
+	return c
+}
+
+func registerCounter(c *metrics.CounterVec) *metrics.CounterVec {
+	if existing, ok := register(c).(*metrics.CounterVec); ok {
+		return existing
+	}
+	log.Printf("metric %s is already registered as a different type", c.Name())
+	return c
+}
+
+//cacheMetrics reports the size and use of the artifact cache
+func cacheMetrics() []metrics.Collector {
+	stats := func() cache.Stats {
+		if artifactCache == nil {
+			return cache.Stats{}
+		}
+		return artifactCache.Stats()
+	}
+	return []metrics.Collector{
+		metrics.NewGaugeFunc("artifact_proxy_cache_size_bytes", "Bytes of artifacts in the cache.",
+			func() float64 { return float64(stats().Size) }),
+		metrics.NewGaugeFunc("artifact_proxy_cache_max_bytes", "Budget of the cache in bytes, 0 when unlimited.",
+			func() float64 { return float64(stats().MaxBytes) }),
+		metrics.NewCounterFunc("artifact_proxy_cache_hits_total", "Downloads served from the cache.",
+			func() float64 { return float64(stats().Hits) }),
+		metrics.NewCounterFunc("artifact_proxy_cache_misses_total", "Downloads not found in the cache.",
+			func() float64 { return float64(stats().Misses) }),
+		metrics.NewCounterFunc("artifact_proxy_cache_evictions_total", "Artifacts evicted to stay within the cache budget.",
+			func() float64 { return float64(stats().Evictions) }),
+	}
+}
+
+//recordDownload records a download of an artifact in the metrics and the attempts kept for support bundles, written
+//bytes were sent before any error
+func recordDownload(a artifact, written int64, err error) {
+	attempt := downloadAttempt{Time: time.Now(), build: a.build, CacheKey: a.cacheKey, Bytes: written}
+	if err != nil {
+		attempt.Error = sanitizeErrorMessage(err.Error())
+	}
+	downloadAttempts.record(attempt)
+	downloadBytesTotal.Add(float64(written), a.namespace)
+	app := appLabel(a.app)
+	if app != "" {
+		appDownloadBytesTotal.Add(float64(written), app)
+	}
+	if err != nil {
+		downloadErrorsTotal.Inc(a.namespace)
+		return
+	}
+	downloadsTotal.Inc(a.namespace)
+	if app != "" {
+		appDownloadsTotal.Inc(app)
+	}
+}
+
+//defaultMaxAppLabels caps the app label when APP_LABEL_MAX_VALUES is not set
+const defaultMaxAppLabels = 50
+
+var (
+	appLabelsOnce sync.Once
+	appLabels     *metrics.BoundedValues
+)
+
+//appLabel returns the app label for a build's artifact-proxy/app annotation. Only the first APP_LABEL_MAX_VALUES
+//apps get a label of their own, any more are counted together as __other__ so a typo in an annotation can not
+//flood Prometheus with series
+func appLabel(app string) string {
+	if app == "" {
+		return ""
+	}
+	appLabelsOnce.Do(func() {
+		max := defaultMaxAppLabels
+		if configured, err := strconv.Atoi(os.Getenv("APP_LABEL_MAX_VALUES")); err == nil && configured >= 0 {
+			max = configured
+		}
+		appLabels = metrics.NewBoundedValues(max)
+	})
+	return appLabels.Value(app)
+}
+
+//observeDownloadDuration records how long a completed download took. When exemplars are enabled and the request is
+//part of a sampled trace the observation links to it
+func observeDownloadDuration(ctx context.Context, namespace string, started time.Time) {
+	elapsed := time.Since(started).Seconds()
+	if traceID, ok := traceFromContext(ctx); ok && exemplarsEnabled() {
+		downloadDurationSeconds.ObserveWithExemplar(elapsed, metrics.Exemplar{"trace_id": traceID}, namespace)
+		return
+	}
+	downloadDurationSeconds.Observe(elapsed, namespace)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/metrics"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestDownloadMetricsLabelledByNamespace(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	// in single namespace mode every download carries the same namespace
+	before := downloadsTotal.Value(testNamespace)
+	bytesBefore := downloadBytesTotal.Value(testNamespace)
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	if downloadsTotal.Value(testNamespace) != before+1 {
+		t.Fatalf("expected a download to be recorded for namespace %s", testNamespace)
+	}
+	if downloadBytesTotal.Value(testNamespace) != bytesBefore+float64(len(testArtifact)) {
+		t.Fatalf("expected %d bytes to be recorded for namespace %s", len(testArtifact), testNamespace)
+	}
+
+	// builds from other namespaces are counted separately
+	teamA := downloadsTotal.Value("team-a")
+	handleBinaryResponse(httptest.NewRecorder(), artifact{namespace: "team-a", cacheKey: "app", url: env.jenkins.URL + "/artifact/android-1", contentType: binaryContentType})
+	if downloadsTotal.Value("team-a") != teamA+1 {
+		t.Fatal("expected a download to be recorded for namespace team-a")
+	}
+	if downloadsTotal.Value(testNamespace) != before+1 {
+		t.Fatalf("expected the download in team-a not to be counted for namespace %s", testNamespace)
+	}
+
+	errorsBefore := downloadErrorsTotal.Value("team-b")
+	handleBinaryResponse(httptest.NewRecorder(), artifact{namespace: "team-b", cacheKey: "app", url: "http://127.0.0.1:0/missing"})
+	if downloadErrorsTotal.Value("team-b") != errorsBefore+1 {
+		t.Fatal("expected a failed download to be recorded for namespace team-b")
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	registerMetrics()
+	defer func() { metrics.DefaultRegistry = metrics.NewRegistry() }()
+
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	body := env.do("GET", "/metrics", nil).Body.String()
+	if !strings.Contains(body, `artifact_proxy_downloads_total{namespace="test"}`) {
+		t.Fatalf("expected downloads labelled by namespace but got\n%s", body)
+	}
+	if strings.Contains(body, "android-1") {
+		t.Fatalf("expected build names never to be used as labels but got\n%s", body)
+	}
+}
+
+func TestCacheMetrics(t *testing.T) {
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	registerMetrics()
+	defer func() { metrics.DefaultRegistry = metrics.NewRegistry() }()
+
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	body := env.do("GET", "/metrics", nil).Body.String()
+	for _, expected := range []string{
+		"artifact_proxy_cache_hits_total 1\n",
+		"artifact_proxy_cache_misses_total 1\n",
+		"artifact_proxy_cache_evictions_total 0\n",
+		"artifact_proxy_cache_size_bytes " + strconv.Itoa(len(testArtifact)) + "\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in metrics but got\n%s", expected, body)
+		}
+	}
+}
+
+func TestRegisterMetricsTwice(t *testing.T) {
+	defer enableCache(t)()
+	defer func() { metrics.DefaultRegistry = metrics.NewRegistry() }()
+	registered := downloadsTotal
+	registerMetrics()
+	// a collector created again, e.g. by re-initialisation, gives way to the registered one
+	downloadsTotal = metrics.NewCounterVec(downloadsTotal.Name(), "Artifact downloads completed.", "namespace")
+	registerMetrics()
+	if downloadsTotal != registered {
+		t.Fatal("expected the already registered collector to be reused")
+	}
+
+	downloadsTotal.Inc("twice")
+	rec := httptest.NewRecorder()
+	metrics.DefaultRegistry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	if strings.Count(body, "# TYPE artifact_proxy_downloads_total") != 1 || strings.Count(body, "# TYPE artifact_proxy_cache_hits_total") != 1 {
+		t.Fatalf("expected each metric to be exposed once but got\n%s", body)
+	}
+	if !strings.Contains(body, `artifact_proxy_downloads_total{namespace="twice"} 1`) {
+		t.Fatalf("expected increments to reach the registered collector but got\n%s", body)
+	}
+}
+
+func TestDownloadDurationExemplars(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	registerMetrics()
+	defer func() { metrics.DefaultRegistry = metrics.NewRegistry() }()
+	traced := map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	openMetrics := map[string]string{"Accept": "application/openmetrics-text; version=1.0.0"}
+
+	env.do("GET", "/android-1/download?token="+testToken, traced)
+	if body := env.do("GET", "/metrics", openMetrics).Body.String(); strings.Contains(body, "trace_id") {
+		t.Fatalf("expected no exemplars unless they are enabled but got\n%s", body)
+	}
+
+	defer setEnv("ENABLE_EXEMPLARS", "true")()
+	before := downloadDurationSeconds.Count(testNamespace)
+	env.do("GET", "/android-1/download?token="+testToken, traced)
+	if downloadDurationSeconds.Count(testNamespace) != before+1 {
+		t.Fatal("expected the download duration to be observed")
+	}
+	body := env.do("GET", "/metrics", openMetrics).Body.String()
+	if !strings.Contains(body, `# {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"}`) {
+		t.Fatalf("expected an exemplar with the trace id but got\n%s", body)
+	}
+	if body := env.do("GET", "/metrics", nil).Body.String(); strings.Contains(body, "trace_id") {
+		t.Fatalf("expected exemplars only in the OpenMetrics format but got\n%s", body)
+	}
+}
+
+func TestWithTraceIgnoresUnsampledTraces(t *testing.T) {
+	defer setEnv("ENABLE_EXEMPLARS", "true")()
+	for traceparent, sampled := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00": false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0a": false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": false,
+		"not-a-trace": false,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("traceparent", traceparent)
+		if _, ok := traceFromContext(withTrace(r).Context()); ok != sampled {
+			t.Errorf("expected sampled %v for %s", sampled, traceparent)
+		}
+	}
+}
+
+//resetAppLabels forgets the apps seen so far, so APP_LABEL_MAX_VALUES is read again
+func resetAppLabels() {
+	appLabelsOnce, appLabels = sync.Once{}, nil
+}
+
+func TestDownloadMetricsLabelledByApp(t *testing.T) {
+	defer setEnv("APP_LABEL_MAX_VALUES", "1")()
+	resetAppLabels()
+	defer resetAppLabels()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.App: "shop"})
+	env.addBuild("android-2", "android", map[string]string{openshift.App: "bank"})
+	env.addBuild("android-3", "android", nil)
+
+	shop, other := appDownloadsTotal.Value("shop"), appDownloadsTotal.Value(metrics.OtherValue)
+	shopBytes := appDownloadBytesTotal.Value("shop")
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	if appDownloadsTotal.Value("shop") != shop+1 || appDownloadBytesTotal.Value("shop") != shopBytes+float64(len(testArtifact)) {
+		t.Fatal("expected the download to be recorded for app shop")
+	}
+	env.do("GET", "/android-2/download?token="+testToken, nil)
+	if appDownloadsTotal.Value("bank") != 0 || appDownloadsTotal.Value(metrics.OtherValue) != other+1 {
+		t.Fatalf("expected an app beyond the cap to be recorded as %s", metrics.OtherValue)
+	}
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	if appDownloadsTotal.Value("shop") != shop+2 {
+		t.Fatal("expected app shop to keep its label once the cap was reached")
+	}
+
+	registerMetrics()
+	defer func() { metrics.DefaultRegistry = metrics.NewRegistry() }()
+	env.do("GET", "/android-3/download?token="+testToken, nil)
+	body := env.do("GET", "/metrics", nil).Body.String()
+	if !strings.Contains(body, `artifact_proxy_app_downloads_total{app="shop"}`) || strings.Contains(body, `app=""`) {
+		t.Fatalf("expected downloads labelled by app, and none for builds without one, but got\n%s", body)
+	}
+}
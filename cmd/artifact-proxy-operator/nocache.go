@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//conditionalRequestHeaders are passed on to Jenkins when streaming a build which is never cached
+var conditionalRequestHeaders = []string{"If-None-Match", "If-Modified-Since"}
+
+//isNoCache reports whether a build has opted out of caching with the no-cache annotation
+func isNoCache(build *apibuildv1.Build) bool {
+	return build.Annotations[openshift.NoCache] == "true"
+}
+
+//conditionalHeaders picks the conditional request headers out of a request, nil when it has none
+func conditionalHeaders(r *http.Request) http.Header {
+	var conditions http.Header
+	for _, name := range conditionalRequestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			if conditions == nil {
+				conditions = http.Header{}
+			}
+			conditions.Set(name, value)
+		}
+	}
+	return conditions
+}
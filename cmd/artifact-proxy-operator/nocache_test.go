@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestNoCacheBuildIsNeverCached(t *testing.T) {
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.NoCache: "true"})
+
+	for i := 0; i < 2; i++ {
+		rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+			t.Fatalf("expected no-cache build to be streamed from Jenkins, got status %d", rec.Code)
+		}
+	}
+	if artifactCache.Has("android-1") {
+		t.Fatal("expected no-cache build not to be written to the cache")
+	}
+	env.jenkins.Close()
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code == http.StatusOK {
+		t.Fatal("expected no-cache build to be fetched from Jenkins every time")
+	}
+}
+
+func TestNoCacheBuildConditionalRequest(t *testing.T) {
+	modified := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("ETag", `"v1"`)
+		http.ServeContent(rw, r, "", modified, bytes.NewReader([]byte(testArtifact)))
+	}))
+	defer upstream.Close()
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.NoCache: "true", openshift.JenkinsArtifactUri: upstream.URL + "/artifact"})
+
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rec.Code)
+	}
+	if rec.Header().Get("ETag") != `"v1"` || rec.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+		t.Fatalf("expected the validators from Jenkins to be relayed, got %v", rec.Header())
+	}
+	rec = env.do("GET", "/android-1/download?token="+testToken, map[string]string{"If-None-Match": `"v1"`})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("expected status %d for a matching etag but got %d", http.StatusNotModified, rec.Code)
+	}
+	rec = env.do("GET", "/android-1/download?token="+testToken, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)})
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected status %d for an unmodified artifact but got %d", http.StatusNotModified, rec.Code)
+	}
+	rec = env.do("GET", "/android-1/download?token="+testToken, map[string]string{"If-None-Match": `"v0"`})
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+		t.Fatalf("expected a changed artifact to be served, got status %d", rec.Code)
+	}
+	if artifactCache.Has("android-1") {
+		t.Fatal("expected no-cache build not to be written to the cache")
+	}
+}
+
+func TestPrewarmNoCacheBuild(t *testing.T) {
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.NoCache: "true"})
+	defer setEnv("ADMIN_TOKEN", "admin")()
+
+	rec := env.do("POST", "/android-1/prewarm", map[string]string{"Authorization": "Bearer admin"})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d but got %d", http.StatusNoContent, rec.Code)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/notes"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//releaseNotes renders the artifact-proxy/release-notes annotation of a build, as markdown when its
+//artifact-proxy/release-notes-format annotation is markdown and as plain text otherwise
+func releaseNotes(build *apibuildv1.Build) template.HTML {
+	text := build.Annotations[openshift.ReleaseNotes]
+	if text == "" {
+		return ""
+	}
+	return notes.Render(text, build.Annotations[openshift.ReleaseNotesFormat] == "markdown")
+}
+
+//notesHandler serves /<build>/notes, the build's rendered release notes
+func notesHandler(rw http.ResponseWriter, r *http.Request) {
+	build, _, ok := lookupAuthorizedBuild(rw, r)
+	if !ok {
+		return
+	}
+	rendered := releaseNotes(build)
+	if rendered == "" {
+		httpError(rw, "no release notes published for build "+build.Name, http.StatusNotFound)
+		return
+	}
+	rw.Header().Set("content-type", "text/html; charset=utf-8")
+	rw.Write([]byte(rendered))
+}
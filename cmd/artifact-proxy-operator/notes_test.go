@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestReleaseNotes(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("plain", "android", map[string]string{openshift.ReleaseNotes: "Fixed <login>"})
+	env.addBuild("markdown", "android", map[string]string{
+		openshift.ReleaseNotes:       "## Fixes\n\n- **login** <script>alert(1)</script>\n- [docs](javascript:steal)",
+		openshift.ReleaseNotesFormat: "markdown",
+	})
+	env.addBuild("none", "android", nil)
+
+	rec := env.do("GET", "/plain/notes?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "<pre>Fixed &lt;login&gt;</pre>" {
+		t.Fatalf("expected escaped plain text notes but got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = env.do("GET", "/markdown/notes?token="+testToken, nil)
+	expected := "<h2>Fixes</h2>\n<ul>\n<li><strong>login</strong> &lt;script&gt;alert(1)&lt;/script&gt;</li>\n<li>docs</li>\n</ul>"
+	if rec.Code != http.StatusOK || rec.Body.String() != expected {
+		t.Fatalf("expected sanitized markdown notes\n%s\nbut got %d:\n%s", expected, rec.Code, rec.Body.String())
+	}
+	if rec := env.do("GET", "/markdown/notes?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected an invalid token to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/none/notes?token="+testToken, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a build without notes but got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestReleaseNotesOnLandingPage(t *testing.T) {
+	defer setEnv("ANDROID_LANDING_PAGE", "true")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.ReleaseNotes: "Fixed <login>"})
+	env.addBuild("ios-1", "ios", map[string]string{openshift.ReleaseNotes: "Faster *startup*", openshift.ReleaseNotesFormat: "markdown"})
+
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if !strings.Contains(rec.Body.String(), "<pre>Fixed &lt;login&gt;</pre>") {
+		t.Fatalf("expected the release notes on the android landing page but got %s", rec.Body.String())
+	}
+	rec = env.do("GET", "/ios-1/download?token="+testToken, nil)
+	if !strings.Contains(rec.Body.String(), "<p>Faster <em>startup</em></p>") || !strings.Contains(rec.Body.String(), "itms-services://") {
+		t.Fatalf("expected the release notes and install link on the iOS landing page but got %s", rec.Body.String())
+	}
+}
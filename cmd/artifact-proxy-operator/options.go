@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"path"
+)
+
+//handleOptions answers a bare OPTIONS request with the methods the route supports, without authenticating it as
+//there is nothing about the build to give away
+func handleOptions(rw http.ResponseWriter, r *http.Request) {
+	allow := "GET, HEAD, OPTIONS"
+	switch path.Base(r.URL.Path) {
+	case "prewarm":
+		allow = "GET, POST, OPTIONS"
+	case "rotate-token":
+		allow = "POST, OPTIONS"
+	case "cache":
+		allow = "DELETE, OPTIONS"
+	}
+	rw.Header().Set("Allow", allow)
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	for target, allow := range map[string]string{
+		"/android-1/download": "GET, HEAD, OPTIONS",
+		"/android-1/validate": "GET, HEAD, OPTIONS",
+		"/android-1/prewarm":  "GET, POST, OPTIONS",
+		"/android-1/cache":    "DELETE, OPTIONS",
+	} {
+		rec := env.do("OPTIONS", target, nil)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("expected status %d for OPTIONS %s but got %d", http.StatusNoContent, target, rec.Code)
+		}
+		if got := rec.Header().Get("Allow"); got != allow {
+			t.Errorf("expected Allow %q for %s but got %q", allow, target, got)
+		}
+	}
+}
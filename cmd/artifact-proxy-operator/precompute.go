@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/checksum"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//precomputeQueueSize is how many builds can wait for their checksum, builds observed while it is full are skipped
+const precomputeQueueSize = 100
+
+//precomputeSpacing is the pause between precomputing two checksums, so a burst of new builds is fetched from Jenkins
+//one after the other rather than all at once
+var precomputeSpacing = time.Second
+
+//precomputeChecksums is PRECOMPUTE_CHECKSUMS, fetching and hashing the artifact of each build into the cache as soon
+//as the watcher sees it. It needs the cache, the artifact is not fetched just to be hashed and thrown away
+func precomputeChecksums() bool {
+	return os.Getenv("PRECOMPUTE_CHECKSUMS") == "true" && artifactCache != nil
+}
+
+//precomputedChecksum is the sha256 of the artifact a build had at url when it was observed
+type precomputedChecksum struct {
+	url      string
+	checksum string
+}
+
+//checksumPrecomputer hashes the artifacts of observed builds one at a time in the background
+type checksumPrecomputer struct {
+	lock     sync.Mutex
+	computed map[string]precomputedChecksum
+	queued   map[string]bool
+	queue    chan checksumJob
+	once     sync.Once
+}
+
+//checksumJob is a build whose artifact at url is waiting to be hashed
+type checksumJob struct {
+	build string
+	url   string
+}
+
+var precomputed = newChecksumPrecomputer()
+
+func newChecksumPrecomputer() *checksumPrecomputer {
+	return &checksumPrecomputer{computed: map[string]precomputedChecksum{}, queued: map[string]bool{}}
+}
+
+//queueChecksum queues the artifact of an observed build to be hashed, when PRECOMPUTE_CHECKSUMS is on
+func queueChecksum(build *apibuildv1.Build) {
+	if !precomputeChecksums() || isNoCache(build) {
+		return
+	}
+	artifactUrl, ok := buildArtifactUrl(build)
+	if !ok || artifactUrl == "" || isS3Location(artifactUrl) || checkArtifactUrl(artifactUrl) != nil {
+		return
+	}
+	precomputed.enqueue(build.Name, artifactUrl)
+}
+
+//get returns the checksum computed for the artifact of build, as long as it is still at url
+func (p *checksumPrecomputer) get(build string, url string) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	computed, ok := p.computed[build]
+	if !ok || computed.url != url {
+		return "", false
+	}
+	return computed.checksum, true
+}
+
+//forget drops the checksum computed for build, along with any waiting to be computed or being computed
+func (p *checksumPrecomputer) forget(build string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.computed, build)
+	for key := range p.queued {
+		if strings.HasPrefix(key, build+" ") {
+			delete(p.queued, key)
+		}
+	}
+}
+
+//enqueue queues the artifact of build to be hashed, unless it already has been or is waiting to be. The watcher sees
+//the same build on every update, so this must not block
+func (p *checksumPrecomputer) enqueue(build string, url string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.once.Do(func() {
+		p.queue = make(chan checksumJob, precomputeQueueSize)
+		go p.run()
+	})
+	if computed, ok := p.computed[build]; (ok && computed.url == url) || p.queued[build+" "+url] {
+		return
+	}
+	select {
+	case p.queue <- checksumJob{build: build, url: url}:
+		p.queued[build+" "+url] = true
+	default:
+		log.Printf("not precomputing the checksum of build %s, too many builds are waiting for theirs", build)
+	}
+}
+
+func (p *checksumPrecomputer) run() {
+	for job := range p.queue {
+		sum, err := computeChecksum(job.build, job.url)
+		p.lock.Lock()
+		//a job which is no longer queued was forgotten while it ran, its checksum may be of the old artifact
+		current := p.queued[job.build+" "+job.url]
+		delete(p.queued, job.build+" "+job.url)
+		if err == nil && current {
+			p.computed[job.build] = precomputedChecksum{url: job.url, checksum: sum}
+		}
+		p.lock.Unlock()
+		if err != nil {
+			log.Printf("error precomputing the checksum of build %s: %s", job.build, err.Error())
+		}
+		time.Sleep(precomputeSpacing)
+	}
+}
+
+//computeChecksum hashes the artifact of build, filling the cache with it on the way unless it is cached already
+func computeChecksum(build string, url string) (string, error) {
+	var artifact io.ReadCloser
+	if cached, ok := artifactCache.Open(build); ok {
+		artifact = cached
+	} else {
+		stream, err := source.Stream(context.Background(), url, nil)
+		if err != nil {
+			return "", err
+		}
+		artifact = artifactCache.FillNamed(build, stream.Filename, stream)
+	}
+	defer artifact.Close()
+	sum, err := checksum.Compute("sha256", artifact)
+	if err != nil {
+		return "", err
+	}
+	return sum.String(), nil
+}
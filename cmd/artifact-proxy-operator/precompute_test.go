@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestPrecomputeChecksums(t *testing.T) {
+	defer setEnv("PRECOMPUTE_CHECKSUMS", "true")()
+	defer enableCache(t)()
+	precomputed, precomputeSpacing = newChecksumPrecomputer(), 0
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("android-1", "android", nil)
+	skipped := env.addBuild("android-2", "android", map[string]string{openshift.NoCache: "true"})
+	src := &memorySource{content: []byte(testArtifact)}
+	defer useSource(src)()
+
+	observeBuild(build)
+	observeBuild(build)
+	observeBuild(skipped)
+	deadline := time.Now().Add(5 * time.Second)
+	artifactUrl, _ := buildArtifactUrl(build)
+	for {
+		if _, ok := precomputed.get("android-1", artifactUrl); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the checksum to be precomputed after the build was observed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := env.do("GET", "/android-1/checksum?token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifactSha256 {
+		t.Fatalf("expected the precomputed checksum but got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Body.String() != testArtifact {
+		t.Fatalf("expected the verified artifact but got %q", rec.Body.String())
+	}
+	if streams, _, _ := src.counts(); streams != 1 {
+		t.Fatalf("expected the artifact to be fetched once when observed but it was fetched %d times", streams)
+	}
+	if rec := env.do("GET", "/android-2/checksum?token="+testToken, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected no checksum for a no-cache build but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	prewarmFetching = "fetching"
+	prewarmCached   = "cached"
+	prewarmFailed   = "failed"
+)
+
+type prewarmStatus struct {
+	Build string `json:"build"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+//prewarmTracker records the progress of cache prewarms so they can be reported back to admins
+type prewarmTracker struct {
+	lock   sync.Mutex
+	status map[string]prewarmStatus
+}
+
+var prewarms = &prewarmTracker{status: map[string]prewarmStatus{}}
+
+//start marks a prewarm for build as in progress, false is returned if one is already running
+func (p *prewarmTracker) start(build string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.status[build].State == prewarmFetching {
+		return false
+	}
+	p.status[build] = prewarmStatus{Build: build, State: prewarmFetching}
+	return true
+}
+
+func (p *prewarmTracker) set(status prewarmStatus) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.status[status.Build] = status
+}
+
+func (p *prewarmTracker) get(build string) (prewarmStatus, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	status, ok := p.status[build]
+	return status, ok
+}
+
+//forget drops the status of the prewarm of build, unless it is still fetching
+func (p *prewarmTracker) forget(build string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.status[build].State != prewarmFetching {
+		delete(p.status, build)
+	}
+}
+
+//prewarmHandler serves /<build>/prewarm. POST fetches the build's artifact into the cache in the background and GET
+//reports how that is going
+func prewarmHandler(rw http.ResponseWriter, r *http.Request) {
+	if !isAdminRequest(r) {
+		httpError(rw, "admin authorization required", http.StatusForbidden)
+		return
+	}
+	buildName, err := buildNameFromPath(r.URL.Path)
+	if err != nil {
+		httpError(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		status, ok := prewarms.get(buildName)
+		if !ok {
+			httpError(rw, fmt.Sprintf("no prewarm requested for build %s", buildName), http.StatusNotFound)
+			return
+		}
+		writePrewarmStatus(rw, http.StatusOK, status)
+	case http.MethodPost:
+		if artifactCache == nil {
+			// nothing to warm
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		build, err := osClient.GetBuild(buildName)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				httpError(rw, fmt.Sprintf("no resources found for build %s", buildName), http.StatusNotFound)
+				return
+			}
+			httpError(rw, fmt.Sprintf("error fetching build %s", buildName), http.StatusInternalServerError)
+			return
+		}
+		artifactUrl, ok := buildArtifactUrl(build)
+		if !ok || artifactUrl == "" {
+			refuseMissingArtifact(rw, build)
+			return
+		}
+		if isNoCache(build) {
+			// the build is never cached, so there is nothing to warm
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if prewarms.start(buildName) {
+			go prewarm(buildName, artifactUrl)
+		}
+		status, _ := prewarms.get(buildName)
+		writePrewarmStatus(rw, http.StatusAccepted, status)
+	default:
+		httpError(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func prewarm(buildName string, artifactUrl string) {
+	status := prewarmStatus{Build: buildName, State: prewarmCached}
+	defer func() { prewarms.set(status) }()
+	if artifactCache.Has(buildName) {
+		return
+	}
+	stream, err := source.Stream(context.Background(), artifactUrl, nil)
+	if err != nil {
+		log.Printf("error prewarming cache for build %s: %s", buildName, err.Error())
+		status.State, status.Error = prewarmFailed, err.Error()
+		return
+	}
+	defer stream.Close()
+	if err := artifactCache.StoreNamed(buildName, stream.Filename, stream); err != nil {
+		log.Printf("error prewarming cache for build %s: %s", buildName, err.Error())
+		status.State, status.Error = prewarmFailed, err.Error()
+	}
+}
+
+func writePrewarmStatus(rw http.ResponseWriter, code int, status prewarmStatus) {
+	rw.Header().Set("content-type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(status)
+}
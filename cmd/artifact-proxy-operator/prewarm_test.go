@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+func TestPrewarm(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	admin := map[string]string{"Authorization": "Bearer admin"}
+	unpublished := env.addBuild("android-2", "android", nil)
+	unpublished.Status.Phase = apibuildv1.BuildPhaseComplete
+	delete(unpublished.Annotations, openshift.JenkinsArtifactUri)
+
+	if rec := env.do("POST", "/android-1/prewarm", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected prewarm without admin token to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("POST", "/missing/prewarm", admin); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a missing build but got %d", http.StatusNotFound, rec.Code)
+	}
+	if rec := env.do("POST", "/android-2/prewarm", admin); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "no artifact published") {
+		t.Fatalf("expected status %d for a build without an artifact but got %d %q", http.StatusConflict, rec.Code, rec.Body.String())
+	}
+	if rec := env.do("POST", "/android-1/prewarm", admin); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d but got %d", http.StatusAccepted, rec.Code)
+	}
+
+	var status prewarmStatus
+	for i := 0; i < 100; i++ {
+		rec := env.do("GET", "/android-1/prewarm", admin)
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatal("error decoding prewarm status " + err.Error())
+		}
+		if status.State != prewarmFetching {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.State != prewarmCached {
+		t.Fatalf("expected prewarm to finish as %s but got %+v", prewarmCached, status)
+	}
+	cached, ok := artifactCache.Open("android-1")
+	if !ok {
+		t.Fatal("expected artifact to be in the cache after prewarm")
+	}
+	defer cached.Close()
+	if content, _ := ioutil.ReadAll(cached); string(content) != testArtifact {
+		t.Fatalf("expected cached content %q but got %q", testArtifact, content)
+	}
+}
+
+func TestPrewarmCacheDisabled(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	rec := env.do("POST", "/android-1/prewarm", map[string]string{"Authorization": "Bearer admin"})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected prewarm to be a no-op with status %d but got %d", http.StatusNoContent, rec.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"sort"
+)
+
+// knownQueryParams are all the query parameters understood by the download routes
+var knownQueryParams = map[string]bool{
+	"token":       true,
+	"sig":         true,
+	"artifact":    true,
+	"plist":       true,
+	"variant":     true,
+	"platform":    true,
+	"entry":       true,
+	"reason":      true,
+	"wait":        true,
+	"disposition": true,
+}
+
+//strictQuery rejects requests carrying query parameters the proxy does not understand when STRICT_QUERY is set,
+//catching client bugs and parameters smuggled through to the cache or Jenkins. By default they are ignored
+func strictQuery() bool {
+	return os.Getenv("STRICT_QUERY") == "true"
+}
+
+//unknownQueryParams returns the query parameters of u which are not known, sorted
+func unknownQueryParams(u *url.URL) []string {
+	var unknown []string
+	for k := range u.Query() {
+		if !knownQueryParams[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStrictQuery(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	env.addBuild("ios-1", "ios", nil)
+
+	// unknown parameters are ignored by default
+	if rec := env.do("GET", "/android-1/download?token="+testToken+"&cachebust=1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected unknown parameters to be ignored by default but got status %d", rec.Code)
+	}
+
+	defer setEnv("STRICT_QUERY", "true")()
+	for _, target := range []string{
+		"/android-1/download?token=" + testToken,
+		"/ios-1/download?plist=true&variant=&token=" + testToken,
+		"/ios-1/download?artifact=true&token=" + testToken,
+	} {
+		if rec := env.do("GET", target, nil); rec.Code != http.StatusOK {
+			t.Errorf("expected %s to be allowed in strict mode but got status %d", target, rec.Code)
+		}
+	}
+	rec := env.do("GET", "/android-1/download?token="+testToken+"&cachebust=1&b=2", nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unexpected query parameters b, cachebust") {
+		t.Fatalf("expected unknown parameters to be rejected in strict mode but got %d %q", rec.Code, rec.Body.String())
+	}
+}
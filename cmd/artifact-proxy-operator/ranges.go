@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxRanges = 10
+
+//maxRanges is the most sub-ranges a single Range header may ask for, MAX_RANGES (default 10)
+func maxRanges() int {
+	if configured, err := strconv.Atoi(os.Getenv("MAX_RANGES")); err == nil && configured > 0 {
+		return configured
+	}
+	return defaultMaxRanges
+}
+
+//tooManyRanges reports whether the request asks for more byte ranges than allowed. Each sub-range can mean another
+//fetch of the artifact, so an unbounded list would let one request amplify into many upstream reads
+func tooManyRanges(r *http.Request) bool {
+	header := r.Header.Get("Range")
+	if !strings.HasPrefix(header, "bytes=") {
+		return false
+	}
+	count := 0
+	for _, spec := range strings.Split(strings.TrimPrefix(header, "bytes="), ",") {
+		if strings.TrimSpace(spec) != "" {
+			count++
+		}
+	}
+	return count > maxRanges()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTooManyRanges(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	over := make([]string, defaultMaxRanges+1)
+	for i := range over {
+		over[i] = "0-1"
+	}
+	rec := env.do("GET", "/android-1/download?token="+testToken, map[string]string{"Range": "bytes=" + strings.Join(over, ",")})
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("expected status %d for %d ranges but got %d", http.StatusRequestedRangeNotSatisfiable, len(over), rec.Code)
+	}
+
+	rec = env.do("GET", "/android-1/download?token="+testToken, map[string]string{"Range": "bytes=" + strings.Join(over[1:], ",")})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d for %d ranges but got %d", http.StatusOK, len(over)-1, rec.Code)
+	}
+
+	defer setEnv("MAX_RANGES", "2")()
+	rec = env.do("GET", "/android-1/download?token="+testToken, map[string]string{"Range": "bytes=0-1,2-3,4-5"})
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("expected MAX_RANGES to be respected but got status %d", rec.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+//cacheMinFreeBytes is the free space the cache volume needs for the operator to be ready, CACHE_MIN_FREE_BYTES
+//(default 0, only writability is checked)
+func cacheMinFreeBytes() uint64 {
+	configured, err := strconv.ParseUint(os.Getenv("CACHE_MIN_FREE_BYTES"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return configured
+}
+
+//readyHandler serves /readyz. When caching is enabled the operator is only ready while the cache volume is
+//writable and has enough free space, so a broken volume takes the pod out of rotation. With verbose=true the answer
+//is JSON which also tells which artifact sources are reachable
+func readyHandler(rw http.ResponseWriter, r *http.Request) {
+	var cacheErr error
+	if artifactCache != nil {
+		if cacheErr = artifactCache.Check(cacheMinFreeBytes()); cacheErr != nil {
+			log.Printf("not ready: %v", cacheErr)
+		}
+	}
+	if r.URL.Query().Get("verbose") == "true" {
+		writeSourceDetail(rw, cacheErr)
+		return
+	}
+	if cacheErr != nil {
+		httpError(rw, "artifact cache unavailable: "+cacheErr.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	rw.Write([]byte("ok"))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/cache"
+)
+
+func TestReadyWithoutCache(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+
+	if rec := env.do("GET", "/readyz", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d without a cache but got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestNotReadyWhenCacheUnwritable(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	dir, err := ioutil.TempDir("", "artifact-cache")
+	if err != nil {
+		t.Fatal("error creating cache dir " + err.Error())
+	}
+	defer os.RemoveAll(dir)
+	artifactCache, err = cache.NewDiskCache(dir)
+	if err != nil {
+		t.Fatal("error creating cache " + err.Error())
+	}
+	defer func() { artifactCache = nil }()
+
+	if rec := env.do("GET", "/readyz", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d with a writable cache but got %d", http.StatusOK, rec.Code)
+	}
+
+	restore := setEnv("CACHE_MIN_FREE_BYTES", "18446744073709551615")
+	if rec := env.do("GET", "/readyz", nil); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d without enough free space but got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	restore()
+
+	// permissions do not apply to root, make the directory unusable by replacing it with a file instead
+	os.Chmod(dir, 0500)
+	if f, err := ioutil.TempFile(dir, "probe"); err == nil {
+		f.Close()
+		os.RemoveAll(dir)
+		ioutil.WriteFile(dir, nil, 0400)
+	}
+	if rec := env.do("GET", "/readyz", nil); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d with a read only cache but got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func TestReadySourceDetail(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	sourceChecks = newSourceHealth()
+	var probes int64
+	serve := func(code int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&probes, 1)
+			rw.WriteHeader(code)
+		}))
+	}
+	jenkins, s3, failing, gone := serve(http.StatusOK), serve(http.StatusForbidden), serve(http.StatusBadGateway), serve(http.StatusOK)
+	defer jenkins.Close()
+	defer s3.Close()
+	defer failing.Close()
+	gone.Close()
+	defer setEnv("SOURCE_PROBES", "jenkins="+jenkins.URL+",s3="+s3.URL+",gcs="+failing.URL+",nexus="+gone.URL+",broken")()
+
+	var detail struct {
+		Ready   bool                    `json:"ready"`
+		Sources map[string]sourceStatus `json:"sources"`
+	}
+	for i := 0; i < 2; i++ {
+		rec := env.do("GET", "/readyz?verbose=true", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected unreachable sources not to make the operator unready but got %d", rec.Code)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &detail); err != nil {
+			t.Fatal("error parsing readiness detail " + err.Error())
+		}
+	}
+	if !detail.Ready || len(detail.Sources) != 4 {
+		t.Fatalf("expected the four valid sources in the detail but got %+v", detail)
+	}
+	for name, reachable := range map[string]bool{"jenkins": true, "s3": true, "gcs": false, "nexus": false} {
+		status := detail.Sources[name]
+		if status.Reachable != reachable || (status.Error == "") == !reachable {
+			t.Fatalf("expected %s reachable %v but got %+v", name, reachable, status)
+		}
+		if expected := map[bool]float64{true: 1, false: 0}[reachable]; sourceReachable.Value(name) != expected {
+			t.Fatalf("expected artifact_source_reachable of %s to be %v but got %v", name, expected, sourceReachable.Value(name))
+		}
+	}
+	if probed := atomic.LoadInt64(&probes); probed != 3 {
+		t.Fatalf("expected each live source to be probed once within the interval but they were probed %d times", probed)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+const (
+	reasonHeader           = "X-Download-Reason"
+	defaultMaxReasonLength = 200
+)
+
+//requireDownloadReason makes downloads state why they are made, with a reason query parameter or the
+//X-Download-Reason header, when REQUIRE_DOWNLOAD_REASON is set
+func requireDownloadReason() bool {
+	return os.Getenv("REQUIRE_DOWNLOAD_REASON") == "true"
+}
+
+func maxReasonLength() int {
+	if configured, err := strconv.Atoi(os.Getenv("DOWNLOAD_REASON_MAX_LENGTH")); err == nil && configured > 0 {
+		return configured
+	}
+	return defaultMaxReasonLength
+}
+
+//downloadReason returns the reason given for a request, the query parameter taking precedence over the header. A
+//reason which is too long or contains control characters is an error, as is a missing one when reasons are required
+func downloadReason(r *http.Request) (string, error) {
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = r.Header.Get(reasonHeader)
+	}
+	if reason == "" {
+		if requireDownloadReason() {
+			return "", errors.New("a reason for the download is required, set the reason parameter or the " + reasonHeader + " header")
+		}
+		return "", nil
+	}
+	if utf8.RuneCountInString(reason) > maxReasonLength() {
+		return "", errors.New("the download reason is longer than " + strconv.Itoa(maxReasonLength()) + " characters")
+	}
+	for _, c := range reason {
+		if unicode.IsControl(c) {
+			return "", errors.New("the download reason contains control characters")
+		}
+	}
+	return reason, nil
+}
+
+//auditDownload records who downloaded a build and why in the audit log
+func auditDownload(r *http.Request, build *apibuildv1.Build, reason string) {
+	if reason == "" {
+		return
+	}
+	log.Printf("audit: request for build %s/%s from %s, reason %q", build.Namespace, build.Name, r.RemoteAddr, reason)
+}
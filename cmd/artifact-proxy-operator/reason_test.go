@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDownloadReason(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	env.addBuild("ios-1", "ios", nil)
+
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected reasons to be optional by default, got status %d", rec.Code)
+	}
+
+	defer setEnv("REQUIRE_DOWNLOAD_REASON", "true")()
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d without a reason but got %d", http.StatusBadRequest, rec.Code)
+	}
+	logged, restore := captureLog()
+	rec := env.do("GET", "/android-1/download?reason=QA+sign-off&token="+testToken, nil)
+	restore()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d with a reason but got %d", http.StatusOK, rec.Code)
+	}
+	if !strings.Contains(logged.String(), `audit: request for build test/android-1`) || !strings.Contains(logged.String(), `reason "QA sign-off"`) {
+		t.Fatalf("expected the reason in the audit log but got %q", logged.String())
+	}
+	if rec := env.do("GET", "/android-1/download?token="+testToken, map[string]string{reasonHeader: "release check"}); rec.Code != http.StatusOK {
+		t.Fatalf("expected the reason header to be accepted, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/download?reason="+strings.Repeat("a", 201)+"&token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for a reason which is too long but got %d", http.StatusBadRequest, rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/download?reason=a%0Ab&token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for a reason with control characters but got %d", http.StatusBadRequest, rec.Code)
+	}
+	rec = env.do("GET", "/ios-1/download?plist=true&reason=QA&token="+testToken, nil)
+	if !strings.Contains(rec.Body.String(), "reason=QA") {
+		t.Fatalf("expected the reason to be passed on to the ipa url but got \n%s", rec.Body.String())
+	}
+}
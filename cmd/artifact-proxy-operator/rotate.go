@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+type rotatedToken struct {
+	Build       string `json:"build"`
+	Token       string `json:"token"`
+	DownloadUrl string `json:"downloadUrl,omitempty"`
+	//PreviousTokenExpires is when the old token stops working, it is empty when it was revoked straight away
+	PreviousTokenExpires string `json:"previousTokenExpires,omitempty"`
+}
+
+//rotateTokenHandler serves POST /<build>/rotate-token, which replaces a build's download token. The old token keeps
+//working for TOKEN_ROTATION_GRACE_SECONDS so links which are already shared do not break mid download
+func rotateTokenHandler(rw http.ResponseWriter, r *http.Request) {
+	if !isAdminRequest(r) {
+		httpError(rw, "admin authorization required", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		httpError(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	buildName, err := buildNameFromPath(r.URL.Path)
+	if err != nil {
+		httpError(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	build, err := osClient.GetBuildContext(r.Context(), buildName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			httpError(rw, fmt.Sprintf("no resources found for build %s", buildName), http.StatusNotFound)
+			return
+		}
+		httpError(rw, fmt.Sprintf("error fetching build %s", buildName), http.StatusInternalServerError)
+		return
+	}
+	rotated, err := osClient.RotateToken(build, tokenRotationGrace())
+	if err != nil {
+		log.Printf("error rotating token for build %s: %s", buildName, err.Error())
+		httpError(rw, fmt.Sprintf("error rotating token for build %s", buildName), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("audit: token for build %s/%s rotated from %s", rotated.Namespace, rotated.Name, r.RemoteAddr)
+	rw.Header().Set("content-type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(rotatedToken{
+		Build:                rotated.Name,
+		Token:                rotated.Annotations[openshift.ArtifactDownloadToken],
+		DownloadUrl:          rotated.Annotations[openshift.DownloadProxyUri],
+		PreviousTokenExpires: rotated.Annotations[openshift.PreviousTokenExpires],
+	})
+}
+
+//tokenRotationGrace reads TOKEN_ROTATION_GRACE_SECONDS, how long a rotated token is still accepted. The default of
+//zero revokes it immediately
+func tokenRotationGrace() time.Duration {
+	val := os.Getenv("TOKEN_ROTATION_GRACE_SECONDS")
+	if val == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(val)
+	if err != nil || seconds < 0 {
+		log.Printf("ignoring invalid TOKEN_ROTATION_GRACE_SECONDS %q", val)
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+//validPreviousToken reports whether token is the one a build had before its last rotation and is still inside the
+//grace window
+func validPreviousToken(build *apibuildv1.Build, token string) bool {
+	previous := build.Annotations[openshift.PreviousToken]
+	if previous == "" || token != previous {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, build.Annotations[openshift.PreviousTokenExpires])
+	if err != nil {
+		return false
+	}
+	return time.Now().Before(expires)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func rotateToken(t *testing.T, env *testEnv) rotatedToken {
+	rec := env.do("POST", "/android-1/rotate-token", map[string]string{"Authorization": "Bearer admin"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d rotating the token but got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var rotated rotatedToken
+	if err := json.Unmarshal(rec.Body.Bytes(), &rotated); err != nil {
+		t.Fatal("error decoding rotated token " + err.Error())
+	}
+	if rotated.Token == "" || rotated.Token == testToken {
+		t.Fatalf("expected a new token but got %q", rotated.Token)
+	}
+	return rotated
+}
+
+func TestRotateTokenRequiresAdmin(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	if rec := env.do("POST", "/android-1/rotate-token", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected rotating without admin token to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("POST", "/missing/rotate-token", map[string]string{"Authorization": "Bearer admin"}); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a missing build but got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestRotateTokenImmediate(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.DownloadProxyUri: "https://proxy.example.com/android-1/download?token=" + testToken})
+
+	rotated := rotateToken(t, env)
+	if rotated.PreviousTokenExpires != "" {
+		t.Fatalf("expected no grace window by default but got %q", rotated.PreviousTokenExpires)
+	}
+	if expected := "https://proxy.example.com/android-1/download?token=" + rotated.Token; rotated.DownloadUrl != expected {
+		t.Fatalf("expected download url %q but got %q", expected, rotated.DownloadUrl)
+	}
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected old token to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/download?token="+rotated.Token, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected new token to be accepted, got status %d", rec.Code)
+	}
+}
+
+func TestRotateTokenGrace(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	defer setEnv("TOKEN_ROTATION_GRACE_SECONDS", "3600")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+
+	rotated := rotateToken(t, env)
+	if rotated.PreviousTokenExpires == "" {
+		t.Fatal("expected the old token to have an expiry")
+	}
+	for _, token := range []string{testToken, rotated.Token} {
+		if rec := env.do("GET", "/android-1/download?token="+token, nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected token %q to be accepted within the grace window, got status %d", token, rec.Code)
+		}
+	}
+
+	env.lock.Lock()
+	env.builds["android-1"].Annotations[openshift.PreviousTokenExpires] = time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	env.lock.Unlock()
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected old token to be refused after the grace window, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/download?token="+rotated.Token, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected new token to still be accepted, got status %d", rec.Code)
+	}
+
+	rotateToken(t, env)
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a token from two rotations ago to be refused, got status %d", rec.Code)
+	}
+}
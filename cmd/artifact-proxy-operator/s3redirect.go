@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/s3"
+)
+
+const defaultPresignTTL = 60 * time.Second
+
+func isS3Location(location string) bool {
+	return strings.HasPrefix(location, "s3://")
+}
+
+//presignTTL reads S3_PRESIGN_TTL_SECONDS, how long a presigned S3 url stays valid. It is kept short as the url is
+//a credential for the artifact in its own right
+func presignTTL() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("S3_PRESIGN_TTL_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultPresignTTL
+}
+
+//handleS3Redirect sends the client to a presigned url for an artifact stored in S3 rather than streaming it through
+//the proxy. The url has S3 respond with the filename and content type the proxy would have used, so the browser
+//saves the download the same way
+func handleS3Redirect(rw http.ResponseWriter, a artifact) {
+	bucket, key, err := s3.ParseLocation(a.url)
+	if err != nil {
+		log.Printf("invalid artifact location for %s: %s", a.cacheKey, err.Error())
+		httpError(rw, "invalid artifact location on build object", http.StatusInternalServerError)
+		return
+	}
+	presigner, err := s3.NewPresignerFromEnv()
+	if err != nil {
+		log.Printf("unable to presign artifact url for %s: %s", a.cacheKey, err.Error())
+		httpError(rw, "error when redirecting to artifact", http.StatusInternalServerError)
+		return
+	}
+	params := url.Values{"response-content-disposition": {contentDisposition("attachment", a.filename)}}
+	if a.contentType != "" {
+		params.Set("response-content-type", a.contentType)
+	}
+	location, err := presigner.PresignGet(bucket, key, presignTTL(), params)
+	if err != nil {
+		log.Printf("unable to presign artifact url for %s: %s", a.cacheKey, err.Error())
+		httpError(rw, "error when redirecting to artifact", http.StatusInternalServerError)
+		return
+	}
+	recordDownload(a, 0, nil)
+	for k, v := range a.metadata {
+		rw.Header()[k] = v
+	}
+	// the url grants access on its own, it must not be stored
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Location", location)
+	rw.WriteHeader(http.StatusFound)
+}
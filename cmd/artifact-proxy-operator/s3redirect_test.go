@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestS3Redirect(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: "s3://builds/app/1/app-release.apk"})
+	defer setEnv("AWS_ACCESS_KEY_ID", "key")()
+	defer setEnv("AWS_SECRET_ACCESS_KEY", "secret")()
+	defer setEnv("S3_REGION", "eu-west-1")()
+	defer setEnv("S3_PRESIGN_TTL_SECONDS", "30")()
+
+	if rec := env.do("GET", "/android-1/download", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected the token to be checked before redirecting, got status %d", rec.Code)
+	}
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected status %d but got %d", http.StatusFound, rec.Code)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect location %v", err)
+	}
+	if location.Host != "builds.s3.eu-west-1.amazonaws.com" || location.Path != "/app/1/app-release.apk" {
+		t.Fatalf("expected a redirect to the object but got %s", location)
+	}
+	query := location.Query()
+	if cd := query.Get("response-content-disposition"); cd != `attachment; filename="android-1.apk"` {
+		t.Fatalf("expected the presigned url to set the download filename but got %q", cd)
+	}
+	if ct := query.Get("response-content-type"); ct != binaryContentType {
+		t.Fatalf("expected the presigned url to set the content type but got %q", ct)
+	}
+	if query.Get("X-Amz-Expires") != "30" || query.Get("X-Amz-Signature") == "" {
+		t.Fatalf("expected a signed url valid for 30 seconds but got %s", location)
+	}
+	if !strings.Contains(rec.Header().Get("Cache-Control"), "no-store") {
+		t.Fatal("expected the redirect not to be cached")
+	}
+}
+
+func TestS3RedirectWithoutCredentials(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: "s3://builds/app-release.apk"})
+	defer setEnv("AWS_ACCESS_KEY_ID", "")()
+
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d without credentials but got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	shutdownTimeout = 30 * time.Second
+	//defaultReadHeaderTimeout is how long a client has to send its request headers when READ_HEADER_TIMEOUT_SECONDS
+	//is not set
+	defaultReadHeaderTimeout = 10 * time.Second
+	//defaultConnectionIdleTimeout is how long a keep-alive connection may sit idle when
+	//CONNECTION_IDLE_TIMEOUT_SECONDS is not set
+	defaultConnectionIdleTimeout = 120 * time.Second
+)
+
+//newListener listens on the unix socket at ARTIFACT_PROXY_UNIX_SOCKET when set, e.g. to only be reachable from a pod
+//sharing the socket, otherwise on the TCP port from ARTIFACT_PROXY_OPERATOR_SERVICE_PORT (default 8080). The address
+//listened on is returned for logging. Either listener keeps at most MAX_CONNECTIONS connections open
+func newListener() (net.Listener, string, error) {
+	if socket := os.Getenv("ARTIFACT_PROXY_UNIX_SOCKET"); socket != "" {
+		// a socket file left behind by a previous run would make listening fail
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return nil, socket, err
+		}
+		// closing the listener removes the socket file again
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			return nil, socket, err
+		}
+		return limitConnections(l, maxConnections(), rejectExcessConnections()), socket, nil
+	}
+	listen := os.Getenv("ARTIFACT_PROXY_OPERATOR_SERVICE_PORT")
+	if len(listen) == 0 {
+		listen = ":8080"
+	} else {
+		listen = ":" + listen
+	}
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, listen, err
+	}
+	return limitConnections(l, maxConnections(), rejectExcessConnections()), listen, nil
+}
+
+//readHeaderTimeout reads READ_HEADER_TIMEOUT_SECONDS, how long a connection may take to send the headers of a request
+func readHeaderTimeout() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("READ_HEADER_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultReadHeaderTimeout
+}
+
+//connectionIdleTimeout reads CONNECTION_IDLE_TIMEOUT_SECONDS, how long a keep-alive connection may wait for its next
+//request
+func connectionIdleTimeout() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("CONNECTION_IDLE_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultConnectionIdleTimeout
+}
+
+//newServer creates a server for handler which closes connections that are slow to send a request or sit idle, so
+//neither can hold one of the MAX_CONNECTIONS slots for ever. There is no write timeout as downloads may stream for long
+func newServer(handler http.Handler) *http.Server {
+	return &http.Server{Handler: handler, ReadHeaderTimeout: readHeaderTimeout(), IdleTimeout: connectionIdleTimeout()}
+}
+
+//notifyShutdown returns the channel the signals asking the process to terminate arrive on
+func notifyShutdown() chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	return signals
+}
+
+//shutdownOnSignal stops the servers when a signal arrives, letting in flight requests finish and closing their
+//listeners. done is closed once they have been, Serve returns as soon as the shutdown starts so the process must wait
+//on done before exiting
+func shutdownOnSignal(signals chan os.Signal, done chan struct{}, servers ...*http.Server) {
+	defer close(done)
+	<-signals
+	signal.Stop(signals)
+	log.Printf("shutting down http server")
+	shutdown(shutdownTimeout, servers...)
+}
+
+//shutdown stops the servers accepting requests and waits up to grace for active downloads to finish streaming, then
+//closes whatever connections are left
+func shutdown(grace time.Duration, servers ...*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil && err != context.DeadlineExceeded {
+				log.Printf("error shutting down http server %s", err.Error())
+			}
+		}(server)
+	}
+	streamsDone := activeStreams.wait(ctx) == nil
+	wg.Wait()
+	if !streamsDone || ctx.Err() != nil {
+		log.Printf("shutdown grace period of %s is over with %d download streams still active, closing them", grace, activeStreams.count())
+		for _, server := range servers {
+			server.Close()
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestUnixSocketListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifact-proxy-socket")
+	if err != nil {
+		t.Fatal("error creating temp dir " + err.Error())
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "proxy.sock")
+	defer setEnv("ARTIFACT_PROXY_UNIX_SOCKET", socket)()
+
+	listener, addr, err := newListener()
+	if err != nil {
+		t.Fatal("error listening " + err.Error())
+	}
+	if addr != socket || listener.Addr().Network() != "unix" {
+		t.Fatalf("expected to listen on unix socket %s but got %s %s", socket, listener.Addr().Network(), addr)
+	}
+	server := &http.Server{Handler: newRouter()}
+	go server.Serve(listener)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	res, err := client.Get("http://proxy/healthz")
+	if err != nil {
+		t.Fatal("error fetching /healthz over the socket " + err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, res.StatusCode)
+	}
+
+	server.Shutdown(context.Background())
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatal("expected the socket file to be removed on shutdown")
+	}
+}
+
+func TestTcpListenerIsDefault(t *testing.T) {
+	defer setEnv("ARTIFACT_PROXY_OPERATOR_SERVICE_PORT", "0")()
+	listener, addr, err := newListener()
+	if err != nil {
+		t.Fatal("error listening " + err.Error())
+	}
+	defer listener.Close()
+	if addr != ":0" || listener.Addr().Network() != "tcp" {
+		t.Fatalf("expected a tcp listener but got %s %s", listener.Addr().Network(), addr)
+	}
+}
+
+//streamResult is what the client of a stream started by startStream got
+type streamResult struct {
+	body string
+	err  error
+}
+
+//startStream starts a download through a real server whose upstream sends the first bytes of the artifact and then
+//holds the stream open until release is closed. What the client got arrives on the returned channel
+func startStream(t *testing.T, env *testEnv, release chan struct{}) (*http.Server, chan streamResult, func()) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(testArtifact))
+		rw.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/artifact"})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("error listening " + err.Error())
+	}
+	server := &http.Server{Handler: newRouter()}
+	go server.Serve(listener)
+
+	responses := make(chan streamResult, 1)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String() + "/android-1/download?token=" + testToken)
+		if err == nil {
+			var body []byte
+			body, err = ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			responses <- streamResult{body: string(body), err: err}
+			return
+		}
+		responses <- streamResult{err: err}
+	}()
+	// the first bytes may sit in the server's write buffer, so wait for the stream to be tracked instead
+	deadline := time.Now().Add(5 * time.Second)
+	for activeStreams.count() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if active := activeStreams.count(); active != 1 {
+		t.Fatalf("expected 1 active stream but got %d", active)
+	}
+	return server, responses, func() {
+		server.Close()
+		upstream.Close()
+	}
+}
+
+//shutdownAsync runs shutdown in the background, the returned channel is closed once it has returned
+func shutdownAsync(grace time.Duration, server *http.Server) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		shutdown(grace, server)
+		close(done)
+	}()
+	return done
+}
+
+func TestShutdownWaitsForStreams(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	release := make(chan struct{})
+	server, responses, cleanup := startStream(t, env, release)
+	defer cleanup()
+
+	started := time.Now()
+	done := shutdownAsync(5*time.Second, server)
+	select {
+	case <-done:
+		t.Fatal("expected shutdown to wait for the active stream")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected shutdown to return once the stream finished")
+	}
+	if elapsed := time.Since(started); elapsed > 4*time.Second {
+		t.Fatalf("expected shutdown to return before the grace period was over but it took %s", elapsed)
+	}
+	if result := <-responses; result.err != nil || result.body != testArtifact {
+		t.Fatalf("expected the download to finish cleanly but got %q, %v", result.body, result.err)
+	}
+}
+
+func TestShutdownClosesStreamsAfterGrace(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	release := make(chan struct{})
+	defer close(release)
+	server, responses, cleanup := startStream(t, env, release)
+	defer cleanup()
+
+	logs, restore := captureLog()
+	defer restore()
+	grace := 200 * time.Millisecond
+	started := time.Now()
+	select {
+	case <-shutdownAsync(grace, server):
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected shutdown to return once the grace period was over")
+	}
+	if elapsed := time.Since(started); elapsed < grace {
+		t.Fatalf("expected shutdown to wait out the grace period of %s but it took %s", grace, elapsed)
+	}
+	if !strings.Contains(logs.String(), "1 download streams still active") {
+		t.Fatalf("expected the streams still active to be logged but got %s", logs.String())
+	}
+	if result := <-responses; result.err == nil {
+		t.Fatalf("expected the download to be cut off once the grace period was over but got %q", result.body)
+	}
+}
+
+func TestShutdownWithoutStreams(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("error listening " + err.Error())
+	}
+	server := &http.Server{Handler: newRouter()}
+	go server.Serve(listener)
+
+	started := time.Now()
+	shutdown(5*time.Second, server)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("expected shutdown without active streams to be quick but it took %s", elapsed)
+	}
+}
+
+func TestServeHttpDrainsStreamsOnSignal(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(testArtifact))
+		rw.(http.Flusher).Flush()
+		<-release
+	}))
+	defer upstream.Close()
+	env.addBuild("android-1", "android", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/artifact"})
+	dir, err := ioutil.TempDir("", "artifact-proxy-socket")
+	if err != nil {
+		t.Fatal("error creating temp dir " + err.Error())
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "proxy.sock")
+	defer setEnv("ARTIFACT_PROXY_UNIX_SOCKET", socket)()
+
+	served := make(chan struct{})
+	go func() {
+		serveHttp()
+		close(served)
+	}()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	// the signal handler is in place once the socket is served
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res, err := client.Get("http://proxy/healthz")
+		if err == nil {
+			res.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected serveHttp to serve on the socket but got " + err.Error())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	responses := make(chan streamResult, 1)
+	go func() {
+		res, err := client.Get("http://proxy/android-1/download?token=" + testToken)
+		if err != nil {
+			responses <- streamResult{err: err}
+			return
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		responses <- streamResult{body: string(body), err: err}
+	}()
+	for activeStreams.count() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal("error signalling the process " + err.Error())
+	}
+	select {
+	case <-served:
+		t.Fatal("expected serveHttp to wait for the active stream before returning")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected serveHttp to return once the stream finished")
+	}
+	if result := <-responses; result.err != nil || result.body != testArtifact {
+		t.Fatalf("expected the download to finish cleanly but got %q, %v", result.body, result.err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"os"
+)
+
+//withServerHeader sets the Server header on every response to SERVER_HEADER. When SERVER_HEADER is set but empty
+//the header is removed instead, and when it is not set at all responses are left as they are
+func withServerHeader(next http.Handler) http.Handler {
+	value, ok := os.LookupEnv("SERVER_HEADER")
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&serverHeaderWriter{ResponseWriter: rw, value: value}, r)
+	})
+}
+
+//serverHeaderWriter applies the Server header as the response is written, so a header set by a handler is replaced too
+type serverHeaderWriter struct {
+	http.ResponseWriter
+	value   string
+	written bool
+}
+
+func (w *serverHeaderWriter) apply() {
+	if w.written {
+		return
+	}
+	w.written = true
+	if w.value == "" {
+		w.Header().Del("Server")
+		return
+	}
+	w.Header().Set("Server", w.value)
+}
+
+func (w *serverHeaderWriter) WriteHeader(status int) {
+	w.apply()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *serverHeaderWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+//Unwrap lets http.ResponseController reach the underlying writer
+func (w *serverHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *serverHeaderWriter) Flush() {
+	w.apply()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
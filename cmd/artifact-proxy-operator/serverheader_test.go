@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestServerHeader(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", nil)
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Server", "Go")
+		rw.WriteHeader(http.StatusOK)
+	})
+	os.Unsetenv("SERVER_HEADER")
+
+	rec := httptest.NewRecorder()
+	withServerHeader(handler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Header().Get("Server") != "Go" {
+		t.Fatalf("expected responses to be left alone without SERVER_HEADER but got %q", rec.Header().Get("Server"))
+	}
+
+	defer setEnv("SERVER_HEADER", "artifact-proxy")()
+	for _, target := range []string{"/android-1/download?token=" + testToken, "/missing/download?token=" + testToken, "/healthz"} {
+		rec = httptest.NewRecorder()
+		withServerHeader(newRouter()).ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Header().Get("Server") != "artifact-proxy" {
+			t.Errorf("expected Server header on %s but got %q", target, rec.Header().Get("Server"))
+		}
+	}
+
+	os.Setenv("SERVER_HEADER", "")
+	rec = httptest.NewRecorder()
+	withServerHeader(handler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if _, ok := rec.Header()["Server"]; ok {
+		t.Fatalf("expected an empty SERVER_HEADER to remove the header but got %q", rec.Header().Get("Server"))
+	}
+}
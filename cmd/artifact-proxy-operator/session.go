@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+//sessionStore holds the shared state behind download counts, one time tokens and download limits. Every operation
+//must be atomic so an implementation shared between replicas, e.g. redis, can be swapped in
+type sessionStore interface {
+	//Increment adds one to the counter at key and returns the new value
+	Increment(key string) (int64, error)
+	//Count returns the value of the counter at key, zero if it was never incremented
+	Count(key string) (int64, error)
+	//IncrementWithinLimit adds one to the counter at key unless that would take it past limit. It returns the value of
+	//the counter and whether it was incremented
+	IncrementWithinLimit(key string, limit int64) (int64, bool, error)
+	//MarkUsed records key as used for ttl, or forever when ttl is zero. It returns false if key was already used
+	MarkUsed(key string, ttl time.Duration) (bool, error)
+}
+
+//sessions counts downloads of builds with a download limit, main replaces it when STATE_BACKEND selects a shared
+//store
+var sessions sessionStore = newMemorySessionStore()
+
+//memorySessionStore is a sessionStore local to this process
+type memorySessionStore struct {
+	lock     sync.Mutex
+	counters map[string]int64
+	//used maps keys to when they stop being used, the zero time meaning never
+	used map[string]time.Time
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{counters: map[string]int64{}, used: map[string]time.Time{}}
+}
+
+func (s *memorySessionStore) Increment(key string) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counters[key]++
+	return s.counters[key], nil
+}
+
+func (s *memorySessionStore) Count(key string) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.counters[key], nil
+}
+
+func (s *memorySessionStore) IncrementWithinLimit(key string, limit int64) (int64, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.counters[key] >= limit {
+		return s.counters[key], false, nil
+	}
+	s.counters[key]++
+	return s.counters[key], true, nil
+}
+
+func (s *memorySessionStore) MarkUsed(key string, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if expires, ok := s.used[key]; ok && (expires.IsZero() || time.Now().Before(expires)) {
+		return false, nil
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	s.used[key] = expires
+	return true, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	redisKeyPrefix  = "artifact-proxy:"
+	redisPoolSize   = 10
+	redisIoTimeout  = 5 * time.Second
+	redisIdleExpiry = 4 * time.Minute
+)
+
+//redisLimitScript increments KEYS[1] unless it has reached the limit in ARGV[1], replying with the count and whether
+//it was incremented
+var redisLimitScript = redis.NewScript(1, `local v = tonumber(redis.call('GET', KEYS[1]) or '0')
+if v >= tonumber(ARGV[1]) then return {v, 0} end
+return {redis.call('INCR', KEYS[1]), 1}`)
+
+//newSessionStore returns the store selected by STATE_BACKEND. redis shares state between replicas through REDIS_URL,
+//anything else keeps it in memory
+func newSessionStore() (sessionStore, error) {
+	if os.Getenv("STATE_BACKEND") != "redis" {
+		return newMemorySessionStore(), nil
+	}
+	return newRedisSessionStore(os.Getenv("REDIS_URL"))
+}
+
+//redisSessionStore is a sessionStore shared by every replica using the same redis. Each operation is a single redis
+//command or script so it is atomic across replicas
+type redisSessionStore struct {
+	pool *redis.Pool
+}
+
+//newRedisSessionStore creates a store for a redis://[:password@]host:port[/db] url
+func newRedisSessionStore(rawUrl string) (*redisSessionStore, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, errors.New("REDIS_URL must be in the form redis://[:password@]host:port[/db]")
+	}
+	s := &redisSessionStore{pool: &redis.Pool{
+		MaxIdle:     redisPoolSize,
+		IdleTimeout: redisIdleExpiry,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(rawUrl, redis.DialConnectTimeout(redisIoTimeout), redis.DialReadTimeout(redisIoTimeout), redis.DialWriteTimeout(redisIoTimeout))
+		},
+	}}
+	// fail at startup rather than on the first download
+	if _, err := s.do("PING"); err != nil {
+		s.pool.Close()
+		return nil, errors.New("error connecting to redis " + err.Error())
+	}
+	return s, nil
+}
+
+func (s *redisSessionStore) Increment(key string) (int64, error) {
+	return redis.Int64(s.do("INCR", redisKeyPrefix+key))
+}
+
+func (s *redisSessionStore) Count(key string) (int64, error) {
+	count, err := redis.Int64(s.do("GET", redisKeyPrefix+key))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (s *redisSessionStore) IncrementWithinLimit(key string, limit int64) (int64, bool, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	values, err := redis.Int64s(redisLimitScript.Do(conn, redisKeyPrefix+key, limit))
+	if err != nil {
+		return 0, false, err
+	}
+	if len(values) != 2 {
+		return 0, false, errors.New("unexpected reply from redis to the limit script")
+	}
+	return values[0], values[1] == 1, nil
+}
+
+func (s *redisSessionStore) MarkUsed(key string, ttl time.Duration) (bool, error) {
+	args := []interface{}{redisKeyPrefix + key, 1, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	_, err := redis.String(s.do("SET", args...))
+	if err == redis.ErrNil {
+		// SET NX replies with nil when the key already existed
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *redisSessionStore) do(command string, args ...interface{}) (interface{}, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	return conn.Do(command, args...)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+//newTestRedis starts a miniredis server for a test, the returned func stops it
+func newTestRedis(t *testing.T) (string, func()) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("error starting redis " + err.Error())
+	}
+	return "redis://" + server.Addr(), server.Close
+}
+
+func TestRedisSessionStore(t *testing.T) {
+	redisUrl, stop := newTestRedis(t)
+	defer stop()
+	store, err := newRedisSessionStore(redisUrl)
+	if err != nil {
+		t.Fatal("error creating store " + err.Error())
+	}
+	testSessionStore(t, store)
+}
+
+func TestRedisSessionStoreSharedBetweenInstances(t *testing.T) {
+	redisUrl, stop := newTestRedis(t)
+	defer stop()
+	first, err := newRedisSessionStore(redisUrl)
+	if err != nil {
+		t.Fatal("error creating store " + err.Error())
+	}
+	second, err := newRedisSessionStore(redisUrl)
+	if err != nil {
+		t.Fatal("error creating store " + err.Error())
+	}
+
+	first.Increment("downloads")
+	second.Increment("downloads")
+	if count, _ := first.Count("downloads"); count != 2 {
+		t.Fatalf("expected increments from both instances to be counted but got %d", count)
+	}
+	if ok, _ := first.MarkUsed("one-time", time.Minute); !ok {
+		t.Fatal("expected first use of a one time token to succeed")
+	}
+	if ok, _ := second.MarkUsed("one-time", time.Minute); ok {
+		t.Fatal("expected a one time token used by another instance to be refused")
+	}
+	if _, ok, _ := first.IncrementWithinLimit("limited", 1); !ok {
+		t.Fatal("expected increment within the limit to succeed")
+	}
+	if count, ok, _ := second.IncrementWithinLimit("limited", 1); ok || count != 1 {
+		t.Fatalf("expected the limit reached through another instance to hold, got %d %v", count, ok)
+	}
+}
+
+func TestRedisSessionStoreExpiry(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("error starting redis " + err.Error())
+	}
+	defer server.Close()
+	store, err := newRedisSessionStore("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal("error creating store " + err.Error())
+	}
+	if ok, _ := store.MarkUsed("token", time.Minute); !ok {
+		t.Fatal("expected first use to succeed")
+	}
+	if ok, _ := store.MarkUsed("token", time.Minute); ok {
+		t.Fatal("expected second use within the ttl to fail")
+	}
+	server.FastForward(2 * time.Minute)
+	if ok, err := store.MarkUsed("token", time.Minute); !ok || err != nil {
+		t.Fatalf("expected use after the ttl to succeed, got %v %v", ok, err)
+	}
+}
+
+func TestNewSessionStore(t *testing.T) {
+	store, err := newSessionStore()
+	if err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	if _, ok := store.(*memorySessionStore); !ok {
+		t.Fatalf("expected the in memory store by default but got %T", store)
+	}
+
+	defer setEnv("STATE_BACKEND", "redis")()
+	defer setEnv("REDIS_URL", "http://not-redis")()
+	if _, err := newSessionStore(); err == nil {
+		t.Fatal("expected an invalid REDIS_URL to be rejected")
+	}
+}
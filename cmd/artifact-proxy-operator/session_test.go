@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//testSessionStore runs the behaviour every sessionStore must have against store, concurrently so that running with
+//-race also checks the implementation is safe to share
+func testSessionStore(t *testing.T, store sessionStore) {
+	const workers = 50
+	var wg sync.WaitGroup
+	var incremented, marked int32
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.Increment("downloads"); err != nil {
+				t.Error("unexpected error " + err.Error())
+			}
+			if _, ok, _ := store.IncrementWithinLimit("limited", 10); ok {
+				atomic.AddInt32(&incremented, 1)
+			}
+			if ok, _ := store.MarkUsed("one-time", 0); ok {
+				atomic.AddInt32(&marked, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count, _ := store.Count("downloads"); count != workers {
+		t.Errorf("expected %d downloads to be counted but got %d", workers, count)
+	}
+	if count, _ := store.Count("limited"); count != 10 || incremented != 10 {
+		t.Errorf("expected the limited counter to stop at 10 but it is %d after %d increments", count, incremented)
+	}
+	if marked != 1 {
+		t.Errorf("expected exactly one use of a one time key but got %d", marked)
+	}
+	if count, _ := store.Count("never-touched"); count != 0 {
+		t.Errorf("expected unknown counters to be zero but got %d", count)
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	testSessionStore(t, newMemorySessionStore())
+}
+
+func TestMemorySessionStoreExpiry(t *testing.T) {
+	store := newMemorySessionStore()
+	if ok, _ := store.MarkUsed("token", 20*time.Millisecond); !ok {
+		t.Fatal("expected first use to succeed")
+	}
+	if ok, _ := store.MarkUsed("token", 20*time.Millisecond); ok {
+		t.Fatal("expected second use within the ttl to fail")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := store.MarkUsed("token", 20*time.Millisecond); !ok {
+		t.Fatal("expected use after the ttl to succeed")
+	}
+}
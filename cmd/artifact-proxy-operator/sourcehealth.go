@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/metrics"
+)
+
+const (
+	defaultSourceProbeInterval = 30 * time.Second
+	//minSourceProbeInterval keeps a low SOURCE_PROBE_INTERVAL_SECONDS from hammering the sources
+	minSourceProbeInterval = 5 * time.Second
+	sourceProbeTimeout     = 5 * time.Second
+)
+
+var sourceReachable = metrics.NewGaugeVec("artifact_source_reachable",
+	"Whether each source in SOURCE_PROBES answered its last probe, 1 when it did.", "source")
+
+//sourceProbe is a source artifacts are fetched from and the url probed to see whether it is reachable
+type sourceProbe struct {
+	name string
+	url  string
+}
+
+//sourceProbes reads SOURCE_PROBES, a comma separated list of name=url of the sources artifacts are fetched from e.g.
+//jenkins=https://jenkins.example.com/login,s3=https://s3.eu-west-1.amazonaws.com. Invalid entries are logged and ignored
+func sourceProbes() []sourceProbe {
+	var probes []sourceProbe
+	for _, entry := range splitList(os.Getenv("SOURCE_PROBES")) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			log.Printf("ignoring invalid SOURCE_PROBES entry %q", redactRawUrl(entry))
+			continue
+		}
+		if u, err := url.Parse(parts[1]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("ignoring SOURCE_PROBES entry %s, its url is not an absolute http(s) url", parts[0])
+			continue
+		}
+		probes = append(probes, sourceProbe{name: parts[0], url: parts[1]})
+	}
+	return probes
+}
+
+//sourceProbeInterval is SOURCE_PROBE_INTERVAL_SECONDS, how long the result of a probe is used before the source is
+//probed again (default 30, at least 5)
+func sourceProbeInterval() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("SOURCE_PROBE_INTERVAL_SECONDS"))
+	if err != nil || seconds <= 0 {
+		return defaultSourceProbeInterval
+	}
+	if interval := time.Duration(seconds) * time.Second; interval > minSourceProbeInterval {
+		return interval
+	}
+	return minSourceProbeInterval
+}
+
+//sourceStatus is the result of the last probe of a source
+type sourceStatus struct {
+	Reachable bool      `json:"reachable"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+//sourceHealth caches the reachability of each source, so however often it is asked a source is probed at most once
+//per interval
+type sourceHealth struct {
+	lock    sync.Mutex
+	client  *http.Client
+	status  map[string]sourceStatus
+	probing map[string]bool
+}
+
+var sourceChecks = newSourceHealth()
+
+func newSourceHealth() *sourceHealth {
+	return &sourceHealth{client: &http.Client{Timeout: sourceProbeTimeout}, status: map[string]sourceStatus{}, probing: map[string]bool{}}
+}
+
+//refresh probes the sources whose last result is older than interval and waits for them, a source already being
+//probed by another caller is left to it
+func (h *sourceHealth) refresh(probes []sourceProbe, interval time.Duration) {
+	var wg sync.WaitGroup
+	h.lock.Lock()
+	for _, p := range probes {
+		last, ok := h.status[p.name]
+		if h.probing[p.name] || (ok && time.Since(last.CheckedAt) < interval) {
+			continue
+		}
+		h.probing[p.name] = true
+		wg.Add(1)
+		go func(p sourceProbe) {
+			defer wg.Done()
+			status := h.probe(p)
+			if status.Reachable {
+				sourceReachable.Set(1, p.name)
+			} else {
+				log.Printf("artifact source %s is unreachable: %s", p.name, status.Error)
+				sourceReachable.Set(0, p.name)
+			}
+			h.lock.Lock()
+			defer h.lock.Unlock()
+			h.status[p.name] = status
+			delete(h.probing, p.name)
+		}(p)
+	}
+	h.lock.Unlock()
+	wg.Wait()
+}
+
+//probe sends a HEAD request to the source. Any answer short of a server error means it is reachable, a 401 or 404
+//still shows the service is up
+func (h *sourceHealth) probe(p sourceProbe) sourceStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), sourceProbeTimeout)
+	defer cancel()
+	status := sourceStatus{CheckedAt: time.Now()}
+	req, err := http.NewRequest(http.MethodHead, p.url, nil)
+	if err != nil {
+		status.Error = sanitizeErrorMessage(err.Error())
+		return status
+	}
+	res, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		status.Error = sanitizeErrorMessage(err.Error())
+		return status
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		status.Error = "responded " + res.Status
+		return status
+	}
+	status.Reachable = true
+	return status
+}
+
+//snapshot returns the last result of every source which has been probed
+func (h *sourceHealth) snapshot() map[string]sourceStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	snapshot := make(map[string]sourceStatus, len(h.status))
+	for name, status := range h.status {
+		snapshot[name] = status
+	}
+	return snapshot
+}
+
+//watchSources probes the sources in SOURCE_PROBES every interval until stop is closed, keeping their metrics current
+func watchSources(probes []sourceProbe, stop <-chan struct{}) {
+	interval := sourceProbeInterval()
+	sourceChecks.refresh(probes, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			sourceChecks.refresh(probes, interval)
+		}
+	}
+}
+
+//writeSourceDetail answers /readyz?verbose=true with the reachability of each source. A source being down does not
+//make the operator unready, other sources and the cache may still serve, the detail is there to tell which one it is
+func writeSourceDetail(rw http.ResponseWriter, cacheErr error) {
+	sourceChecks.refresh(sourceProbes(), sourceProbeInterval())
+	detail := struct {
+		Ready   bool                    `json:"ready"`
+		Cache   string                  `json:"cache,omitempty"`
+		Sources map[string]sourceStatus `json:"sources"`
+	}{Ready: cacheErr == nil, Sources: sourceChecks.snapshot()}
+	if cacheErr != nil {
+		detail.Cache = cacheErr.Error()
+	}
+	rw.Header().Set("content-type", "application/json")
+	if cacheErr != nil {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(rw).Encode(detail)
+}
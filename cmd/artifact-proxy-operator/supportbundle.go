@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//maxDownloadAttempts is how many of the latest download attempts, across all builds, are kept for support bundles
+const maxDownloadAttempts = 200
+
+//redactedAnnotations hold download tokens, their values are never put in a support bundle
+var redactedAnnotations = []string{openshift.ArtifactDownloadToken, openshift.PreviousToken, openshift.StreamToken}
+
+//downloadAttempt is a download of an artifact, successful or not, as shown in a support bundle
+type downloadAttempt struct {
+	Time     time.Time `json:"time"`
+	build    string
+	CacheKey string `json:"artifact"`
+	Bytes    int64  `json:"bytes"`
+	Error    string `json:"error,omitempty"`
+}
+
+//downloadAttemptLog keeps the latest download attempts in a ring, so it stays the same size however many builds are
+//downloaded
+type downloadAttemptLog struct {
+	lock     sync.Mutex
+	attempts []downloadAttempt
+	next     int
+}
+
+var downloadAttempts = &downloadAttemptLog{}
+
+func (l *downloadAttemptLog) record(attempt downloadAttempt) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.attempts) < maxDownloadAttempts {
+		l.attempts = append(l.attempts, attempt)
+		return
+	}
+	l.attempts[l.next] = attempt
+	l.next = (l.next + 1) % maxDownloadAttempts
+}
+
+//forBuild returns the attempts kept for a build, oldest first
+func (l *downloadAttemptLog) forBuild(build string) []downloadAttempt {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	found := []downloadAttempt{}
+	for i := range l.attempts {
+		attempt := l.attempts[(l.next+i)%len(l.attempts)]
+		if attempt.build == build {
+			found = append(found, attempt)
+		}
+	}
+	return found
+}
+
+type supportBundle struct {
+	Build       string            `json:"build"`
+	Namespace   string            `json:"namespace"`
+	Phase       string            `json:"phase"`
+	BuildType   string            `json:"buildType"`
+	ArtifactUrl string            `json:"artifactUrl,omitempty"`
+	Annotations map[string]string `json:"annotations"`
+	Labels      map[string]string `json:"labels"`
+	Config      supportConfig     `json:"config"`
+	Cache       supportCache      `json:"cache"`
+	Prewarm     *prewarmStatus    `json:"prewarm,omitempty"`
+	Downloads   []downloadAttempt `json:"downloads"`
+}
+
+//supportConfig is how the proxy treats the build once its annotations and the operator settings are resolved
+type supportConfig struct {
+	NoCache       bool     `json:"noCache"`
+	TokenExpired  bool     `json:"tokenExpired"`
+	AllowedGroups []string `json:"allowedGroups,omitempty"`
+	DownloadLimit int64    `json:"downloadLimit,omitempty"`
+	DownloadCount int64    `json:"downloadCount"`
+}
+
+type supportCache struct {
+	Enabled  bool   `json:"enabled"`
+	Cached   bool   `json:"cached"`
+	Size     int64  `json:"size,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+//supportBundleHandler serves GET /<build>/support-bundle to admins, everything the proxy knows about a build for
+//triaging a failed download: its resolved configuration, cache status and its latest download attempts. Tokens are
+//redacted and urls are reduced to their scheme, host and path
+func supportBundleHandler(rw http.ResponseWriter, r *http.Request) {
+	if !isAdminRequest(r) {
+		httpError(rw, "admin authorization required", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpError(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	buildName, err := buildNameFromPath(r.URL.Path)
+	if err != nil {
+		httpError(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	build, err := osClient.GetBuildContext(r.Context(), buildName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			httpError(rw, fmt.Sprintf("no resources found for build %s", buildName), http.StatusNotFound)
+			return
+		}
+		httpError(rw, fmt.Sprintf("error fetching build %s", buildName), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("content-type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(newSupportBundle(r, build))
+}
+
+func newSupportBundle(r *http.Request, build *apibuildv1.Build) supportBundle {
+	bundle := supportBundle{
+		Build:       build.Name,
+		Namespace:   build.Namespace,
+		Phase:       string(osClient.GetBuildPhase(build)),
+		Annotations: redactAnnotations(build.Annotations),
+		Labels:      build.Labels,
+		Downloads:   downloadAttempts.forBuild(build.Name),
+	}
+	if buildType, err := osClient.GetBuildTypeContext(r.Context(), build); err == nil {
+		bundle.BuildType = resolveBuildType(build.Name, buildType)
+	}
+	if artifactUrl, ok := buildArtifactUrl(build); ok {
+		bundle.ArtifactUrl = redactRawUrl(artifactUrl)
+	}
+	groups, _ := allowedGroups(build)
+	bundle.Config = supportConfig{
+		NoCache:       isNoCache(build),
+		TokenExpired:  tokenExpired(build),
+		AllowedGroups: groups,
+		DownloadLimit: downloadLimit(build),
+	}
+	bundle.Config.DownloadCount, _ = sessions.Count(downloadCountKey(build))
+	if artifactCache != nil {
+		bundle.Cache = supportCache{Enabled: true, Cached: artifactCache.Has(build.Name), Filename: artifactCache.Filename(build.Name)}
+		bundle.Cache.Size, _ = artifactCache.Size(build.Name)
+	}
+	if status, ok := prewarms.get(build.Name); ok {
+		bundle.Prewarm = &status
+	}
+	return bundle
+}
+
+//redactAnnotations copies annotations, hiding download tokens and reducing urls, which may carry credentials, to their
+//scheme, host and path
+func redactAnnotations(annotations map[string]string) map[string]string {
+	redacted := map[string]string{}
+	for k, v := range annotations {
+		if strings.Contains(v, "://") {
+			v = redactRawUrl(v)
+		}
+		redacted[k] = redactValue(k, redactedAnnotations, v)
+	}
+	return redacted
+}
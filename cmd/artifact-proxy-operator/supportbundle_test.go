@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestSupportBundle(t *testing.T) {
+	defer setEnv("ADMIN_TOKEN", "admin")()
+	defer useMemorySessions()()
+	defer enableCache(t)()
+	downloadAttempts = &downloadAttemptLog{}
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{
+		openshift.JenkinsArtifactUri: strings.Replace(env.jenkins.URL, "http://", "http://jenkins:secret@", 1) + "/artifact/android-1?token=jenkins-secret",
+		openshift.PreviousToken:      "previous-secret",
+		openshift.MaxDownloads:       "5",
+	})
+	env.addBuild("android-2", "android", nil)
+	admin := map[string]string{"Authorization": "Bearer admin"}
+
+	if rec := env.do("GET", "/android-1/support-bundle", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a support bundle to need admin authorization, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/support-bundle?token="+testToken, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a download token not to be enough for a support bundle, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/missing/support-bundle", admin); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a missing build but got %d", http.StatusNotFound, rec.Code)
+	}
+
+	env.do("GET", "/android-1/download?token="+testToken, nil)
+	env.do("GET", "/android-2/download?token="+testToken, nil)
+	rec := env.do("GET", "/android-1/support-bundle", admin)
+	if rec.Code != http.StatusOK || rec.Header().Get("content-type") != "application/json" {
+		t.Fatalf("expected a JSON support bundle but got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, secret := range []string{testToken, "previous-secret", "jenkins-secret", "jenkins:secret"} {
+		if strings.Contains(body, secret) {
+			t.Fatalf("expected %s to be redacted from the support bundle but got %s", secret, body)
+		}
+	}
+
+	var bundle supportBundle
+	if err := json.Unmarshal(rec.Body.Bytes(), &bundle); err != nil {
+		t.Fatal("expected valid JSON " + err.Error())
+	}
+	if bundle.Build != "android-1" || bundle.Namespace != testNamespace || bundle.BuildType != "android" {
+		t.Fatalf("unexpected build in support bundle %+v", bundle)
+	}
+	if bundle.Annotations[openshift.ArtifactDownloadToken] != "[redacted]" || bundle.Annotations[openshift.PreviousToken] != "[redacted]" {
+		t.Fatalf("expected the tokens to be redacted but got %v", bundle.Annotations)
+	}
+	expectedUrl := strings.Replace(env.jenkins.URL, "127.0.0.1", "[redacted]@127.0.0.1", 1) + "/artifact/android-1?[redacted]"
+	if bundle.ArtifactUrl != expectedUrl || bundle.Annotations[openshift.JenkinsArtifactUri] != expectedUrl {
+		t.Fatalf("expected the artifact url to be redacted to %s but got %s and %s", expectedUrl, bundle.ArtifactUrl, bundle.Annotations[openshift.JenkinsArtifactUri])
+	}
+	if bundle.Config.DownloadLimit != 5 || bundle.Config.DownloadCount != 1 {
+		t.Fatalf("expected 1 of 5 downloads to be used but got %+v", bundle.Config)
+	}
+	if !bundle.Cache.Enabled || !bundle.Cache.Cached || bundle.Cache.Size != int64(len(testArtifact)) {
+		t.Fatalf("expected the artifact to be shown as cached but got %+v", bundle.Cache)
+	}
+	if len(bundle.Downloads) != 1 || bundle.Downloads[0].Bytes != int64(len(testArtifact)) || bundle.Downloads[0].Error != "" {
+		t.Fatalf("expected only the download of android-1 but got %+v", bundle.Downloads)
+	}
+}
+
+func TestDownloadAttemptLogBounded(t *testing.T) {
+	attemptLog := &downloadAttemptLog{}
+	for i := 0; i < maxDownloadAttempts+10; i++ {
+		attemptLog.record(downloadAttempt{build: "app-1", CacheKey: strconv.Itoa(i)})
+	}
+	attemptLog.record(downloadAttempt{build: "app-2", CacheKey: "other"})
+	attempts := attemptLog.forBuild("app-1")
+	if len(attempts) != maxDownloadAttempts-1 {
+		t.Fatalf("expected %d attempts to be kept but got %d", maxDownloadAttempts-1, len(attempts))
+	}
+	if attempts[0].CacheKey != "11" || attempts[len(attempts)-1].CacheKey != strconv.Itoa(maxDownloadAttempts+9) {
+		t.Fatalf("expected the oldest attempts to be dropped but got %s to %s", attempts[0].CacheKey, attempts[len(attempts)-1].CacheKey)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//tlsConfig builds the server TLS config from TLS_MIN_VERSION (default 1.2) and TLS_CIPHER_SUITES, a comma separated
+//list of cipher suite names. Versions before 1.2 and ciphers Go considers insecure are refused
+func tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if min := os.Getenv("TLS_MIN_VERSION"); min != "" {
+		version, ok := tlsVersions[min]
+		if !ok {
+			return nil, errors.New("unsupported or insecure TLS_MIN_VERSION " + min + ", must be 1.2 or 1.3")
+		}
+		config.MinVersion = version
+	}
+
+	names := splitList(os.Getenv("TLS_CIPHER_SUITES"))
+	if len(names) == 0 {
+		return config, nil
+	}
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range names {
+		id, ok := suites[name]
+		if !ok {
+			return nil, errors.New("unknown or insecure cipher suite " + name)
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	return config, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTlsConfigRejectsInsecureSettings(t *testing.T) {
+	for _, min := range []string{"1.0", "1.1", "bogus"} {
+		restore := setEnv("TLS_MIN_VERSION", min)
+		if _, err := tlsConfig(); err == nil {
+			t.Errorf("expected TLS_MIN_VERSION %s to be rejected", min)
+		}
+		restore()
+	}
+
+	defer setEnv("TLS_CIPHER_SUITES", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_RSA_WITH_RC4_128_SHA")()
+	if _, err := tlsConfig(); err == nil {
+		t.Error("expected an insecure cipher suite to be rejected")
+	}
+}
+
+func TestTlsConfigCipherSuites(t *testing.T) {
+	defer setEnv("TLS_CIPHER_SUITES", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384")()
+	config, err := tlsConfig()
+	if err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	if config.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("expected default minimum version TLS 1.2 but got %x", config.MinVersion)
+	}
+	if len(config.CipherSuites) != 2 || config.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Fatalf("unexpected cipher suites %v", config.CipherSuites)
+	}
+}
+
+func TestTlsServerNegotiatesMinimumVersion(t *testing.T) {
+	defer setEnv("TLS_MIN_VERSION", "1.3")()
+	config, err := tlsConfig()
+	if err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	old := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}}}
+	if _, err := old.Get(server.URL); err == nil {
+		t.Fatal("expected a TLS 1.2 client to be refused")
+	}
+
+	client := server.Client()
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	res.Body.Close()
+	if res.TLS.Version < tls.VersionTLS13 {
+		t.Fatalf("expected at least TLS 1.3 to be negotiated but got %x", res.TLS.Version)
+	}
+}
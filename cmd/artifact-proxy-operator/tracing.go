@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+type traceKey struct{}
+
+//traceparent matches a W3C trace context header, capturing the trace id and the trace flags
+var traceparent = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-([0-9a-f]{2})$`)
+
+//exemplarsEnabled attaches the trace of a request to the metrics observed for it when ENABLE_EXEMPLARS is set.
+//Exemplars are only exposed to scrapers asking for the OpenMetrics format
+func exemplarsEnabled() bool {
+	return os.Getenv("ENABLE_EXEMPLARS") == "true"
+}
+
+//withTrace remembers the trace a request is part of, from the traceparent header set by a tracing client or proxy.
+//Only sampled traces are kept, as an exemplar pointing at a trace which was not recorded leads nowhere
+func withTrace(r *http.Request) *http.Request {
+	if !exemplarsEnabled() {
+		return r
+	}
+	match := traceparent.FindStringSubmatch(r.Header.Get("traceparent"))
+	if match == nil || match[1] == "00000000000000000000000000000000" {
+		return r
+	}
+	if flags, _ := strconv.ParseUint(match[2], 16, 8); flags&1 == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), traceKey{}, match[1]))
+}
+
+//traceFromContext returns the id of the sampled trace a request is part of
+func traceFromContext(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceKey{}).(string)
+	return traceID, ok
+}
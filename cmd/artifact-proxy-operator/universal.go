@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/links"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	"github.com/aerogear/artifact-proxy-operator/pkg/plist"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//isUniversalBuildType reports whether builds of the type produce both an android and an iOS artifact, e.g. flutter
+func isUniversalBuildType(buildType string) bool {
+	return buildType == "universal" || buildType == "flutter"
+}
+
+//platformArtifactUrl returns the artifact of a universal build for platform, which is android or ios
+func platformArtifactUrl(build *apibuildv1.Build, platform string) (string, bool) {
+	var annotation string
+	switch platform {
+	case "android":
+		annotation = openshift.AndroidArtifactUri
+	case "ios":
+		annotation = openshift.IosArtifactUri
+	default:
+		return "", false
+	}
+	val, ok := build.Annotations[annotation]
+	return val, ok && val != ""
+}
+
+//universalHandler serves /<build>/universal, a single share link for both platforms of a universal build
+func universalHandler(rw http.ResponseWriter, r *http.Request) {
+	build, token, ok := lookupAuthorizedBuild(rw, r)
+	if !ok {
+		return
+	}
+	buildType, err := osClient.GetBuildType(build)
+	if err != nil || !isUniversalBuildType(buildType) {
+		httpError(rw, fmt.Sprintf("build %s is not a universal build", build.Name), http.StatusBadRequest)
+		return
+	}
+	_, hasAndroid := platformArtifactUrl(build, "android")
+	_, hasIos := platformArtifactUrl(build, "ios")
+	if !hasAndroid || !hasIos {
+		httpError(rw, fmt.Sprintf("build %s needs both %s and %s annotations", build.Name, openshift.AndroidArtifactUri, openshift.IosArtifactUri), http.StatusConflict)
+		return
+	}
+
+	host := osClient.GetOperatorHost()
+	android := links.Link{Host: host, Build: build.Name, Token: token, Params: url.Values{"platform": {"android"}}}
+	ios := links.Link{Host: host, Build: build.Name, Token: token, Params: url.Values{"platform": {"ios"}}}
+	rw.Header().Set("content-type", "text/html")
+	rw.Write([]byte(plist.ProduceUniversalHTML(android.Download(), ios.ItmsServices())))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestUniversalLanding(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.setArtifact("/artifact/app.apk", []byte("apk"))
+	env.setArtifact("/artifact/app.ipa", []byte("ipa"))
+	env.addBuild("flutter-1", "flutter", map[string]string{
+		openshift.AndroidArtifactUri: env.jenkins.URL + "/artifact/app.apk",
+		openshift.IosArtifactUri:     env.jenkins.URL + "/artifact/app.ipa",
+	})
+	env.addBuild("flutter-2", "flutter", map[string]string{openshift.AndroidArtifactUri: env.jenkins.URL + "/artifact/app.apk"})
+	env.addBuild("android-1", "android", nil)
+
+	rec := env.do("GET", "/flutter-1/universal?token="+testToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	androidLink := `href="https://proxy.example.com/flutter-1/download?platform=android&amp;token=` + testToken + `"`
+	if !strings.Contains(body, androidLink) {
+		t.Fatalf("expected android link in page but got \n%s", body)
+	}
+	iosLink := `href="itms-services://?action=download-manifest&amp;url=https%3A%2F%2Fproxy.example.com%2Fflutter-1%2Fdownload%3Fplatform%3Dios%26plist%3Dtrue%26token%3D` + testToken + `"`
+	if !strings.Contains(body, iosLink) {
+		t.Fatalf("expected ios link in page but got \n%s", body)
+	}
+
+	if rec := env.do("GET", "/flutter-1/universal?token=wrong", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a bad token to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/flutter-2/universal?token="+testToken, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected a build missing a platform to be refused, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/universal?token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a single platform build to be refused, got status %d", rec.Code)
+	}
+}
+
+func TestUniversalPlatformDownloads(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.setArtifact("/artifact/app.apk", []byte("apk"))
+	env.setArtifact("/artifact/app.ipa", []byte("ipa"))
+	env.addBuild("flutter-1", "flutter", map[string]string{
+		openshift.AndroidArtifactUri: env.jenkins.URL + "/artifact/app.apk",
+		openshift.IosArtifactUri:     env.jenkins.URL + "/artifact/app.ipa",
+	})
+
+	if rec := env.do("GET", "/flutter-1/download?platform=android&token="+testToken, nil); rec.Body.String() != "apk" {
+		t.Fatalf("expected the apk for the android platform but got %d %q", rec.Code, rec.Body.String())
+	}
+	plistReq := env.do("GET", "/flutter-1/download?platform=ios&plist=true&token="+testToken, nil)
+	if !strings.Contains(plistReq.Body.String(), "artifact=true&amp;platform=ios") {
+		t.Fatalf("expected the manifest to keep the platform but got \n%s", plistReq.Body.String())
+	}
+	if rec := env.do("GET", "/flutter-1/download?platform=ios&artifact=true&token="+testToken, nil); rec.Body.String() != "ipa" {
+		t.Fatalf("expected the ipa for the ios platform but got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := env.do("GET", "/flutter-1/download?token="+testToken, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected a universal download without a platform to return %d but got %d", http.StatusNotFound, rec.Code)
+	}
+}
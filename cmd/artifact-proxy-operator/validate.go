@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+//validateHandler serves /<build>/validate, letting a portal check a share link is still valid before offering the
+//download. It only reads the download count of a limited build, so validating never uses up a download
+func validateHandler(rw http.ResponseWriter, r *http.Request) {
+	build, _, ok := lookupAuthorizedBuild(rw, r)
+	if !ok {
+		return
+	}
+	limit, exhausted, err := downloadsExhausted(build)
+	if err != nil {
+		log.Printf("error reading download count of build %s: %s", build.Name, err.Error())
+		httpError(rw, "error reading download count", http.StatusServiceUnavailable)
+		return
+	}
+	if exhausted {
+		httpError(rw, fmt.Sprintf("build %s has reached its limit of %d downloads", build.Name, limit), http.StatusGone)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func TestValidate(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.TokenExpires: time.Now().Add(time.Hour).Format(time.RFC3339)})
+	env.addBuild("expired", "android", map[string]string{openshift.TokenExpires: time.Now().Add(-time.Hour).Format(time.RFC3339)})
+	downloads := downloadsTotal.Value(testNamespace)
+	bytesSent := downloadBytesTotal.Value(testNamespace)
+
+	for target, expected := range map[string]int{
+		"/android-1/validate?token=" + testToken: http.StatusNoContent,
+		"/android-1/validate?token=wrong":        http.StatusForbidden,
+		"/missing/validate?token=" + testToken:   http.StatusNotFound,
+		"/expired/validate?token=" + testToken:   http.StatusGone,
+	} {
+		if rec := env.do("GET", target, nil); rec.Code != expected {
+			t.Errorf("expected status %d for %s but got %d", expected, target, rec.Code)
+		}
+	}
+
+	if downloadsTotal.Value(testNamespace) != downloads || downloadBytesTotal.Value(testNamespace) != bytesSent {
+		t.Fatal("expected validation not to count as a download")
+	}
+}
+
+func TestValidateDoesNotUseUpDownloads(t *testing.T) {
+	defer useMemorySessions()()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("android-1", "android", map[string]string{openshift.MaxDownloads: "1"})
+
+	for i := 0; i < 3; i++ {
+		if rec := env.do("GET", "/android-1/validate?token="+testToken, nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("expected validating a build with a download left to return %d but got %d", http.StatusNoContent, rec.Code)
+		}
+	}
+	if rec := env.do("GET", "/android-1/download?token="+testToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected the only download to be served after validating but got %d", rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/validate?token="+testToken, nil); rec.Code != http.StatusGone {
+		t.Fatalf("expected validating a build without downloads left to return %d but got %d", http.StatusGone, rec.Code)
+	}
+}
+
+func TestExpiredTokenRefusesDownload(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("expired", "android", map[string]string{openshift.TokenExpires: time.Now().Add(-time.Minute).Format(time.RFC3339)})
+	env.addBuild("invalid-expiry", "android", map[string]string{openshift.TokenExpires: "tomorrow"})
+
+	if rec := env.do("GET", "/expired/download?token="+testToken, nil); rec.Code != http.StatusGone {
+		t.Fatalf("expected status %d for an expired token but got %d", http.StatusGone, rec.Code)
+	}
+	if rec := env.do("GET", "/invalid-expiry/download?token="+testToken, nil); rec.Code != http.StatusGone {
+		t.Fatalf("expected an unparseable expiry to count as expired but got status %d", rec.Code)
+	}
+}
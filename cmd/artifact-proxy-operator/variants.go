@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	"github.com/aerogear/artifact-proxy-operator/pkg/plist"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//iosVariant is one of the IPAs an iOS build produced, e.g. an adhoc and an enterprise signed bundle
+type iosVariant struct {
+	artifactUrl      string
+	bundleIdentifier string
+	cacheKey         string
+	checksum         string
+}
+
+//manifestMetadata describes an iOS build in its install manifest. The title defaults to the build name, anything
+//else missing from the annotations is filled in by the plist package
+func manifestMetadata(build *apibuildv1.Build, variant iosVariant) plist.Metadata {
+	title := build.Annotations[openshift.Title]
+	if title == "" {
+		title = build.Name
+	}
+	return plist.Metadata{
+		BundleIdentifier: variant.bundleIdentifier,
+		BundleVersion:    build.Annotations[openshift.BundleVersion],
+		Title:            title,
+		IconUrl:          build.Annotations[openshift.IconUrl],
+	}
+}
+
+//resolveVariant picks the variant of an iOS build by name. The primary variant, described by the usual download
+//annotation, is used when no name is given. Named variants are declared with
+//artifact-proxy/variant.<name>.artifact-url and optionally artifact-proxy/variant.<name>.bundle-identifier and
+//artifact-proxy/variant.<name>.checksum
+func resolveVariant(build *apibuildv1.Build, name string) (iosVariant, bool) {
+	primary := iosVariant{
+		artifactUrl:      build.Annotations[openshift.JenkinsArtifactUri],
+		bundleIdentifier: build.Annotations[openshift.BundleIdentifier],
+		cacheKey:         build.Name,
+		checksum:         build.Annotations[openshift.Checksum],
+	}
+	if primary.bundleIdentifier == "" {
+		primary.bundleIdentifier = plist.DefaultBundleIdentifier
+	}
+	if name == "" {
+		return primary, true
+	}
+
+	artifactUrl, ok := build.Annotations[openshift.VariantPrefix+name+".artifact-url"]
+	if !ok || artifactUrl == "" {
+		return iosVariant{}, false
+	}
+	variant := iosVariant{
+		artifactUrl:      artifactUrl,
+		bundleIdentifier: build.Annotations[openshift.VariantPrefix+name+".bundle-identifier"],
+		cacheKey:         build.Name + "." + name,
+		checksum:         build.Annotations[openshift.VariantPrefix+name+".checksum"],
+	}
+	if variant.bundleIdentifier == "" {
+		variant.bundleIdentifier = primary.bundleIdentifier
+	}
+	return variant, true
+}
+
+var bundleIdentifierPattern = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$`)
+
+//requireBundleIdentifier reports whether iOS installs need a real bundle identifier rather than the placeholder
+func requireBundleIdentifier() bool {
+	return os.Getenv("REQUIRE_BUNDLE_IDENTIFIER") == "true"
+}
+
+func validBundleIdentifier(id string) bool {
+	return bundleIdentifierPattern.MatchString(id)
+}
+
+//handleMisconfiguredBundle refuses an iOS install without a valid bundle identifier. The plist is fetched by the
+//device, so it gets a machine readable 400. The landing page is seen by a person, so with
+//BUNDLE_IDENTIFIER_ERROR_PAGE set it gets a page explaining the problem instead
+func handleMisconfiguredBundle(rw http.ResponseWriter, r *http.Request, buildName string) {
+	message := fmt.Sprintf("build %s has no valid bundle identifier, set the %s annotation", buildName, openshift.BundleIdentifier)
+	if !isPlistRequest(r.URL) && os.Getenv("BUNDLE_IDENTIFIER_ERROR_PAGE") == "true" {
+		page := plist.ProduceErrorHTML("This app can not be installed", fmt.Sprintf("Build %s is misconfigured and is missing its bundle identifier. Please contact the team distributing the app.", buildName))
+		rw.Header().Set("content-type", "text/html")
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(page))
+		return
+	}
+	rw.Header().Set("content-type", "application/json")
+	rw.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(rw).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	"k8s.io/client-go/rest"
+)
+
+func TestIosVariants(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", map[string]string{
+		openshift.BundleIdentifier:                               "org.aerogear.adhoc",
+		openshift.VariantPrefix + "enterprise.artifact-url":      env.jenkins.URL + "/artifact/enterprise.ipa",
+		openshift.VariantPrefix + "enterprise.bundle-identifier": "org.aerogear.enterprise",
+	})
+
+	primary := env.do("GET", "/ios-1/download?token="+testToken+"&plist=true", nil)
+	if primary.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, primary.Code)
+	}
+	if !strings.Contains(primary.Body.String(), "<string>org.aerogear.adhoc</string>") {
+		t.Fatalf("expected primary bundle identifier in plist but got \n%s", primary.Body.String())
+	}
+
+	enterprise := env.do("GET", "/ios-1/download?token="+testToken+"&plist=true&variant=enterprise", nil)
+	if enterprise.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, enterprise.Code)
+	}
+	body := enterprise.Body.String()
+	if !strings.Contains(body, "<string>org.aerogear.enterprise</string>") {
+		t.Fatalf("expected enterprise bundle identifier in plist but got \n%s", body)
+	}
+	if !strings.Contains(body, "/ios-1/download?artifact=true&amp;token="+testToken+"&amp;variant=enterprise") {
+		t.Fatalf("expected the plist to point at the enterprise artifact but got \n%s", body)
+	}
+	if body == primary.Body.String() {
+		t.Fatal("expected plist to differ by variant")
+	}
+
+	if rec := env.do("GET", "/ios-1/download?token="+testToken+"&artifact=true&variant=enterprise", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected enterprise artifact download to succeed, got status %d", rec.Code)
+	}
+	if rec := env.do("GET", "/ios-1/download?token="+testToken+"&plist=true&variant=unknown", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown variant to return %d but got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestResolveVariantDefaults(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("ios-1", "ios", map[string]string{
+		openshift.VariantPrefix + "enterprise.artifact-url": "https://jenkins/enterprise.ipa",
+	})
+
+	primary, ok := resolveVariant(build, "")
+	if !ok || primary.bundleIdentifier != "$(PRODUCT_BUNDLE_IDENTIFIER)" || primary.cacheKey != "ios-1" {
+		t.Fatalf("unexpected primary variant %+v", primary)
+	}
+	enterprise, ok := resolveVariant(build, "enterprise")
+	if !ok || enterprise.artifactUrl != "https://jenkins/enterprise.ipa" || enterprise.bundleIdentifier != primary.bundleIdentifier {
+		t.Fatalf("unexpected enterprise variant %+v", enterprise)
+	}
+}
+
+func TestRequireBundleIdentifier(t *testing.T) {
+	defer setEnv("REQUIRE_BUNDLE_IDENTIFIER", "true")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("missing", "ios", nil)
+	env.addBuild("valid", "ios", map[string]string{openshift.BundleIdentifier: "org.aerogear.app"})
+
+	plistReq := env.do("GET", "/missing/download?token="+testToken+"&plist=true", nil)
+	if plistReq.Code != http.StatusBadRequest || plistReq.Header().Get("content-type") != "application/json" {
+		t.Fatalf("expected a json 400 for the plist but got %d %s", plistReq.Code, plistReq.Header().Get("content-type"))
+	}
+	landing := env.do("GET", "/missing/download?token="+testToken, nil)
+	if landing.Code != http.StatusBadRequest || landing.Header().Get("content-type") != "application/json" {
+		t.Fatalf("expected a json 400 for the landing page without the error page option but got %d", landing.Code)
+	}
+	if rec := env.do("GET", "/valid/download?token="+testToken+"&plist=true", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected a valid bundle identifier to be served, got status %d", rec.Code)
+	}
+}
+
+func TestBundleIdentifierErrorPage(t *testing.T) {
+	defer setEnv("REQUIRE_BUNDLE_IDENTIFIER", "true")()
+	defer setEnv("BUNDLE_IDENTIFIER_ERROR_PAGE", "true")()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("missing", "ios", nil)
+
+	landing := env.do("GET", "/missing/download?token="+testToken, nil)
+	if landing.Code != http.StatusBadRequest || landing.Header().Get("content-type") != "text/html" {
+		t.Fatalf("expected an html error page but got %d %s", landing.Code, landing.Header().Get("content-type"))
+	}
+	if !strings.Contains(landing.Body.String(), "Build missing is misconfigured") {
+		t.Fatalf("expected the page to explain the problem but got \n%s", landing.Body.String())
+	}
+	plistReq := env.do("GET", "/missing/download?token="+testToken+"&plist=true", nil)
+	if plistReq.Code != http.StatusBadRequest || plistReq.Header().Get("content-type") != "application/json" {
+		t.Fatalf("expected the plist to stay machine readable but got %d %s", plistReq.Code, plistReq.Header().Get("content-type"))
+	}
+}
+
+func TestPlistMetadataAnnotations(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", map[string]string{openshift.BundleVersion: "2.1", openshift.IconUrl: "https://example.com/icon.png"})
+
+	rec := env.do("GET", "/ios-1/download?plist=true&token="+testToken, nil)
+	body := rec.Body.String()
+	if !strings.Contains(body, "<string>2.1</string>") || !strings.Contains(body, "<string>https://example.com/icon.png</string>") {
+		t.Fatalf("expected annotated metadata in manifest but got \n%s", body)
+	}
+	if !strings.Contains(body, "<key>title</key>\n          <string>ios-1</string>") {
+		t.Fatalf("expected the build name as title in manifest but got \n%s", body)
+	}
+}
+
+func TestPlistUrlValidated(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("ios-1", "ios", nil)
+
+	rec := env.do("GET", "/ios-1/download?plist=true&token="+testToken+"&reason=QA+sign-off", nil)
+	expect := "<string>https://proxy.example.com/ios-1/download?artifact=true&amp;reason=QA+sign-off&amp;token=" + testToken + "</string>"
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), expect) {
+		t.Fatalf("expected the encoded ipa url in the manifest but got %d \n%s", rec.Code, rec.Body.String())
+	}
+
+	for _, host := range []string{"proxy example.com", "proxy.example.com<"} {
+		var err error
+		osClient, err = openshift.NewOpenShiftClientForConfig(jenkinsClient, &rest.Config{Host: env.api.URL}, "auth-token", testNamespace, host)
+		if err != nil {
+			t.Fatal("error creating test OpenShift client " + err.Error())
+		}
+		rec := env.do("GET", "/ios-1/download?plist=true&token="+testToken, nil)
+		if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "<plist") {
+			t.Fatalf("expected no manifest with operator host %q but got %d \n%s", host, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//defaultMaxWait caps ?wait= when MAX_WAIT_SECONDS is not set
+const defaultMaxWait = 60 * time.Second
+
+//maxWait reads MAX_WAIT_SECONDS, the longest a request may wait for its build to complete
+func maxWait() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("MAX_WAIT_SECONDS")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultMaxWait
+}
+
+//artifactReady reports whether a build has completed and been annotated with its artifact
+func artifactReady(build *apibuildv1.Build) bool {
+	return osClient.GetBuildPhase(build) == apibuildv1.BuildPhaseComplete && hasArtifactUrl(build)
+}
+
+func hasArtifactUrl(build *apibuildv1.Build) bool {
+	artifactUrl, ok := buildArtifactUrl(build)
+	return ok && artifactUrl != ""
+}
+
+//refuseMissingArtifact answers a download of a build without an artifact url with 409. A completed build without one
+//means the pipeline did not publish an artifact, which is counted so it can be told apart from builds still running
+//and from a misconfigured operator
+func refuseMissingArtifact(rw http.ResponseWriter, build *apibuildv1.Build) {
+	if osClient.GetBuildPhase(build) != apibuildv1.BuildPhaseComplete {
+		rw.Header().Set("Retry-After", strconv.Itoa(notReadyRetryAfter(build)))
+		httpError(rw, fmt.Sprintf("build %s is not complete yet", build.Name), http.StatusConflict)
+		return
+	}
+	log.Printf("completed build %s has no artifact published", build.Name)
+	unpublishedArtifactsTotal.Inc(build.Namespace)
+	httpError(rw, fmt.Sprintf("no artifact published for build %s", build.Name), http.StatusConflict)
+}
+
+func buildFinished(build *apibuildv1.Build) bool {
+	switch osClient.GetBuildPhase(build) {
+	case apibuildv1.BuildPhaseFailed, apibuildv1.BuildPhaseError, apibuildv1.BuildPhaseCancelled:
+		return true
+	}
+	return false
+}
+
+//awaitArtifact serves ?wait=<seconds>, holding the request until the build has completed with an artifact so CI jobs
+//can ask for it before the build is done. The wait is capped by MAX_WAIT_SECONDS, the build is returned as it is when
+//no wait was asked for. Rather than poll the API server the request waits for the watch loop to see the build change,
+//and the time spent waiting does not count against the request budget
+func awaitArtifact(rw http.ResponseWriter, r *http.Request, build *apibuildv1.Build) (*http.Request, *apibuildv1.Build, bool) {
+	val := r.URL.Query().Get("wait")
+	if val == "" || artifactReady(build) {
+		return r, build, true
+	}
+	seconds, err := strconv.Atoi(val)
+	if err != nil || seconds < 0 {
+		httpError(rw, "wait must be a number of seconds", http.StatusBadRequest)
+		return r, nil, false
+	}
+	wait := time.Duration(seconds) * time.Second
+	if limit := maxWait(); wait > limit {
+		wait = limit
+	}
+
+	started := time.Now()
+	updates, unsubscribe := osClient.Updates.Subscribe(build.Name)
+	defer unsubscribe()
+	// fetched once more now the watch loop passes updates on, one made since the build was looked up is not missed
+	if latest, err := osClient.GetBuildContext(r.Context(), build.Name); err == nil {
+		build = latest
+	} else {
+		log.Printf("error checking on build %s before waiting for it: %s", build.Name, err.Error())
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	for !artifactReady(build) {
+		if buildFinished(build) {
+			httpError(rw, fmt.Sprintf("build %s finished as %s without an artifact", build.Name, osClient.GetBuildPhase(build)), http.StatusConflict)
+			return r, nil, false
+		}
+		select {
+		case <-ctx.Done():
+			rw.Header().Set("Retry-After", strconv.Itoa(notReadyRetryAfter(build)))
+			httpError(rw, fmt.Sprintf("build %s is not complete yet", build.Name), http.StatusConflict)
+			return r, nil, false
+		case build = <-updates:
+		}
+	}
+	return excludeFromRetryBudget(r, time.Since(started)), build, true
+}
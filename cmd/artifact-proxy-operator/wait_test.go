@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//completeBuildAfter completes a running build once delay has passed, handing it on as the watch loop would
+func completeBuildAfter(env *testEnv, name string, delay time.Duration) {
+	time.Sleep(delay)
+	env.lock.Lock()
+	// replaced rather than changed in place, as the API may be encoding the old one
+	completed := env.builds[name].DeepCopy()
+	completed.Status.Phase = apibuildv1.BuildPhaseComplete
+	env.builds[name] = completed
+	env.lock.Unlock()
+	osClient.Updates.Publish(completed)
+}
+
+func TestWaitForBuild(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("android-1", "android", nil)
+	build.Status.Phase = apibuildv1.BuildPhaseRunning
+
+	go completeBuildAfter(env, "android-1", 50*time.Millisecond)
+	rec := env.do("GET", "/android-1/download?wait=5&token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+		t.Fatalf("expected the artifact once the build completed but got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestWaitForBuildOutsideRetryBudget(t *testing.T) {
+	defer setEnv("REQUEST_RETRY_BUDGET_SECONDS", "1")()
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("android-1", "android", nil)
+	build.Status.Phase = apibuildv1.BuildPhaseRunning
+
+	go completeBuildAfter(env, "android-1", 1500*time.Millisecond)
+	rec := env.do("GET", "/android-1/download?wait=5&token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != testArtifact {
+		t.Fatalf("expected a wait longer than the request budget still to download the artifact but got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestWaitForBuildTimeout(t *testing.T) {
+	defer setEnv("MAX_WAIT_SECONDS", "0")()
+	env := newTestEnv(t)
+	defer env.close()
+	build := env.addBuild("android-1", "android", nil)
+	build.Status.Phase = apibuildv1.BuildPhaseRunning
+	failed := env.addBuild("android-2", "android", nil)
+	failed.Status.Phase = apibuildv1.BuildPhaseFailed
+
+	rec := env.do("GET", "/android-1/download?wait=30&token="+testToken, nil)
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected status %d with Retry-After once the wait ran out but got %d", http.StatusConflict, rec.Code)
+	}
+	if rec := env.do("GET", "/android-2/download?wait=30&token="+testToken, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for a failed build but got %d", http.StatusConflict, rec.Code)
+	}
+	if rec := env.do("GET", "/android-1/download?wait=soon&token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for an invalid wait but got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestCompleteBuildWithoutArtifact(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	complete := env.addBuild("android-1", "android", nil)
+	complete.Status.Phase = apibuildv1.BuildPhaseComplete
+	running := env.addBuild("android-2", "android", nil)
+	running.Status.Phase = apibuildv1.BuildPhaseRunning
+	delete(complete.Annotations, openshift.JenkinsArtifactUri)
+	delete(running.Annotations, openshift.JenkinsArtifactUri)
+
+	before := unpublishedArtifactsTotal.Value(testNamespace)
+	rec := env.do("GET", "/android-1/download?token="+testToken, nil)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "no artifact published for build android-1") {
+		t.Fatalf("expected a complete build without an artifact to be refused but got %d %q", rec.Code, rec.Body.String())
+	}
+	if unpublishedArtifactsTotal.Value(testNamespace) != before+1 {
+		t.Fatal("expected the build without an artifact to be counted")
+	}
+	rec = env.do("GET", "/android-2/download?token="+testToken, nil)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "is not complete yet") || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a running build without an artifact to be not complete yet but got %d %q", rec.Code, rec.Body.String())
+	}
+	if unpublishedArtifactsTotal.Value(testNamespace) != before+1 {
+		t.Fatal("expected a running build not to be counted as unpublished")
+	}
+}
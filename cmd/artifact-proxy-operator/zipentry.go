@@ -0,0 +1,174 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/checksum"
+)
+
+// sizedReaderAt is what a zip is read from, cached artifacts are files
+type sizedReaderAt interface {
+	io.ReaderAt
+	Stat() (os.FileInfo, error)
+}
+
+//handleZipEntry streams a single file out of a zip artifact. The zip is read from the cache when caching is enabled,
+//filling it first if needed, otherwise just the parts needed are fetched from Jenkins with ranged requests
+func handleZipEntry(rw http.ResponseWriter, a artifact, entryName string) {
+	started := time.Now()
+	if (artifactCache == nil || a.noCache) && lowOnMemory() {
+		// without the cache the archive is read through buffered ranged requests
+		rw.Header().Set("Retry-After", "30")
+		httpError(rw, "not enough memory to read the artifact, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	archive, closeArchive, err := openZip(a)
+	if err == checksum.ErrMismatch {
+		log.Printf("zip artifact %s did not match its checksum %s", a.cacheKey, a.checksum)
+		httpError(rw, "artifact does not match its checksum", http.StatusBadGateway)
+		return
+	}
+	if err != nil {
+		log.Printf("error opening zip artifact %s: %s", a.cacheKey, err.Error())
+		httpError(rw, "artifact is not a readable zip", http.StatusBadRequest)
+		return
+	}
+	defer closeArchive()
+
+	var entry *zip.File
+	for _, f := range archive.File {
+		if f.Name == entryName && !f.FileInfo().IsDir() {
+			entry = f
+			break
+		}
+	}
+	if entry == nil {
+		httpError(rw, fmt.Sprintf("no entry %s in artifact", entryName), http.StatusNotFound)
+		return
+	}
+	stream, err := entry.Open()
+	if err != nil {
+		recordDownload(a, 0, err)
+		httpError(rw, "error when streaming atifact", http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	var body io.Reader = stream
+	contentType := mime.TypeByExtension(path.Ext(entry.Name))
+	if contentType == "" {
+		if contentType, body, err = sniffContentType(stream); err != nil {
+			recordDownload(a, 0, err)
+			httpError(rw, "error when streaming atifact", http.StatusInternalServerError)
+			return
+		}
+	}
+	rw.Header().Set("content-type", contentType)
+	rw.Header().Set("content-disposition", contentDisposition("inline", path.Base(entry.Name)))
+	// entries are shown in the browser, keep any script in them away from the proxy's origin
+	rw.Header().Set("Content-Security-Policy", "sandbox")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	out, clearDeadline := withIdleTimeout(rw)
+	defer clearDeadline()
+	defer activeStreams.track()()
+	written, err := io.Copy(out, body)
+	recordDownload(a, written, err)
+	if err != nil {
+		log.Printf("error writing entry %s of artifact %s: %s", entry.Name, a.cacheKey, err.Error())
+		return
+	}
+	observeDownloadDuration(a.context(), a.namespace, started)
+}
+
+func openZip(a artifact) (*zip.Reader, func(), error) {
+	if artifactCache == nil || a.noCache {
+		expected, err := a.expectedChecksum()
+		if err != nil {
+			return nil, nil, err
+		}
+		if expected != nil {
+			return openVerifiedZip(a, expected)
+		}
+		ranged, size, err := source.OpenRanged(a.context(), a.url)
+		if err != nil {
+			return nil, nil, err
+		}
+		archive, err := zip.NewReader(ranged, size)
+		return archive, func() {}, err
+	}
+
+	if !artifactCache.Has(a.cacheKey) {
+		expected, err := a.expectedChecksum()
+		if err != nil {
+			return nil, nil, err
+		}
+		stream, err := openArtifact(a, expected)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = io.Copy(ioutil.Discard, stream)
+		stream.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	cached, ok := artifactCache.Open(a.cacheKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("artifact %s could not be cached", a.cacheKey)
+	}
+	file, ok := cached.(sizedReaderAt)
+	if !ok {
+		cached.Close()
+		return nil, nil, fmt.Errorf("cached artifact %s does not support random access", a.cacheKey)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		cached.Close()
+		return nil, nil, err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		cached.Close()
+		return nil, nil, err
+	}
+	return archive, func() { cached.Close() }, nil
+}
+
+//openVerifiedZip reads the zip of a build with a checksum when it can not be cached. Ranged requests only fetch parts
+//of the artifact, which can not be verified, so the whole of it is spooled to a temporary file and checked first. The
+//returned func removes the file again
+func openVerifiedZip(a artifact, expected *checksum.Checksum) (*zip.Reader, func(), error) {
+	upstream, err := source.Stream(a.context(), a.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer upstream.Close()
+	spool, err := ioutil.TempFile("", "artifact-proxy-zip-")
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	size, err := io.Copy(spool, expected.Verify(upstream))
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return archive, release, nil
+}
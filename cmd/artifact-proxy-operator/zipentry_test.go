@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/checksum"
+	"github.com/aerogear/artifact-proxy-operator/pkg/openshift"
+)
+
+func zipServer(t *testing.T, files map[string]string) *httptest.Server {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal("error creating zip " + err.Error())
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("error creating zip " + err.Error())
+	}
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.ServeContent(rw, r, "site.zip", time.Time{}, bytes.NewReader(buf.Bytes()))
+	}))
+}
+
+func testZipEntries(t *testing.T, env *testEnv) {
+	rec := env.do("GET", "/web-1/download?entry=reports/index.html&token="+testToken, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "<h1>report</h1>" {
+		t.Fatalf("expected the zip entry but got %d %q", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("content-type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("expected the content type of the entry but got %q", ct)
+	}
+	if cd := rec.Header().Get("content-disposition"); cd != `inline; filename="index.html"` {
+		t.Fatalf("unexpected content disposition %q", cd)
+	}
+
+	if rec := env.do("GET", "/web-1/download?entry=reports/missing.html&token="+testToken, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a missing entry but got %d", http.StatusNotFound, rec.Code)
+	}
+	if rec := env.do("GET", "/web-1/download?entry=reports/&token="+testToken, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a directory entry but got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestZipEntryRanged(t *testing.T) {
+	upstream := zipServer(t, map[string]string{"reports/index.html": "<h1>report</h1>", "reports/": ""})
+	defer upstream.Close()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("web-1", "web", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/site.zip"})
+
+	testZipEntries(t, env)
+}
+
+func TestZipEntryRangedVerified(t *testing.T) {
+	upstream := zipServer(t, map[string]string{"reports/index.html": "<h1>report</h1>", "reports/": ""})
+	defer upstream.Close()
+	res, err := http.Get(upstream.URL + "/site.zip")
+	if err != nil {
+		t.Fatal("error fetching zip " + err.Error())
+	}
+	sum, err := checksum.Compute("sha256", res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal("error hashing zip " + err.Error())
+	}
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("web-1", "web", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/site.zip", openshift.Checksum: sum.String()})
+	env.addBuild("web-2", "web", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/site.zip", openshift.Checksum: testArtifactSha256})
+
+	testZipEntries(t, env)
+	if rec := env.do("GET", "/web-2/download?entry=reports/index.html&token="+testToken, nil); rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected status %d for an entry of a zip which does not match its checksum but got %d", http.StatusBadGateway, rec.Code)
+	}
+}
+
+func TestZipEntryCached(t *testing.T) {
+	defer enableCache(t)()
+	upstream := zipServer(t, map[string]string{"reports/index.html": "<h1>report</h1>", "reports/": ""})
+	defer upstream.Close()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("web-1", "web", map[string]string{openshift.JenkinsArtifactUri: upstream.URL + "/site.zip"})
+
+	testZipEntries(t, env)
+	if !artifactCache.Has("web-1") {
+		t.Fatal("expected the zip to be cached")
+	}
+}
+
+func TestZipEntryOfNonZipArtifact(t *testing.T) {
+	defer enableCache(t)()
+	env := newTestEnv(t)
+	defer env.close()
+	env.addBuild("web-1", "web", nil)
+
+	if rec := env.do("GET", "/web-1/download?entry=index.html&token="+testToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for an artifact which is not a zip but got %d", http.StatusBadRequest, rec.Code)
+	}
+}
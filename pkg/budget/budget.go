@@ -0,0 +1,35 @@
+package budget
+
+import (
+	"context"
+	"time"
+)
+
+type deadlineKey struct{}
+
+//WithDeadline gives a request a time budget. Unlike context.WithDeadline the context is not cancelled when the budget
+//runs out, as a response which started streaming in time should be allowed to finish. Calls which complete before
+//returning are bounded with Bounded, streams only until they have started
+func WithDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, deadlineKey{}, deadline)
+}
+
+//Deadline returns when the request's budget runs out, false when it has none
+func Deadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(deadlineKey{}).(time.Time)
+	return deadline, ok
+}
+
+//Bounded returns a context which is cancelled once the budget runs out
+func Bounded(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := Deadline(ctx); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+	return context.WithCancel(ctx)
+}
+
+//Exceeded reports whether the request's budget has run out
+func Exceeded(ctx context.Context) bool {
+	deadline, ok := Deadline(ctx)
+	return ok && !time.Now().Before(deadline)
+}
@@ -0,0 +1,34 @@
+package budget
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	if _, ok := Deadline(context.Background()); ok {
+		t.Fatal("expected no deadline without a budget")
+	}
+	if Exceeded(context.Background()) {
+		t.Fatal("expected a request without a budget never to exceed it")
+	}
+
+	ctx := WithDeadline(context.Background(), time.Now().Add(50*time.Millisecond))
+	bounded, cancel := Bounded(ctx)
+	defer cancel()
+	if Exceeded(ctx) {
+		t.Fatal("expected the budget not to be exceeded yet")
+	}
+	select {
+	case <-bounded.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the bounded context to be cancelled when the budget runs out")
+	}
+	if !Exceeded(ctx) {
+		t.Fatal("expected the budget to be exceeded")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected the request context itself not to be cancelled")
+	}
+}
@@ -0,0 +1,403 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//DiskCache stores downloaded artifacts on disk so repeat downloads do not need to go back to Jenkins. When a budget
+//is set the least recently used artifacts are evicted to stay within it
+type DiskCache struct {
+	dir string
+
+	lock      sync.Mutex
+	maxBytes  int64
+	size      int64
+	entries   map[string]*entry
+	hits      int64
+	misses    int64
+	evictions int64
+	//generations counts the removals of each key, a fill started before a removal is not added by it
+	generations map[string]uint64
+}
+
+//ErrRemoved is returned for a fill which was not added to the cache, because its key was removed while it was filled
+var ErrRemoved = errors.New("artifact was removed from the cache while it was being filled")
+
+type entry struct {
+	size     int64
+	lastUsed time.Time
+	//readers is the number of open handles on the artifact, it is never evicted while being served
+	readers int
+	//removed is set when the artifact was removed while being served, its size stays accounted until the last reader
+	//closes it
+	removed bool
+}
+
+//Stats describes the usage of a cache
+type Stats struct {
+	Size      int64
+	MaxBytes  int64
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+//NewDiskCache creates a cache rooted at dir, creating the directory if needed. Artifacts already in the directory
+//are kept, ordered by their modification time for eviction
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if dir == "" {
+		return nil, errors.New("no directory given for the artifact cache")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.New("error creating artifact cache directory " + err.Error())
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.New("error reading artifact cache directory " + err.Error())
+	}
+	c := &DiskCache{dir: dir, entries: map[string]*entry{}, generations: map[string]uint64{}}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		c.entries[f.Name()] = &entry{size: f.Size(), lastUsed: f.ModTime()}
+		c.size += f.Size()
+	}
+	return c, nil
+}
+
+//SetMaxBytes sets the total size the cached artifacts may take up, 0 for no limit. Artifacts are evicted straight
+//away if the cache is already over the new budget
+func (c *DiskCache) SetMaxBytes(max int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.maxBytes = max
+	if max > 0 {
+		c.evict(c.size-max, "")
+	}
+}
+
+//Stats returns the current size of the cache and how it has been used
+func (c *DiskCache) Stats() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return Stats{Size: c.size, MaxBytes: c.maxBytes, Hits: c.hits, Misses: c.misses, Evictions: c.evictions}
+}
+
+//Has reports whether an artifact is cached for key
+func (c *DiskCache) Has(key string) bool {
+	p, err := c.path(key)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+//Size returns the size of the artifact cached for key, false when there is none
+func (c *DiskCache) Size(key string) (int64, bool) {
+	p, err := c.path(key)
+	if err != nil {
+		return 0, false
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+//Open returns the cached artifact for key, the caller must close it. The artifact is not evicted until it is closed.
+//The reader is backed by the cached file, so it also supports io.ReaderAt and Stat
+func (c *DiskCache) Open(key string) (io.ReadCloser, bool) {
+	p, err := c.path(key)
+	if err != nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	f, err := os.Open(p)
+	if err != nil {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	e, ok := c.entries[key]
+	if !ok {
+		// added to the directory behind our back
+		info, _ := f.Stat()
+		e = &entry{size: info.Size()}
+		c.entries[key] = e
+		c.size += e.size
+	}
+	e.lastUsed = time.Now()
+	e.readers++
+	return &cachedFile{File: f, cache: c, key: key}, true
+}
+
+type cachedFile struct {
+	*os.File
+	cache  *DiskCache
+	key    string
+	closed bool
+}
+
+func (f *cachedFile) Close() error {
+	f.cache.lock.Lock()
+	if !f.closed {
+		f.closed = true
+		if e, ok := f.cache.entries[f.key]; ok && e.readers > 0 {
+			e.readers--
+			if e.removed && e.readers == 0 {
+				f.cache.size -= e.size
+				delete(f.cache.entries, f.key)
+			}
+		}
+	}
+	f.cache.lock.Unlock()
+	return f.File.Close()
+}
+
+//Remove deletes the artifact cached for key, e.g. when it was republished under the same name. Artifacts being served
+//are unlinked straight away so new requests miss, while the readers keep reading the file they opened. It is not an
+//error when nothing is cached for key
+func (c *DiskCache) Remove(key string) error {
+	p, err := c.path(key)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generations[key]++
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return errors.New("error removing cached artifact " + err.Error())
+	}
+	os.Remove(c.filenamePath(key))
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.readers > 0 {
+		e.removed = true
+		return nil
+	}
+	c.size -= e.size
+	delete(c.entries, key)
+	return nil
+}
+
+//evict removes the least recently used artifacts which are not being served until at least needed bytes are freed,
+//never evicting keep. It reports whether enough could be freed. The lock must be held
+func (c *DiskCache) evict(needed int64, keep string) bool {
+	if needed <= 0 {
+		return true
+	}
+	var candidates []string
+	for key, e := range c.entries {
+		if key != keep && e.readers == 0 {
+			candidates = append(candidates, key)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return c.entries[candidates[i]].lastUsed.Before(c.entries[candidates[j]].lastUsed)
+	})
+	for _, key := range candidates {
+		if needed <= 0 {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, key)); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		os.Remove(c.filenamePath(key))
+		needed -= c.entries[key].size
+		c.size -= c.entries[key].size
+		delete(c.entries, key)
+		c.evictions++
+	}
+	return needed <= 0
+}
+
+//add moves a completed download into place under key, evicting other artifacts when it would not fit in the budget.
+//The filename is kept next to it, or any kept for a replaced artifact removed when there is none. A download started
+//before key was last removed is of the artifact that was removed, and is not added
+func (c *DiskCache) add(key string, generation uint64, tmp string, dest string, filename string) error {
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return errors.New("error reading cache file " + err.Error())
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generations[key] != generation {
+		return ErrRemoved
+	}
+	var oldSize int64
+	old, replacing := c.entries[key]
+	if replacing {
+		oldSize = old.size
+	}
+	if c.maxBytes > 0 {
+		if info.Size() > c.maxBytes || !c.evict(c.size-oldSize+info.Size()-c.maxBytes, key) {
+			return errors.New("artifact " + key + " does not fit in the cache budget")
+		}
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return errors.New("error moving cache file into place " + err.Error())
+	}
+	if filename == "" {
+		os.Remove(c.filenamePath(key))
+	} else if err := ioutil.WriteFile(c.filenamePath(key), []byte(filename), 0600); err != nil {
+		// the artifact is still served, under the name the proxy falls back to
+		os.Remove(c.filenamePath(key))
+	}
+	e := &entry{size: info.Size(), lastUsed: time.Now()}
+	if replacing {
+		// readers of the replaced file keep reading it, they still hold this key
+		e.readers = old.readers
+	}
+	c.entries[key] = e
+	c.size += info.Size() - oldSize
+	return nil
+}
+
+//Store reads r to the end and caches the contents under key
+func (c *DiskCache) Store(key string, r io.Reader) error {
+	return c.StoreNamed(key, "", r)
+}
+
+//StoreNamed is Store for an artifact which upstream gave a filename
+func (c *DiskCache) StoreNamed(key string, filename string, r io.Reader) error {
+	filler, err := c.newFiller(key, r)
+	if err != nil {
+		return err
+	}
+	filler.filename = filename
+	if _, err := io.Copy(ioutil.Discard, filler); err != nil {
+		filler.abort()
+		return errors.New("error reading artifact into cache " + err.Error())
+	}
+	return filler.commit()
+}
+
+//Fill wraps a stream so that everything read from it is also written to the cache under key. The entry is only
+//added once the stream has been read to the end, a partially read stream leaves the cache untouched. If the cache
+//can not be written the stream is returned as is
+func (c *DiskCache) Fill(key string, stream io.ReadCloser) io.ReadCloser {
+	return c.FillNamed(key, "", stream)
+}
+
+//FillNamed is Fill for an artifact which upstream gave a filename, it is returned by Filename once the artifact is
+//cached
+func (c *DiskCache) FillNamed(key string, filename string, stream io.ReadCloser) io.ReadCloser {
+	filler, err := c.newFiller(key, stream)
+	if err != nil {
+		return stream
+	}
+	filler.filename = filename
+	return filler
+}
+
+//Filename returns the filename the artifact cached under key was filled with, empty when it was given none
+func (c *DiskCache) Filename(key string) string {
+	if _, err := c.path(key); err != nil {
+		return ""
+	}
+	filename, err := ioutil.ReadFile(c.filenamePath(key))
+	if err != nil {
+		return ""
+	}
+	return string(filename)
+}
+
+//filenamePath is where the filename of the artifact cached under key is kept, hidden so it is not taken for an
+//artifact itself
+func (c *DiskCache) filenamePath(key string) string {
+	return filepath.Join(c.dir, "."+key+".filename")
+}
+
+func (c *DiskCache) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") {
+		return "", errors.New("invalid cache key " + key)
+	}
+	return filepath.Join(c.dir, key), nil
+}
+
+func (c *DiskCache) newFiller(key string, r io.Reader) (*filler, error) {
+	p, err := c.path(key)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(c.dir, ".fill-")
+	if err != nil {
+		return nil, errors.New("error creating cache file " + err.Error())
+	}
+	c.lock.Lock()
+	generation := c.generations[key]
+	c.lock.Unlock()
+	return &filler{cache: c, key: key, generation: generation, source: r, tmp: tmp, dest: p}, nil
+}
+
+type filler struct {
+	cache      *DiskCache
+	key        string
+	generation uint64
+	filename   string
+	source     io.Reader
+	tmp        *os.File
+	dest       string
+	done       bool
+	failed     bool
+}
+
+func (f *filler) Read(p []byte) (int, error) {
+	n, err := f.source.Read(p)
+	if n > 0 && !f.failed {
+		if _, werr := f.tmp.Write(p[:n]); werr != nil {
+			f.failed = true
+		}
+	}
+	if err == io.EOF {
+		f.done = true
+	}
+	return n, err
+}
+
+func (f *filler) Close() error {
+	var err error
+	if closer, ok := f.source.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if f.done && !f.failed {
+		//the stream itself was fine, only the cache has moved on from it
+		if cerr := f.commit(); cerr != nil && cerr != ErrRemoved && err == nil {
+			err = cerr
+		}
+		return err
+	}
+	f.abort()
+	return err
+}
+
+func (f *filler) commit() error {
+	if err := f.tmp.Close(); err != nil {
+		os.Remove(f.tmp.Name())
+		return errors.New("error writing cache file " + err.Error())
+	}
+	if err := f.cache.add(f.key, f.generation, f.tmp.Name(), f.dest, f.filename); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (f *filler) abort() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
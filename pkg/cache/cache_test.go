@@ -0,0 +1,313 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T) (*DiskCache, func()) {
+	dir, err := ioutil.TempDir("", "artifact-cache")
+	if err != nil {
+		t.Fatal("error creating temp dir " + err.Error())
+	}
+	c, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal("error creating cache " + err.Error())
+	}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func TestStoreAndOpen(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	if c.Has("build-1") {
+		t.Fatal("expected empty cache")
+	}
+	if err := c.Store("build-1", bytes.NewBufferString("content")); err != nil {
+		t.Fatal("error storing artifact " + err.Error())
+	}
+	if size, ok := c.Size("build-1"); !ok || size != int64(len("content")) {
+		t.Fatalf("expected the size of the cached artifact but got %d %v", size, ok)
+	}
+	r, ok := c.Open("build-1")
+	if !ok {
+		t.Fatal("expected cached artifact")
+	}
+	defer r.Close()
+	content, _ := ioutil.ReadAll(r)
+	if string(content) != "content" {
+		t.Fatalf("expected cached content %q but got %q", "content", content)
+	}
+}
+
+func TestFill(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	r := c.Fill("complete", ioutil.NopCloser(bytes.NewBufferString("content")))
+	ioutil.ReadAll(r)
+	r.Close()
+	if !c.Has("complete") {
+		t.Fatal("expected fully read stream to be cached")
+	}
+
+	r = c.Fill("partial", ioutil.NopCloser(bytes.NewBufferString("content")))
+	r.Read(make([]byte, 2))
+	r.Close()
+	if c.Has("partial") {
+		t.Fatal("expected partially read stream not to be cached")
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	for _, key := range []string{"", "../escape", "a/b", ".hidden"} {
+		if err := c.Store(key, bytes.NewBufferString("content")); err == nil {
+			t.Errorf("expected key %q to be rejected", key)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	if err := c.Check(1); err != nil {
+		t.Fatalf("expected a writable cache to pass the check but got %v", err)
+	}
+	if err := c.Check(^uint64(0)); err == nil {
+		t.Fatal("expected the check to fail when less space is free than required")
+	}
+
+	if err := os.Chmod(c.dir, 0500); err != nil {
+		t.Fatal("error making cache read only " + err.Error())
+	}
+	defer os.Chmod(c.dir, 0700)
+	if f, err := ioutil.TempFile(c.dir, "root"); err == nil {
+		f.Close()
+		t.Skip("permissions are not enforced for this user")
+	}
+	if err := c.Check(0); err == nil {
+		t.Fatal("expected a read only cache to fail the check")
+	}
+}
+
+func TestCheckMissingDirectory(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	cleanup()
+
+	if err := c.Check(0); err == nil {
+		t.Fatal("expected a removed cache directory to fail the check")
+	}
+}
+
+func TestEvictsLeastRecentlyUsedPastBudget(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+	c.SetMaxBytes(10)
+
+	c.Store("a", bytes.NewBufferString("1234"))
+	c.Store("b", bytes.NewBufferString("1234"))
+	// using a makes b the least recently used
+	r, _ := c.Open("a")
+	r.Close()
+	if err := c.Store("c", bytes.NewBufferString("1234")); err != nil {
+		t.Fatalf("unexpected error storing artifact %v", err)
+	}
+	if c.Has("b") || !c.Has("a") || !c.Has("c") {
+		t.Fatalf("expected only the least recently used artifact to be evicted, has a=%v b=%v c=%v", c.Has("a"), c.Has("b"), c.Has("c"))
+	}
+	stats := c.Stats()
+	if stats.Size != 8 || stats.Evictions != 1 || stats.MaxBytes != 10 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if err := c.Store("huge", bytes.NewBufferString("12345678901")); err == nil {
+		t.Fatal("expected an artifact larger than the budget not to be cached")
+	}
+	if !c.Has("a") || !c.Has("c") {
+		t.Fatal("expected nothing to be evicted for an artifact which can never fit")
+	}
+}
+
+func TestDoesNotEvictArtifactsBeingServed(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+	c.SetMaxBytes(8)
+
+	c.Store("served", bytes.NewBufferString("1234"))
+	c.Store("idle", bytes.NewBufferString("1234"))
+	r, ok := c.Open("served")
+	if !ok {
+		t.Fatal("expected cached artifact")
+	}
+	// served is the least recently stored but still open
+	c.entries["served"].lastUsed = time.Time{}
+	if err := c.Store("new", bytes.NewBufferString("1234")); err != nil {
+		t.Fatalf("unexpected error storing artifact %v", err)
+	}
+	if !c.Has("served") || c.Has("idle") {
+		t.Fatalf("expected the idle artifact to be evicted instead of the one being served, has served=%v idle=%v", c.Has("served"), c.Has("idle"))
+	}
+
+	// with everything else being served there is no room
+	other, _ := c.Open("new")
+	if err := c.Store("another", bytes.NewBufferString("1234")); err == nil {
+		t.Fatal("expected no room while all artifacts are being served")
+	}
+	r.Close()
+	other.Close()
+	if err := c.Store("another", bytes.NewBufferString("1234")); err != nil {
+		t.Fatalf("expected room once artifacts are no longer served but got %v", err)
+	}
+}
+
+func TestHitsAndMisses(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	c.Store("a", bytes.NewBufferString("content"))
+	if r, ok := c.Open("a"); ok {
+		r.Close()
+	}
+	c.Open("missing")
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Size != int64(len("content")) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestExistingArtifactsAreAccounted(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+	c.Store("a", bytes.NewBufferString("content"))
+
+	reopened, err := NewDiskCache(c.dir)
+	if err != nil {
+		t.Fatal("error reopening cache " + err.Error())
+	}
+	if stats := reopened.Stats(); stats.Size != int64(len("content")) {
+		t.Fatalf("expected the existing artifact to count towards the cache size, got %+v", stats)
+	}
+	reopened.SetMaxBytes(1)
+	if reopened.Has("a") {
+		t.Fatal("expected lowering the budget to evict straight away")
+	}
+}
+
+func TestFillNamed(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+
+	r := c.FillNamed("named", "app-release.apk", ioutil.NopCloser(bytes.NewBufferString("content")))
+	ioutil.ReadAll(r)
+	r.Close()
+	if filename := c.Filename("named"); filename != "app-release.apk" {
+		t.Fatalf("expected the filename the artifact was filled with but got %q", filename)
+	}
+	reopened, err := NewDiskCache(c.dir)
+	if err != nil {
+		t.Fatal("error reopening cache " + err.Error())
+	}
+	if filename := reopened.Filename("named"); filename != "app-release.apk" {
+		t.Fatalf("expected the filename to survive a restart but got %q", filename)
+	}
+	if stats := reopened.Stats(); stats.Size != int64(len("content")) {
+		t.Fatalf("expected the filename not to count as an artifact, got %+v", stats)
+	}
+
+	// replacing the artifact without a filename drops the old one
+	r = c.Fill("named", ioutil.NopCloser(bytes.NewBufferString("content")))
+	ioutil.ReadAll(r)
+	r.Close()
+	if filename := c.Filename("named"); filename != "" {
+		t.Fatalf("expected no filename for an artifact filled without one but got %q", filename)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+	if err := c.Remove("build-1"); err != nil {
+		t.Fatal("expected removing an artifact which is not cached to succeed but got " + err.Error())
+	}
+	c.StoreNamed("build-1", "app.apk", bytes.NewBufferString("content"))
+	c.Store("build-2", bytes.NewBufferString("other"))
+
+	if err := c.Remove("build-1"); err != nil {
+		t.Fatal("error removing artifact " + err.Error())
+	}
+	if c.Has("build-1") || c.Filename("build-1") != "" || !c.Has("build-2") {
+		t.Fatal("expected only build-1 and its filename to be removed")
+	}
+	if size := c.Stats().Size; size != int64(len("other")) {
+		t.Fatalf("expected the removed artifact to no longer be accounted but the cache holds %d bytes", size)
+	}
+	if err := c.Remove("../build-2"); err == nil {
+		t.Fatal("expected an invalid key to be refused")
+	}
+}
+
+func TestRemoveWhileServing(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+	c.Store("build-1", bytes.NewBufferString("content"))
+	r, ok := c.Open("build-1")
+	if !ok {
+		t.Fatal("expected cached artifact")
+	}
+
+	if err := c.Remove("build-1"); err != nil {
+		t.Fatal("error removing artifact " + err.Error())
+	}
+	if c.Has("build-1") {
+		t.Fatal("expected new requests to miss the removed artifact")
+	}
+	if body, err := ioutil.ReadAll(r); err != nil || string(body) != "content" {
+		t.Fatalf("expected the reader to keep reading the removed artifact but got %q %v", body, err)
+	}
+	if size := c.Stats().Size; size != int64(len("content")) {
+		t.Fatalf("expected the artifact being served to stay accounted but the cache holds %d bytes", size)
+	}
+	r.Close()
+	if size := c.Stats().Size; size != 0 {
+		t.Fatalf("expected the artifact to be released once its reader closed but the cache holds %d bytes", size)
+	}
+
+	//refilled while the old artifact is still being read
+	c.Store("build-1", bytes.NewBufferString("old"))
+	r, _ = c.Open("build-1")
+	c.Remove("build-1")
+	c.Store("build-1", bytes.NewBufferString("new content"))
+	r.Close()
+	if size := c.Stats().Size; size != int64(len("new content")) || !c.Has("build-1") {
+		t.Fatalf("expected the refilled artifact to be kept but the cache holds %d bytes", size)
+	}
+}
+
+func TestRemoveWhileFilling(t *testing.T) {
+	c, cleanup := newTestCache(t)
+	defer cleanup()
+	stream := c.Fill("build-1", ioutil.NopCloser(bytes.NewBufferString("old content")))
+	if _, err := ioutil.ReadAll(stream); err != nil {
+		t.Fatal("error reading stream " + err.Error())
+	}
+	if err := c.Remove("build-1"); err != nil {
+		t.Fatal("error removing artifact " + err.Error())
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal("expected the stream to close cleanly but got " + err.Error())
+	}
+	if c.Has("build-1") || c.Stats().Size != 0 {
+		t.Fatal("expected a fill started before the removal not to be added")
+	}
+
+	if err := c.Store("build-1", bytes.NewBufferString("new content")); err != nil || !c.Has("build-1") {
+		t.Fatalf("expected fills started after the removal to be added but got %v", err)
+	}
+}
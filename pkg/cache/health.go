@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+//Check verifies the cache directory can be written and has at least minFree bytes available, so a full or read only
+//cache volume can be reported before downloads start failing
+func (c *DiskCache) Check(minFree uint64) error {
+	probe, err := ioutil.TempFile(c.dir, ".probe-")
+	if err != nil {
+		return errors.New("artifact cache directory is not writable " + err.Error())
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if minFree == 0 {
+		return nil
+	}
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(c.dir, &stat); err != nil {
+		return errors.New("error checking free space of artifact cache " + err.Error())
+	}
+	if free := uint64(stat.Bavail) * uint64(stat.Bsize); free < minFree {
+		return fmt.Errorf("artifact cache has %d bytes free, below the minimum of %d", free, minFree)
+	}
+	return nil
+}
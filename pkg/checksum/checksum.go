@@ -0,0 +1,84 @@
+package checksum
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"strings"
+)
+
+//ErrMismatch is returned when a verified stream does not match its expected digest
+var ErrMismatch = errors.New("artifact checksum mismatch")
+
+var algorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+//Checksum is the expected digest of an artifact, written as <algorithm>:<hex digest> e.g. sha256:2c26b4...
+type Checksum struct {
+	Algorithm string
+	Digest    []byte
+}
+
+//Parse reads a checksum in the <algorithm>:<hex digest> form, rejecting unknown algorithms and malformed digests
+func Parse(value string) (*Checksum, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("checksum " + value + " must be in the form <algorithm>:<hex digest>")
+	}
+	algorithm := strings.ToLower(parts[0])
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return nil, errors.New("unsupported checksum algorithm " + parts[0] + ", expected one of sha1, sha256 or sha512")
+	}
+	digest, err := hex.DecodeString(parts[1])
+	if err != nil || len(digest) != newHash().Size() {
+		return nil, errors.New("invalid " + algorithm + " digest " + parts[1])
+	}
+	return &Checksum{Algorithm: algorithm, Digest: digest}, nil
+}
+
+func (c *Checksum) String() string {
+	return c.Algorithm + ":" + hex.EncodeToString(c.Digest)
+}
+
+//Compute hashes everything read from r with the given algorithm
+func Compute(algorithm string, r io.Reader) (*Checksum, error) {
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return nil, errors.New("unsupported checksum algorithm " + algorithm + ", expected one of sha1, sha256 or sha512")
+	}
+	h := newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return &Checksum{Algorithm: algorithm, Digest: h.Sum(nil)}, nil
+}
+
+//Verify wraps r so the data read through it is hashed. Once r is exhausted ErrMismatch is returned in place of io.EOF
+//if the data did not match the checksum
+func (c *Checksum) Verify(r io.Reader) io.Reader {
+	h := algorithms[c.Algorithm]()
+	return &verifier{tee: io.TeeReader(r, h), hash: h, expected: c.Digest}
+}
+
+type verifier struct {
+	tee      io.Reader
+	hash     hash.Hash
+	expected []byte
+}
+
+func (v *verifier) Read(p []byte) (int, error) {
+	n, err := v.tee.Read(p)
+	if err == io.EOF && !bytes.Equal(v.hash.Sum(nil), v.expected) {
+		return n, ErrMismatch
+	}
+	return n, err
+}
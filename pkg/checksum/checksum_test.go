@@ -0,0 +1,65 @@
+package checksum
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+const (
+	content      = "artifact"
+	sha256Digest = "sha256:c7c5c1d70c5dec4416ab6158afd0b223ef40c29b1dc1f97ed9428b94d4cadb1c"
+)
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("md5:d41d8cd98f00b204e9800998ecf8427e"); err == nil {
+		t.Error("expected unknown algorithm to be rejected")
+	}
+	if _, err := Parse("sha256"); err == nil {
+		t.Error("expected missing digest to be rejected")
+	}
+	if _, err := Parse("sha256:abcd"); err == nil {
+		t.Error("expected digest of the wrong length to be rejected")
+	}
+	c, err := Parse("SHA256:" + sha256Digest[len("sha256:"):])
+	if err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	if c.String() != sha256Digest {
+		t.Fatalf("expected %s but got %s", sha256Digest, c.String())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	cases := []struct {
+		checksum string
+	}{
+		{sha256Digest},
+		{"sha512:14697440701c3885f7c8d5faa59f336b471ca86332034eff0d3fddc02dc9b18b8356e840db54823c8fd2f2cbd0906969cf132cf8bb9c73dc769b4ffd817bd23d"},
+	}
+	for _, tc := range cases {
+		c, err := Parse(tc.checksum)
+		if err != nil {
+			t.Fatal("unexpected error " + err.Error())
+		}
+		if _, err := ioutil.ReadAll(c.Verify(bytes.NewBufferString(content))); err != nil {
+			t.Errorf("%s: expected matching content to verify but got %v", c.Algorithm, err)
+		}
+		if _, err := ioutil.ReadAll(c.Verify(bytes.NewBufferString("tampered"))); err != ErrMismatch {
+			t.Errorf("%s: expected mismatch but got %v", c.Algorithm, err)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	c, err := Compute("sha256", bytes.NewReader([]byte(content)))
+	if err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	if c.String() != sha256Digest {
+		t.Fatalf("expected %s but got %s", sha256Digest, c.String())
+	}
+	if _, err := Compute("md5", bytes.NewReader([]byte(content))); err == nil {
+		t.Error("expected unknown algorithm to be rejected")
+	}
+}
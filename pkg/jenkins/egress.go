@@ -0,0 +1,78 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+//resolver looks up the addresses of a host, satisfied by net.DefaultResolver
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+//egressDialer only connects to addresses inside the allowed ranges. The host is resolved once per connection and
+//the connection is made to the address which was checked, so the host can not be rebound to another address between
+//the check and the dial
+type egressDialer struct {
+	allowed  []*net.IPNet
+	resolver resolver
+	dialer   *net.Dialer
+}
+
+//ParseCIDRs parses a comma separated list of CIDR ranges such as 10.0.0.0/8,192.168.1.0/24
+func ParseCIDRs(val string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, cidr := range strings.Split(val, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.New("invalid CIDR range " + cidr)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+func (d *egressDialer) isAllowed(ip net.IP) bool {
+	for _, ipNet := range d.allowed {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//DialContext resolves the host in addr and dials the first of its addresses, refusing when any of them is outside the
+//allowed ranges
+func (d *egressDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := d.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no addresses found for egress host " + host)
+	}
+	for _, ip := range ips {
+		if !d.isAllowed(ip) {
+			return nil, errors.New("egress to " + host + " at " + ip.String() + " is not allowed")
+		}
+	}
+	return d.dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].String(), port))
+}
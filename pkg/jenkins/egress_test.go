@@ -0,0 +1,64 @@
+package jenkins
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//rebindingResolver answers with each of its addresses in turn, like a host rebound between lookups
+type rebindingResolver struct {
+	lock    sync.Mutex
+	answers []string
+	lookups int
+}
+
+func (r *rebindingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	answer := r.answers[r.lookups%len(r.answers)]
+	r.lookups++
+	return []net.IPAddr{{IP: net.ParseIP(answer)}}, nil
+}
+
+func TestParseCIDRs(t *testing.T) {
+	ranges, err := ParseCIDRs("10.0.0.0/8, 127.0.0.1/32,")
+	if err != nil || len(ranges) != 2 {
+		t.Fatalf("expected two ranges but got %v %v", ranges, err)
+	}
+	if _, err := ParseCIDRs("10.0.0.0"); err == nil {
+		t.Fatal("expected an error for an address without a prefix length")
+	}
+}
+
+func TestEgressDialerRebinding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("artifact"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	allowed, _ := ParseCIDRs("127.0.0.0/8")
+	resolver := &rebindingResolver{answers: []string{"127.0.0.1", "169.254.169.254"}}
+	dialer := &egressDialer{allowed: allowed, resolver: resolver, dialer: &net.Dialer{}}
+	c := &JenkinsClient{client: &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext, DisableKeepAlives: true}}}
+	location := "http://artifacts.example.com:" + port + "/artifact"
+
+	stream, err := c.StreamArtifact(location, "sa-token")
+	if err != nil {
+		t.Fatalf("expected the allowed address to be dialled but got %v", err)
+	}
+	stream.Close()
+	if resolver.lookups != 1 {
+		t.Fatalf("expected the host to be resolved once per connection but it was resolved %d times", resolver.lookups)
+	}
+	if _, err := c.StreamArtifact(location, "sa-token"); err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf("expected the rebound address to be refused but got %v", err)
+	}
+	if _, err := c.StreamArtifact("http://10.1.2.3:"+port+"/artifact", "sa-token"); err == nil {
+		t.Fatal("expected an address literal outside the allowed ranges to be refused")
+	}
+}
@@ -1,13 +1,23 @@
 package jenkins
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"mime"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/budget"
 )
 
 type Artifact struct {
@@ -22,6 +32,12 @@ type JenkinsBuildInfo struct {
 
 type JenkinsClient struct {
 	client *http.Client
+	//extraHeaders are set on every request to Jenkins, e.g. for a proxy in front of it
+	extraHeaders http.Header
+	//limiter bounds the number of requests open to Jenkins at once, it is nil when they are unlimited
+	limiter *connectionLimiter
+	//redirects is the policy installed as the http client's CheckRedirect, used to audit downloads
+	redirects redirectPolicy
 }
 
 func (c *JenkinsClient) GetBuildInfo(buildUrl string, authToken string) (*JenkinsBuildInfo, error) {
@@ -31,13 +47,16 @@ func (c *JenkinsClient) GetBuildInfo(buildUrl string, authToken string) (*Jenkin
 	if err != nil {
 		return nil, errors.New("request failed to Jenkins build api " + err.Error())
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authToken))
+	c.setHeaders(req, authToken)
+	if err := c.limiter.acquire(context.Background()); err != nil {
+		return nil, err
+	}
+	defer c.limiter.release()
 	res, err := c.client.Do(req)
-	defer res.Body.Close()
-
 	if err != nil {
 		return nil, errors.New("error parsing response from Jenkins for build " + err.Error())
 	}
+	defer res.Body.Close()
 
 	decoder := json.NewDecoder(res.Body)
 	if err := decoder.Decode(&buildStatus); err != nil {
@@ -46,25 +65,184 @@ func (c *JenkinsClient) GetBuildInfo(buildUrl string, authToken string) (*Jenkin
 	return buildStatus, nil
 }
 
-func (c *JenkinsClient) StreamArtifact(location string, token string) (io.ReadCloser, error) {
+//ArtifactStream is the body of an artifact download from Jenkins
+type ArtifactStream struct {
+	io.ReadCloser
+	//Filename is the name Jenkins gave the artifact in its Content-Disposition header, empty when it gave none
+	Filename string
+	//ETag and LastModified are the validators Jenkins sent for the artifact, if any
+	ETag         string
+	LastModified string
+	//NotModified is set when a conditional request found the artifact unchanged, there is no body to read then
+	NotModified bool
+}
+
+//cancelOnClose releases the context of a stream, and the connection it holds, once the stream is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.once.Do(c.cancel)
+	return c.ReadCloser.Close()
+}
+
+func (c *JenkinsClient) StreamArtifact(location string, token string) (*ArtifactStream, error) {
+	return c.StreamArtifactConditional(location, token, nil)
+}
+
+//StreamArtifactConditional streams an artifact, passing on conditional request headers such as If-None-Match so
+//Jenkins can answer that the artifact has not changed
+func (c *JenkinsClient) StreamArtifactConditional(location string, token string, conditions http.Header) (*ArtifactStream, error) {
+	return c.StreamArtifactContext(context.Background(), location, token, conditions)
+}
+
+//StreamArtifactContext streams an artifact for as long as the context is not done. Its request budget only bounds
+//waiting for Jenkins to start responding, a download which started in time is not cut off
+func (c *JenkinsClient) StreamArtifactContext(ctx context.Context, location string, token string, conditions http.Header) (*ArtifactStream, error) {
+	if err := c.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	ctx, cancelCtx := context.WithCancel(ctx)
+	cancel := func() {
+		cancelCtx()
+		c.limiter.release()
+	}
 	req, err := http.NewRequest("GET", location, nil)
 	if err != nil {
+		cancel()
 		return nil, errors.New(fmt.Sprintf("failed to create jenkins download request %s", err.Error()))
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	chain := &redirectChain{}
+	req = req.WithContext(withRedirectChain(ctx, chain))
+	for k, v := range conditions {
+		req.Header[k] = v
+	}
+	c.setHeaders(req, token)
+	var outOfBudget *time.Timer
+	if deadline, ok := budget.Deadline(ctx); ok {
+		outOfBudget = time.AfterFunc(time.Until(deadline), cancelCtx)
+	}
 	res, err := c.client.Do(req)
+	c.redirects.logChain(location, chain)
+	if outOfBudget != nil && !outOfBudget.Stop() && err == nil {
+		res.Body.Close()
+		err = errors.New("request budget exceeded")
+	}
+	if isTooManyRedirects(err) {
+		cancel()
+		return nil, ErrTooManyRedirects
+	}
 	if err != nil {
+		cancel()
 		return nil, errors.New(fmt.Sprintf("unexpected error making GET request to Jenkins %s", err.Error()))
 	}
-	if res.StatusCode != http.StatusOK {
+	if res.StatusCode != http.StatusOK && (res.StatusCode != http.StatusNotModified || len(conditions) == 0) {
+		res.Body.Close()
+		cancel()
 		return nil, errors.New("unexpected response code from Jenkins download " + res.Status)
 	}
 	// hand body back to caller to be closed
-	return res.Body, nil
+	return &ArtifactStream{
+		ReadCloser:   &cancelOnClose{ReadCloser: res.Body, cancel: cancel},
+		Filename:     dispositionFilename(res.Header.Get("Content-Disposition")),
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		NotModified:  res.StatusCode == http.StatusNotModified,
+	}, nil
+}
+
+//dispositionFilename returns the filename from a Content-Disposition header, stripped of any path and of characters
+//which are not safe to send back in a header of our own
+func dispositionFilename(disposition string) string {
+	if disposition == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		return ""
+	}
+	name := params["filename"]
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
+
+func (c *JenkinsClient) setHeaders(req *http.Request, token string) {
+	for k, v := range c.extraHeaders {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 }
 
 func NewJenkinsClient() *JenkinsClient {
-	return &JenkinsClient{generateClient()}
+	headers, err := ParseExtraHeaders(os.Getenv("JENKINS_EXTRA_HEADERS"))
+	if err != nil {
+		log.Fatal("error parsing JENKINS_EXTRA_HEADERS - error " + err.Error())
+	}
+	for k, v := range headers {
+		log.Printf("sending header %s=%s on requests to Jenkins", k, redactHeader(k, v[0]))
+	}
+	client := generateClient()
+	if os.Getenv("STRICT_EGRESS") == "true" {
+		allowed, err := ParseCIDRs(os.Getenv("EGRESS_ALLOWED_CIDRS"))
+		if err != nil {
+			log.Fatal("error parsing EGRESS_ALLOWED_CIDRS - error " + err.Error())
+		}
+		if len(allowed) == 0 {
+			log.Fatal("STRICT_EGRESS requires EGRESS_ALLOWED_CIDRS to be set")
+		}
+		dialer := &egressDialer{allowed: allowed, resolver: net.DefaultResolver, dialer: &net.Dialer{Timeout: 5 * time.Second}}
+		client.Transport.(*http.Transport).DialContext = dialer.DialContext
+		log.Printf("restricting downloads to addresses in %s", os.Getenv("EGRESS_ALLOWED_CIDRS"))
+	}
+	redirects := redirectPolicyFromEnv()
+	client.CheckRedirect = redirects.check
+	return &JenkinsClient{client: client, extraHeaders: headers, limiter: connectionLimiterFromEnv(), redirects: redirects}
+}
+
+//ParseExtraHeaders parses a comma separated list of Key=Value pairs. The Authorization header is always set from the
+//service account token and can not be overridden
+func ParseExtraHeaders(val string) (http.Header, error) {
+	headers := http.Header{}
+	for _, pair := range strings.Split(val, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return nil, errors.New("invalid header " + pair + ", expected Key=Value")
+		}
+		if http.CanonicalHeaderKey(key) == "Authorization" {
+			return nil, errors.New("the Authorization header can not be set as an extra header")
+		}
+		headers.Add(key, strings.TrimSpace(kv[1]))
+	}
+	return headers, nil
+}
+
+//redactHeader hides the value of headers which look like they carry credentials so they do not end up in logs
+func redactHeader(key string, value string) string {
+	lower := strings.ToLower(key)
+	for _, sensitive := range []string{"token", "auth", "key", "secret", "password", "cookie"} {
+		if strings.Contains(lower, sensitive) {
+			return "[redacted]"
+		}
+	}
+	return value
 }
 
 func generateClient() *http.Client {
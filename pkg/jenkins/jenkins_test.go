@@ -1 +1,209 @@
 package jenkins
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamArtifactSendsExtraHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		rw.Write([]byte("artifact"))
+	}))
+	defer server.Close()
+
+	headers, err := ParseExtraHeaders("X-Forwarded-Access-Token=abc, X-Cdn-Auth = def")
+	if err != nil {
+		t.Fatalf("unexpected error parsing headers %v", err)
+	}
+	c := &JenkinsClient{client: server.Client(), extraHeaders: headers}
+	stream, err := c.StreamArtifact(server.URL+"/artifact", "sa-token")
+	if err != nil {
+		t.Fatalf("unexpected error streaming artifact %v", err)
+	}
+	ioutil.ReadAll(stream)
+	stream.Close()
+
+	if received.Get("X-Forwarded-Access-Token") != "abc" || received.Get("X-Cdn-Auth") != "def" {
+		t.Fatalf("expected the extra headers on the upstream request but got %v", received)
+	}
+	if received.Get("Authorization") != "Bearer sa-token" {
+		t.Fatalf("expected the service account token to be sent but got %q", received.Get("Authorization"))
+	}
+}
+
+func TestParseExtraHeaders(t *testing.T) {
+	for _, invalid := range []string{"X-Missing-Value", "=value", "Authorization=Bearer x"} {
+		if _, err := ParseExtraHeaders(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+	if headers, err := ParseExtraHeaders(""); err != nil || len(headers) != 0 {
+		t.Fatalf("expected no headers for an empty value but got %v %v", headers, err)
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	if v := redactHeader("X-Forwarded-Access-Token", "abc"); v != "[redacted]" {
+		t.Fatalf("expected a token header to be redacted but got %q", v)
+	}
+	if v := redactHeader("X-Tenant", "team-a"); v != "team-a" {
+		t.Fatalf("expected a plain header to be logged but got %q", v)
+	}
+}
+
+func TestStreamArtifactFilename(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Disposition", r.URL.Query().Get("disposition"))
+		rw.Write([]byte("artifact"))
+	}))
+	defer server.Close()
+	c := &JenkinsClient{client: server.Client()}
+
+	for disposition, expected := range map[string]string{
+		`attachment; filename="app-release.apk"`:  "app-release.apk",
+		`attachment; filename="../../etc/passwd"`: "passwd",
+		`attachment; filename="dir\\app.ipa"`:     "app.ipa",
+		`attachment`:                              "",
+		`attachment; filename=".."`:               "",
+		``:                                        "",
+	} {
+		stream, err := c.StreamArtifact(server.URL+"/artifact?disposition="+url.QueryEscape(disposition), "sa-token")
+		if err != nil {
+			t.Fatalf("unexpected error streaming artifact %v", err)
+		}
+		stream.Close()
+		if stream.Filename != expected {
+			t.Errorf("expected filename %q for %q but got %q", expected, disposition, stream.Filename)
+		}
+	}
+}
+
+func TestStreamArtifactConditional(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.Write([]byte("artifact"))
+	}))
+	defer server.Close()
+	c := &JenkinsClient{client: server.Client()}
+
+	stream, err := c.StreamArtifactConditional(server.URL+"/artifact", "sa-token", http.Header{"If-None-Match": {`"v1"`}})
+	if err != nil {
+		t.Fatalf("unexpected error streaming artifact %v", err)
+	}
+	stream.Close()
+	if !stream.NotModified || stream.ETag != `"v1"` {
+		t.Fatalf("expected an unmodified stream with etag but got %+v", stream)
+	}
+	stream, err = c.StreamArtifactConditional(server.URL+"/artifact", "sa-token", http.Header{"If-None-Match": {`"v0"`}})
+	if err != nil {
+		t.Fatalf("unexpected error streaming artifact %v", err)
+	}
+	stream.Close()
+	if stream.NotModified {
+		t.Fatal("expected a changed artifact to be streamed")
+	}
+}
+
+func TestRangeReader(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), rangeBlockSize/5)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.ServeContent(rw, r, "artifact.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	c := &JenkinsClient{client: server.Client()}
+
+	reader, err := c.OpenRanged(server.URL+"/artifact.zip", "sa-token")
+	if err != nil {
+		t.Fatalf("unexpected error opening ranged artifact %v", err)
+	}
+	if reader.Size != int64(len(content)) {
+		t.Fatalf("expected size %d but got %d", len(content), reader.Size)
+	}
+	// a read spanning two blocks
+	p := make([]byte, 20)
+	if _, err := reader.ReadAt(p, rangeBlockSize-10); err != nil {
+		t.Fatalf("unexpected error reading %v", err)
+	}
+	if !bytes.Equal(p, content[rangeBlockSize-10:rangeBlockSize+10]) {
+		t.Fatalf("unexpected content %q", p)
+	}
+	if _, err := reader.ReadAt(p[:5], rangeBlockSize+100); err != nil {
+		t.Fatalf("unexpected error reading %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Fatalf("expected reads within a block to be served from memory, got %d requests", requests)
+	}
+	if n, err := reader.ReadAt(p, int64(len(content))-5); n != 5 || err != io.EOF {
+		t.Fatalf("expected a short read at the end of the artifact but got %d %v", n, err)
+	}
+}
+
+func TestOpenRangedRequiresRangeSupport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("artifact"))
+	}))
+	defer server.Close()
+	c := &JenkinsClient{client: server.Client()}
+
+	if _, err := c.OpenRanged(server.URL+"/artifact.zip", "sa-token"); err == nil {
+		t.Fatal("expected an error for a server without range support")
+	}
+}
+
+func TestArtifactSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			t.Errorf("expected a HEAD request but got %s", r.Method)
+		}
+		if r.URL.Path == "/missing" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("Content-Length", "1234")
+	}))
+	defer server.Close()
+	c := &JenkinsClient{client: server.Client()}
+
+	size, err := c.ArtifactSize(context.Background(), server.URL+"/artifact.apk", "sa-token")
+	if err != nil || size != 1234 {
+		t.Fatalf("expected the size Jenkins gave but got %d %v", size, err)
+	}
+	if _, err := c.ArtifactSize(context.Background(), server.URL+"/missing", "sa-token"); err == nil {
+		t.Fatal("expected an error for a missing artifact")
+	}
+}
+
+func TestRangeReaderCancelled(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), rangeBlockSize/5)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.ServeContent(rw, r, "artifact.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	c := &JenkinsClient{client: server.Client()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, err := c.OpenRangedContext(ctx, server.URL+"/artifact.zip", "sa-token")
+	if err != nil {
+		t.Fatalf("unexpected error opening ranged artifact %v", err)
+	}
+	cancel()
+	if _, err := reader.ReadAt(make([]byte, 10), 0); err == nil {
+		t.Fatal("expected reads to fail once the request was cancelled")
+	}
+}
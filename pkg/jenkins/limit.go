@@ -0,0 +1,98 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+//ErrTooManyConnections is returned when no connection to Jenkins came free within the configured wait
+var ErrTooManyConnections = errors.New("too many concurrent connections to Jenkins")
+
+//defaultConnectionWait is how long a request waits for a free connection when JENKINS_CONNECTION_WAIT_MS is not set
+const defaultConnectionWait = 5 * time.Second
+
+//connectionLimiter caps how many requests the proxy has open to Jenkins at once, across all downloads
+type connectionLimiter struct {
+	slots  chan struct{}
+	wait   time.Duration
+	active int64
+}
+
+func newConnectionLimiter(max int, wait time.Duration) *connectionLimiter {
+	return &connectionLimiter{slots: make(chan struct{}, max), wait: wait}
+}
+
+//connectionLimiterFromEnv reads JENKINS_MAX_CONNECTIONS and JENKINS_CONNECTION_WAIT_MS, nil is returned when
+//connections are unlimited
+func connectionLimiterFromEnv() *connectionLimiter {
+	val := os.Getenv("JENKINS_MAX_CONNECTIONS")
+	if val == "" {
+		return nil
+	}
+	max, err := strconv.Atoi(val)
+	if err != nil || max < 0 {
+		log.Printf("ignoring invalid JENKINS_MAX_CONNECTIONS %q", val)
+		return nil
+	}
+	if max == 0 {
+		return nil
+	}
+	wait := defaultConnectionWait
+	if val := os.Getenv("JENKINS_CONNECTION_WAIT_MS"); val != "" {
+		ms, err := strconv.Atoi(val)
+		if err != nil || ms < 0 {
+			log.Printf("ignoring invalid JENKINS_CONNECTION_WAIT_MS %q", val)
+		} else {
+			wait = time.Duration(ms) * time.Millisecond
+		}
+	}
+	log.Printf("limiting requests to Jenkins to %d at a time", max)
+	return newConnectionLimiter(max, wait)
+}
+
+//acquire takes a connection, waiting for one to come free until the wait runs out or the context is done. The
+//context's error is returned in that case, so a request which was given up on is not reported as Jenkins being busy
+func (l *connectionLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		atomic.AddInt64(&l.active, 1)
+		return nil
+	default:
+	}
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		atomic.AddInt64(&l.active, 1)
+		return nil
+	case <-timer.C:
+		return ErrTooManyConnections
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *connectionLimiter) release() {
+	if l == nil {
+		return
+	}
+	atomic.AddInt64(&l.active, -1)
+	<-l.slots
+}
+
+//ActiveConnections is the number of requests currently open to Jenkins. It is only tracked when
+//JENKINS_MAX_CONNECTIONS is set
+func (c *JenkinsClient) ActiveConnections() int64 {
+	if c.limiter == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.limiter.active)
+}
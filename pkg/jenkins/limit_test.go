@@ -0,0 +1,97 @@
+package jenkins
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnectionLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("artifact"))
+	}))
+	defer server.Close()
+	c := &JenkinsClient{client: server.Client(), limiter: newConnectionLimiter(2, 20*time.Millisecond)}
+
+	first, err := c.StreamArtifact(server.URL+"/artifact", "sa-token")
+	if err != nil {
+		t.Fatalf("unexpected error streaming artifact %v", err)
+	}
+	second, err := c.StreamArtifact(server.URL+"/artifact", "sa-token")
+	if err != nil {
+		t.Fatalf("unexpected error streaming artifact %v", err)
+	}
+	if active := c.ActiveConnections(); active != 2 {
+		t.Fatalf("expected 2 active connections but got %d", active)
+	}
+	if _, err := c.StreamArtifact(server.URL+"/artifact", "sa-token"); err != ErrTooManyConnections {
+		t.Fatalf("expected %v with every connection in use but got %v", ErrTooManyConnections, err)
+	}
+
+	// a waiting request gets the connection as soon as a stream is closed
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		ioutil.ReadAll(first)
+		first.Close()
+	}()
+	c.limiter.wait = time.Second
+	third, err := c.StreamArtifact(server.URL+"/artifact", "sa-token")
+	if err != nil {
+		t.Fatalf("expected a connection to come free but got %v", err)
+	}
+	third.Close()
+	second.Close()
+	second.Close()
+	if active := c.ActiveConnections(); active != 0 {
+		t.Fatalf("expected no active connections after closing every stream but got %d", active)
+	}
+
+	// failed requests give their connection back too
+	for i := 0; i < 3; i++ {
+		if _, err := c.StreamArtifact("http://[::1]:0/artifact", "sa-token"); err == nil || err == ErrTooManyConnections {
+			t.Fatalf("expected the request to fail to connect but got %v", err)
+		}
+	}
+	if active := c.ActiveConnections(); active != 0 {
+		t.Fatalf("expected no active connections after failed requests but got %d", active)
+	}
+}
+
+func TestConnectionLimitBuildInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(`{"timestamp": 1}`))
+	}))
+	defer server.Close()
+	c := &JenkinsClient{client: server.Client(), limiter: newConnectionLimiter(1, 20*time.Millisecond)}
+
+	held, err := c.StreamArtifact(server.URL+"/artifact", "sa-token")
+	if err != nil {
+		t.Fatalf("unexpected error streaming artifact %v", err)
+	}
+	if _, err := c.GetBuildInfo(server.URL+"/job/app/1/", "sa-token"); err != ErrTooManyConnections {
+		t.Fatalf("expected build info to wait for a connection too but got %v", err)
+	}
+	held.Close()
+	if _, err := c.GetBuildInfo(server.URL+"/job/app/1/", "sa-token"); err != nil {
+		t.Fatalf("expected build info once a connection came free but got %v", err)
+	}
+	if active := c.ActiveConnections(); active != 0 {
+		t.Fatalf("expected build info to give its connection back but %d are active", active)
+	}
+}
+
+func TestConnectionLimitCancelled(t *testing.T) {
+	limiter := newConnectionLimiter(1, time.Second)
+	if err := limiter.acquire(context.Background()); err != nil {
+		t.Fatalf("unexpected error taking a connection %v", err)
+	}
+	defer limiter.release()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.acquire(ctx); err != context.Canceled {
+		t.Fatalf("expected a cancelled request to get %v rather than being told Jenkins is busy, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,152 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/budget"
+)
+
+// rangeBlockSize is how much is fetched from Jenkins per ranged request, reads within a block are served from memory
+const rangeBlockSize = 1 << 20
+
+//RangeReader gives random access to an artifact in Jenkins through ranged requests, e.g. to read a single entry out of
+//a zip without downloading all of it
+type RangeReader struct {
+	client   *JenkinsClient
+	ctx      context.Context
+	location string
+	token    string
+	//Size is the length of the artifact in bytes
+	Size int64
+
+	lock       sync.Mutex
+	block      []byte
+	blockStart int64
+}
+
+//OpenRanged checks that Jenkins serves the artifact at location with ranged requests and returns a reader for it
+func (c *JenkinsClient) OpenRanged(location string, token string) (*RangeReader, error) {
+	return c.OpenRangedContext(context.Background(), location, token)
+}
+
+//OpenRangedContext is OpenRanged for a request. The reader's ranged requests are abandoned once the context is done,
+//and its request budget bounds the check that Jenkins supports them
+func (c *JenkinsClient) OpenRangedContext(ctx context.Context, location string, token string) (*RangeReader, error) {
+	res, err := c.head(ctx, location, token)
+	if err != nil {
+		return nil, err
+	}
+	if res.Header.Get("Accept-Ranges") != "bytes" || res.ContentLength < 0 {
+		return nil, errors.New("Jenkins does not support ranged downloads of " + location)
+	}
+	return &RangeReader{client: c, ctx: ctx, location: location, token: token, Size: res.ContentLength, blockStart: -1}, nil
+}
+
+//ArtifactSize asks Jenkins for the size of the artifact at location without downloading it, -1 when Jenkins does not
+//say. The request budget of the context bounds the request
+func (c *JenkinsClient) ArtifactSize(ctx context.Context, location string, token string) (int64, error) {
+	res, err := c.head(ctx, location, token)
+	if err != nil {
+		return 0, err
+	}
+	return res.ContentLength, nil
+}
+
+//head makes a HEAD request for the artifact at location, failing unless Jenkins answers 200. The body is closed
+func (c *JenkinsClient) head(ctx context.Context, location string, token string) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", location, nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to create jenkins download request %s", err.Error()))
+	}
+	if deadline, ok := budget.Deadline(ctx); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+	c.setHeaders(req, token)
+	if err := c.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(req)
+	c.limiter.release()
+	if isTooManyRedirects(err) {
+		return nil, ErrTooManyRedirects
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unexpected error making HEAD request to Jenkins %s", err.Error()))
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected response code from Jenkins download " + res.Status)
+	}
+	return res, nil
+}
+
+//ReadAt implements io.ReaderAt
+func (r *RangeReader) ReadAt(p []byte, off int64) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.Size {
+			return n, io.EOF
+		}
+		start := pos - pos%rangeBlockSize
+		if start != r.blockStart {
+			if err := r.fetch(start); err != nil {
+				return n, err
+			}
+		}
+		n += copy(p[n:], r.block[pos-start:])
+	}
+	return n, nil
+}
+
+func (r *RangeReader) fetch(start int64) error {
+	end := start + rangeBlockSize
+	if end > r.Size {
+		end = r.Size
+	}
+	req, err := http.NewRequest("GET", r.location, nil)
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to create jenkins download request %s", err.Error()))
+	}
+	req = req.WithContext(r.ctx)
+	r.client.setHeaders(req, r.token)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if err := r.client.limiter.acquire(r.ctx); err != nil {
+		return err
+	}
+	defer r.client.limiter.release()
+	res, err := r.client.client.Do(req)
+	if isTooManyRedirects(err) {
+		return ErrTooManyRedirects
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("unexpected error making GET request to Jenkins %s", err.Error()))
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent {
+		return errors.New("unexpected response code from Jenkins ranged download " + res.Status)
+	}
+	block, err := ioutil.ReadAll(io.LimitReader(res.Body, end-start))
+	if err != nil {
+		return errors.New("error reading ranged download from Jenkins " + err.Error())
+	}
+	if int64(len(block)) != end-start {
+		return errors.New("short ranged download from Jenkins")
+	}
+	r.block, r.blockStart = block, start
+	return nil
+}
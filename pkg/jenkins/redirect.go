@@ -0,0 +1,88 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//ErrTooManyRedirects is returned when a download was redirected more times than JENKINS_MAX_REDIRECTS allows,
+//usually a redirect loop between Jenkins and the storage behind it
+var ErrTooManyRedirects = errors.New("too many redirects downloading from Jenkins")
+
+//defaultMaxRedirects matches the limit of the Go http client
+const defaultMaxRedirects = 10
+
+//redirectPolicy bounds how many redirects a request to Jenkins follows and, when audit is set, logs the hosts each
+//download was redirected through so there is a record of where its bytes came from
+type redirectPolicy struct {
+	max   int
+	audit bool
+}
+
+//redirectPolicyFromEnv reads JENKINS_MAX_REDIRECTS and JENKINS_AUDIT_REDIRECTS
+func redirectPolicyFromEnv() redirectPolicy {
+	policy := redirectPolicy{max: defaultMaxRedirects, audit: os.Getenv("JENKINS_AUDIT_REDIRECTS") == "true"}
+	if val := os.Getenv("JENKINS_MAX_REDIRECTS"); val != "" {
+		max, err := strconv.Atoi(val)
+		if err != nil || max < 0 {
+			log.Printf("ignoring invalid JENKINS_MAX_REDIRECTS %q", val)
+		} else {
+			policy.max = max
+		}
+	}
+	return policy
+}
+
+//redirectChain collects the hosts a request was redirected through, it is carried in the request context
+type redirectChain struct {
+	lock  sync.Mutex
+	hosts []string
+}
+
+type redirectChainKey struct{}
+
+//withRedirectChain records the redirects of requests made with the returned context in chain
+func withRedirectChain(ctx context.Context, chain *redirectChain) context.Context {
+	return context.WithValue(ctx, redirectChainKey{}, chain)
+}
+
+//check is the CheckRedirect of the Jenkins http client. via holds the requests made so far, so the first redirect
+//sees one
+func (p redirectPolicy) check(req *http.Request, via []*http.Request) error {
+	if chain, ok := req.Context().Value(redirectChainKey{}).(*redirectChain); ok {
+		chain.lock.Lock()
+		chain.hosts = append(chain.hosts, req.URL.Host)
+		chain.lock.Unlock()
+	}
+	if len(via) > p.max {
+		return ErrTooManyRedirects
+	}
+	return nil
+}
+
+//logChain logs the hosts a download of location went through, when auditing is on and it was redirected at all
+func (p redirectPolicy) logChain(location string, chain *redirectChain) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	if !p.audit || len(chain.hosts) == 0 {
+		return
+	}
+	origin := location
+	if u, err := url.Parse(location); err == nil {
+		origin = u.Host
+	}
+	log.Printf("download from %s was redirected via %s", origin, strings.Join(chain.hosts, " -> "))
+}
+
+//isTooManyRedirects reports whether err from the http client was caused by the redirect limit
+func isTooManyRedirects(err error) bool {
+	urlErr, ok := err.(*url.Error)
+	return ok && urlErr.Err == ErrTooManyRedirects
+}
@@ -0,0 +1,80 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//redirectingServers serve an artifact from /hop/0. Any other /hop/<n> redirects to /hop/<n-1>, alternating between the
+//two servers
+func redirectingServers() (*httptest.Server, *httptest.Server) {
+	var jenkins, storage *httptest.Server
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		left, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if left == 0 {
+			rw.Write([]byte("artifact"))
+			return
+		}
+		next := jenkins
+		if left%2 == 1 {
+			next = storage
+		}
+		http.Redirect(rw, r, next.URL+"/hop/"+strconv.Itoa(left-1)+"?signature=secret", http.StatusFound)
+	}
+	jenkins = httptest.NewServer(http.HandlerFunc(handler))
+	storage = httptest.NewServer(http.HandlerFunc(handler))
+	return jenkins, storage
+}
+
+func TestRedirectChainAudit(t *testing.T) {
+	jenkins, storage := redirectingServers()
+	defer jenkins.Close()
+	defer storage.Close()
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	redirects := redirectPolicy{max: 3, audit: true}
+	client := &http.Client{CheckRedirect: redirects.check}
+	c := &JenkinsClient{client: client, redirects: redirects}
+
+	stream, err := c.StreamArtifact(jenkins.URL+"/hop/3", "sa-token")
+	if err != nil {
+		t.Fatalf("expected a chain within the limit to be followed but got %v", err)
+	}
+	body, _ := ioutil.ReadAll(stream)
+	stream.Close()
+	if string(body) != "artifact" {
+		t.Fatalf("expected the artifact but got %q", body)
+	}
+	jenkinsHost, storageHost := strings.TrimPrefix(jenkins.URL, "http://"), strings.TrimPrefix(storage.URL, "http://")
+	chain := "download from " + jenkinsHost + " was redirected via " + storageHost + " -> " + jenkinsHost + " -> " + storageHost
+	if !strings.Contains(logged.String(), chain) {
+		t.Fatalf("expected the redirect chain %q to be logged but got %q", chain, logged.String())
+	}
+	if strings.Contains(logged.String(), "secret") || strings.Contains(logged.String(), "/hop/") {
+		t.Fatalf("expected only hosts to be logged but got %q", logged.String())
+	}
+}
+
+func TestRedirectLimit(t *testing.T) {
+	jenkins, storage := redirectingServers()
+	defer jenkins.Close()
+	defer storage.Close()
+	redirects := redirectPolicy{max: 3}
+	c := &JenkinsClient{client: &http.Client{CheckRedirect: redirects.check}, redirects: redirects}
+
+	if _, err := c.StreamArtifact(jenkins.URL+"/hop/4", "sa-token"); err != ErrTooManyRedirects {
+		t.Fatalf("expected a chain over the limit to fail with ErrTooManyRedirects but got %v", err)
+	}
+	if _, err := c.ArtifactSize(context.Background(), jenkins.URL+"/hop/4", "sa-token"); err != ErrTooManyRedirects {
+		t.Fatalf("expected a HEAD over the limit to fail with ErrTooManyRedirects but got %v", err)
+	}
+}
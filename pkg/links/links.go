@@ -0,0 +1,59 @@
+package links
+
+import (
+	"net/url"
+)
+
+//Link describes a build served by the artifact proxy. Download URLs are generated from it so that programs creating
+//builds do not need to know how the proxy lays out its routes
+type Link struct {
+	//Host is the public hostname of the artifact proxy
+	Host string
+	//Build is the name of the build
+	Build string
+	//Token is the download token of the build, it is left out of the URL when empty
+	Token string
+	//Params are any extra query parameters to pass along, e.g. an iOS variant
+	Params url.Values
+}
+
+//Download returns the URL an android build is downloaded from. For iOS builds it is the landing page which starts
+//the install
+func (l Link) Download() string {
+	return l.build(nil)
+}
+
+//IosArtifact returns the URL of an iOS build's IPA, as referred to by its install manifest
+func (l Link) IosArtifact() string {
+	return l.Artifact()
+}
+
+//Artifact returns the URL which downloads a build's binary directly, skipping any landing page
+func (l Link) Artifact() string {
+	return l.build(url.Values{"artifact": {"true"}})
+}
+
+//IosManifest returns the URL of an iOS build's install manifest plist
+func (l Link) IosManifest() string {
+	return l.build(url.Values{"plist": {"true"}})
+}
+
+//ItmsServices returns the itms-services URL which makes an iOS device install a build
+func (l Link) ItmsServices() string {
+	return "itms-services://?action=download-manifest&url=" + url.QueryEscape(l.IosManifest())
+}
+
+func (l Link) build(extra url.Values) string {
+	params := url.Values{}
+	for k, v := range l.Params {
+		params[k] = v
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	if l.Token != "" {
+		params.Set("token", l.Token)
+	}
+	u := url.URL{Scheme: "https", Host: l.Host, Path: "/" + l.Build + "/download", RawQuery: params.Encode()}
+	return u.String()
+}
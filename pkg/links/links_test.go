@@ -0,0 +1,38 @@
+package links
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+	l := Link{Host: "proxy.example.com", Build: "app-1", Token: "app-1-123"}
+	cases := []struct {
+		name   string
+		got    string
+		expect string
+	}{
+		{"download", l.Download(), "https://proxy.example.com/app-1/download?token=app-1-123"},
+		{"ios artifact", l.IosArtifact(), "https://proxy.example.com/app-1/download?artifact=true&token=app-1-123"},
+		{"ios manifest", l.IosManifest(), "https://proxy.example.com/app-1/download?plist=true&token=app-1-123"},
+		{"itms services", l.ItmsServices(), "itms-services://?action=download-manifest&url=https%3A%2F%2Fproxy.example.com%2Fapp-1%2Fdownload%3Fplist%3Dtrue%26token%3Dapp-1-123"},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.expect {
+			t.Errorf("%s: expected %s but got %s", tc.name, tc.expect, tc.got)
+		}
+	}
+}
+
+func TestLinkParamsAndEscaping(t *testing.T) {
+	l := Link{Host: "proxy.example.com", Build: "app-1", Token: "a&b", Params: url.Values{"variant": {"enterprise"}}}
+	expect := "https://proxy.example.com/app-1/download?artifact=true&token=a%26b&variant=enterprise"
+	if got := l.IosArtifact(); got != expect {
+		t.Fatalf("expected %s but got %s", expect, got)
+	}
+
+	l = Link{Host: "proxy.example.com", Build: "app-1"}
+	if got := l.Download(); got != "https://proxy.example.com/app-1/download" {
+		t.Fatalf("expected no token parameter but got %s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Level is how important a log line is, lines below the level of a Logger are dropped
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = map[Level]string{Debug: "debug", Info: "info", Warn: "warn", Error: "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+//ParseLevel parses debug, info, warn or error
+func ParseLevel(val string) (Level, bool) {
+	for level, name := range levelNames {
+		if strings.EqualFold(val, name) {
+			return level, true
+		}
+	}
+	return Info, false
+}
+
+//LevelFromEnv reads LOG_LEVEL, defaulting to info
+func LevelFromEnv() Level {
+	val := os.Getenv("LOG_LEVEL")
+	if val == "" {
+		return Info
+	}
+	level, ok := ParseLevel(val)
+	if !ok {
+		log.Printf("ignoring invalid LOG_LEVEL %q", val)
+	}
+	return level
+}
+
+//Logger writes leveled key=value lines tagged with the component they come from, e.g.
+//	level=info component=watch msg="initial list" builds=3
+type Logger struct {
+	component string
+	level     Level
+	lock      sync.Mutex
+	//out is where lines go, the standard logger is used when it is nil
+	out *log.Logger
+}
+
+//New creates a logger for component writing to the standard logger at LOG_LEVEL
+func New(component string) *Logger {
+	return &Logger{component: component, level: LevelFromEnv()}
+}
+
+//NewWithOutput creates a logger for component writing everything from level up to w
+func NewWithOutput(component string, level Level, w io.Writer) *Logger {
+	return &Logger{component: component, level: level, out: log.New(w, "", 0)}
+}
+
+//Debug logs msg with key value pairs of fields, e.g. Debug("event", "build", name)
+func (l *Logger) Debug(msg string, fields ...interface{}) {
+	l.write(Debug, msg, fields)
+}
+
+func (l *Logger) Info(msg string, fields ...interface{}) {
+	l.write(Info, msg, fields)
+}
+
+func (l *Logger) Warn(msg string, fields ...interface{}) {
+	l.write(Warn, msg, fields)
+}
+
+func (l *Logger) Error(msg string, fields ...interface{}) {
+	l.write(Error, msg, fields)
+}
+
+//Enabled reports whether lines at level are written
+func (l *Logger) Enabled(level Level) bool {
+	if l == nil {
+		return level >= Info
+	}
+	return level >= l.level
+}
+
+func (l *Logger) write(level Level, msg string, fields []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	component := ""
+	if l != nil {
+		component = l.component
+	}
+	var b strings.Builder
+	b.WriteString("level=" + level.String())
+	if component != "" {
+		b.WriteString(" component=" + component)
+	}
+	b.WriteString(" msg=" + quote(msg))
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		val := "(missing)"
+		if i+1 < len(fields) {
+			val = fmt.Sprint(fields[i+1])
+		}
+		b.WriteString(" " + key + "=" + quote(val))
+	}
+	if l == nil || l.out == nil {
+		log.Print(b.String())
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.out.Print(b.String())
+}
+
+//quote leaves simple values as they are and quotes the rest so every line splits cleanly into its fields
+func quote(val string) string {
+	if val == "" || strings.ContainsAny(val, " =\"\\") || strings.IndexFunc(val, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0 {
+		return strconv.Quote(val)
+	}
+	return val
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewWithOutput("watch", Info, buf)
+	l.Debug("hidden")
+	l.Info("initial list", "builds", 3)
+	l.Warn("bad annotation", "build", "app-1", "error", `invalid "value"`)
+	l.Error("odd", "key")
+
+	expected := []string{
+		`level=info component=watch msg="initial list" builds=3`,
+		`level=warn component=watch msg="bad annotation" build=app-1 error="invalid \"value\""`,
+		`level=error component=watch msg=odd key=(missing)`,
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected lines\n%s\nbut got\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, ok := ParseLevel("WARN"); !ok || level != Warn {
+		t.Fatalf("expected WARN to parse as warn but got %s", level)
+	}
+	if _, ok := ParseLevel("verbose"); ok {
+		t.Fatal("expected an unknown level to be rejected")
+	}
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import "sync"
+
+//OtherValue is the label value every value beyond the cap of a BoundedValues is reported as
+const OtherValue = "__other__"
+
+//BoundedValues caps how many distinct values a label takes, so a label set from annotations can be used without
+//letting the number of series grow without bound. The first values seen are kept and the rest become OtherValue
+type BoundedValues struct {
+	max  int
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+//NewBoundedValues keeps up to max distinct values
+func NewBoundedValues(max int) *BoundedValues {
+	return &BoundedValues{max: max, seen: map[string]bool{}}
+}
+
+//Value returns v when it is already known or there is room for it, and OtherValue otherwise
+func (b *BoundedValues) Value(v string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.seen[v] {
+		return v
+	}
+	if len(b.seen) >= b.max {
+		return OtherValue
+	}
+	b.seen[v] = true
+	return v
+}
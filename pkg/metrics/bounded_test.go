@@ -0,0 +1,18 @@
+package metrics
+
+import "testing"
+
+func TestBoundedValues(t *testing.T) {
+	b := NewBoundedValues(2)
+	for _, v := range []string{"a", "b", "a"} {
+		if got := b.Value(v); got != v {
+			t.Fatalf("expected %q to be kept but got %q", v, got)
+		}
+	}
+	if got := b.Value("c"); got != OtherValue {
+		t.Fatalf("expected a value beyond the cap to be %q but got %q", OtherValue, got)
+	}
+	if got := b.Value("b"); got != "b" {
+		t.Fatalf("expected a known value to be kept after the cap was reached but got %q", got)
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Exemplar links an observation to the trace it was made in, e.g. {"trace_id": "..."}
+type Exemplar map[string]string
+
+//HistogramVec is a histogram partitioned by a fixed set of labels. Each bucket keeps the exemplar of the latest
+//observation given one, which is exposed to OpenMetrics scrapers
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+	now     func() time.Time
+}
+
+type histogramSeries struct {
+	//counts holds the observations in each bucket, the last being +Inf
+	counts    []uint64
+	exemplars []*exemplarSample
+	sum       float64
+	count     uint64
+}
+
+type exemplarSample struct {
+	labels Exemplar
+	value  float64
+	at     time.Time
+}
+
+//NewHistogramVec creates a histogram with the given upper bounds and label names
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{name: name, help: help, labels: labels, buckets: sorted, series: map[string]*histogramSeries{}, now: time.Now}
+}
+
+//Name returns the metric name
+func (h *HistogramVec) Name() string {
+	return h.name
+}
+
+//Observe records v in the series with the given label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.ObserveWithExemplar(v, nil, labelValues...)
+}
+
+//ObserveWithExemplar records v and attaches the exemplar to the bucket it falls in. A nil exemplar is a plain
+//observation
+func (h *HistogramVec) ObserveWithExemplar(v float64, exemplar Exemplar, labelValues ...string) {
+	key := seriesKey(h.name, h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1), exemplars: make([]*exemplarSample, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+	s.count++
+	if len(exemplar) > 0 {
+		s.exemplars[i] = &exemplarSample{labels: exemplar, value: v, at: h.now()}
+	}
+}
+
+//Count returns the number of observations in the series with the given label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := seriesKey(h.name, h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(buf *bytes.Buffer, openMetrics bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		prefix := ""
+		if k != "" {
+			prefix = k + ","
+		}
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatFloat(h.buckets[i])
+			}
+			fmt.Fprintf(buf, "%s_bucket{%sle=%q} %d", h.name, prefix, le, cumulative)
+			if e := s.exemplars[i]; openMetrics && e != nil {
+				fmt.Fprintf(buf, " # {%s} %v %.3f", formatExemplar(e.labels), e.value, float64(e.at.UnixNano())/1e9)
+			}
+			buf.WriteString("\n")
+		}
+		labels := ""
+		if k != "" {
+			labels = "{" + k + "}"
+		}
+		fmt.Fprintf(buf, "%s_sum%s %v\n%s_count%s %d\n", h.name, labels, s.sum, h.name, labels, s.count)
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%v", f)
+}
+
+func formatExemplar(labels Exemplar) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, labels[name])
+	}
+	return strings.Join(pairs, ",")
+}
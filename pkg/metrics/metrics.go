@@ -0,0 +1,250 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Collector is a metric family which can be exposed by a Registry
+type Collector interface {
+	Name() string
+	//write writes the family in the prometheus text format, or the OpenMetrics format when openMetrics is set
+	write(buf *bytes.Buffer, openMetrics bool)
+}
+
+//familyName is the name a family is declared under. OpenMetrics declares counters without their _total suffix
+func familyName(name string, kind string, openMetrics bool) string {
+	if openMetrics && kind == "counter" {
+		return strings.TrimSuffix(name, "_total")
+	}
+	return name
+}
+
+//CounterVec is a counter partitioned by a fixed set of labels. Label values must come from a bounded set, e.g.
+//namespaces, never build names
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+//NewCounterVec creates a counter with the given label names
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+//Name returns the metric name
+func (c *CounterVec) Name() string {
+	return c.name
+}
+
+//Add adds v to the series with the given label values, in the order the labels were declared
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += v
+}
+
+//Inc adds one to the series with the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+//Value returns the current value of the series with the given label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+//Total returns the sum of all the series of the counter
+func (c *CounterVec) Total() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := 0.0
+	for _, v := range c.values {
+		total += v
+	}
+	return total
+}
+
+func (c *CounterVec) key(labelValues []string) string {
+	return seriesKey(c.name, c.labels, labelValues)
+}
+
+//seriesKey formats the labels of a series, which also identifies it within its family
+func seriesKey(name string, labels []string, labelValues []string) string {
+	if len(labelValues) != len(labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values but got %d", name, len(labels), len(labelValues)))
+	}
+	pairs := make([]string, len(labels))
+	for i, l := range labels {
+		pairs[i] = fmt.Sprintf("%s=%q", l, labelValues[i])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (c *CounterVec) write(buf *bytes.Buffer, openMetrics bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	family := familyName(c.name, "counter", openMetrics)
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s counter\n", family, c.help, family)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "" {
+			fmt.Fprintf(buf, "%s %v\n", c.name, c.values[k])
+			continue
+		}
+		fmt.Fprintf(buf, "%s{%s} %v\n", c.name, k, c.values[k])
+	}
+}
+
+//GaugeVec is a gauge partitioned by a fixed set of labels, whose series are set rather than added to
+type GaugeVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+//NewGaugeVec creates a gauge with the given label names
+func NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+//Name returns the metric name
+func (g *GaugeVec) Name() string {
+	return g.name
+}
+
+//Set sets the series with the given label values to v
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	key := seriesKey(g.name, g.labels, labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[key] = v
+}
+
+//Value returns the current value of the series with the given label values
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	key := seriesKey(g.name, g.labels, labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[key]
+}
+
+func (g *GaugeVec) write(buf *bytes.Buffer, openMetrics bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	keys := make([]string, 0, len(g.values))
+	for k := range g.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "" {
+			fmt.Fprintf(buf, "%s %v\n", g.name, g.values[k])
+			continue
+		}
+		fmt.Fprintf(buf, "%s{%s} %v\n", g.name, k, g.values[k])
+	}
+}
+
+//Func is a metric whose value is read from a function when it is collected, for values tracked elsewhere
+type Func struct {
+	name  string
+	help  string
+	kind  string
+	value func() float64
+}
+
+//NewGaugeFunc creates a gauge reporting the value returned by value
+func NewGaugeFunc(name string, help string, value func() float64) *Func {
+	return &Func{name: name, help: help, kind: "gauge", value: value}
+}
+
+//NewCounterFunc creates a counter reporting the value returned by value, which must never decrease
+func NewCounterFunc(name string, help string, value func() float64) *Func {
+	return &Func{name: name, help: help, kind: "counter", value: value}
+}
+
+//Name returns the metric name
+func (f *Func) Name() string {
+	return f.name
+}
+
+func (f *Func) write(buf *bytes.Buffer, openMetrics bool) {
+	family := familyName(f.name, f.kind, openMetrics)
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", family, f.help, family, f.kind, f.name, f.value())
+}
+
+//Registry exposes collectors in the prometheus text format, or the OpenMetrics format to scrapers asking for it. Only
+//OpenMetrics can carry exemplars
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+//DefaultRegistry is the registry served by the operator on /metrics
+var DefaultRegistry = NewRegistry()
+
+//NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+//AlreadyRegisteredError is returned registering a metric whose name is already taken, Existing is the collector
+//registered under it so callers registering again, e.g. on re-initialisation, can carry on using it
+type AlreadyRegisteredError struct {
+	Existing Collector
+}
+
+func (e AlreadyRegisteredError) Error() string {
+	return "metric " + e.Existing.Name() + " is already registered"
+}
+
+//Register adds a collector to the registry. Metric names must be unique within a registry
+func (r *Registry) Register(c Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collectors {
+		if existing.Name() == c.Name() {
+			return AlreadyRegisteredError{Existing: existing}
+		}
+	}
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+//ServeHTTP writes all registered metrics
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.Unlock()
+	openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+	var buf bytes.Buffer
+	for _, c := range collectors {
+		c.write(&buf, openMetrics)
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+		rw.Header().Set("content-type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		rw.Header().Set("content-type", "text/plain; version=0.0.4")
+	}
+	rw.Write(buf.Bytes())
+}
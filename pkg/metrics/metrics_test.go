@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryServesCounters(t *testing.T) {
+	reg := NewRegistry()
+	downloads := NewCounterVec("downloads_total", "Downloads served.", "namespace")
+	if err := reg.Register(downloads); err != nil {
+		t.Fatalf("unexpected error registering metric %v", err)
+	}
+	err := reg.Register(NewCounterVec("downloads_total", "Downloads served."))
+	if are, ok := err.(AlreadyRegisteredError); !ok || are.Existing != downloads {
+		t.Fatalf("expected the existing collector registering a metric name twice but got %v", err)
+	}
+	downloads.Inc("team-a")
+	downloads.Add(2, "team-b")
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `# HELP downloads_total Downloads served.
+# TYPE downloads_total counter
+downloads_total{namespace="team-a"} 1
+downloads_total{namespace="team-b"} 2
+`
+	if rec.Body.String() != expected {
+		t.Fatalf("expected metrics\n%s\nbut got\n%s", expected, rec.Body.String())
+	}
+	if downloads.Total() != 3 {
+		t.Fatalf("expected a total of 3 across namespaces but got %v", downloads.Total())
+	}
+}
+
+func TestCounterVecRejectsWrongLabelCount(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "expects 1 label values") {
+			t.Fatalf("expected a panic for missing label values but got %v", r)
+		}
+	}()
+	NewCounterVec("c", "c", "namespace").Inc()
+}
+
+func TestFuncMetrics(t *testing.T) {
+	reg := NewRegistry()
+	size := 42.0
+	reg.Register(NewGaugeFunc("cache_size_bytes", "Size of the cache.", func() float64 { return size }))
+	reg.Register(NewCounterFunc("cache_hits_total", "Cache hits.", func() float64 { return 3 }))
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `# HELP cache_size_bytes Size of the cache.
+# TYPE cache_size_bytes gauge
+cache_size_bytes 42
+# HELP cache_hits_total Cache hits.
+# TYPE cache_hits_total counter
+cache_hits_total 3
+`
+	if rec.Body.String() != expected {
+		t.Fatalf("expected metrics\n%s\nbut got\n%s", expected, rec.Body.String())
+	}
+}
+
+func TestGaugeVec(t *testing.T) {
+	reg := NewRegistry()
+	reachable := NewGaugeVec("source_reachable", "Reachable sources.", "source")
+	reg.Register(reachable)
+	reachable.Set(1, "s3")
+	reachable.Set(1, "jenkins")
+	reachable.Set(0, "jenkins")
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `# HELP source_reachable Reachable sources.
+# TYPE source_reachable gauge
+source_reachable{source="jenkins"} 0
+source_reachable{source="s3"} 1
+`
+	if rec.Body.String() != expected {
+		t.Fatalf("expected metrics\n%s\nbut got\n%s", expected, rec.Body.String())
+	}
+}
+
+func TestHistogramExemplars(t *testing.T) {
+	reg := NewRegistry()
+	durations := NewHistogramVec("download_duration_seconds", "Download durations.", []float64{1, 0.1}, "namespace")
+	durations.now = func() time.Time { return time.Unix(1500000000, 0) }
+	reg.Register(durations)
+	reg.Register(NewCounterFunc("downloads_total", "Downloads served.", func() float64 { return 2 }))
+	durations.Observe(0.05, "team-a")
+	durations.ObserveWithExemplar(0.5, Exemplar{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}, "team-a")
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `# HELP download_duration_seconds Download durations.
+# TYPE download_duration_seconds histogram
+download_duration_seconds_bucket{namespace="team-a",le="0.1"} 1
+download_duration_seconds_bucket{namespace="team-a",le="1"} 2
+download_duration_seconds_bucket{namespace="team-a",le="+Inf"} 2
+download_duration_seconds_sum{namespace="team-a"} 0.55
+download_duration_seconds_count{namespace="team-a"} 2
+# HELP downloads_total Downloads served.
+# TYPE downloads_total counter
+downloads_total 2
+`
+	if rec.Body.String() != expected {
+		t.Fatalf("expected metrics without exemplars\n%s\nbut got\n%s", expected, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+	reg.ServeHTTP(rec, req)
+	expected = `# HELP download_duration_seconds Download durations.
+# TYPE download_duration_seconds histogram
+download_duration_seconds_bucket{namespace="team-a",le="0.1"} 1
+download_duration_seconds_bucket{namespace="team-a",le="1"} 2 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.5 1500000000.000
+download_duration_seconds_bucket{namespace="team-a",le="+Inf"} 2
+download_duration_seconds_sum{namespace="team-a"} 0.55
+download_duration_seconds_count{namespace="team-a"} 2
+# HELP downloads Downloads served.
+# TYPE downloads counter
+downloads_total 2
+# EOF
+`
+	if rec.Body.String() != expected {
+		t.Fatalf("expected OpenMetrics with exemplars\n%s\nbut got\n%s", expected, rec.Body.String())
+	}
+	if ct := rec.Header().Get("content-type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Fatalf("expected the OpenMetrics content type but got %q", ct)
+	}
+}
@@ -0,0 +1,137 @@
+package notes
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+//Render turns release notes into HTML which is safe to put in a page. Plain text notes are escaped as they are, and
+//markdown notes are rendered from a small subset of markdown: headings, paragraphs, lists, code, emphasis and links.
+//Any HTML in the notes themselves is escaped rather than passed through, so nothing in them can run in the page
+func Render(text string, markdown bool) template.HTML {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	if !markdown {
+		return template.HTML("<pre>" + html.EscapeString(text) + "</pre>")
+	}
+	return template.HTML(renderMarkdown(text))
+}
+
+var (
+	heading  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	listItem = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+)
+
+func renderMarkdown(text string) string {
+	var out []string
+	var paragraph []string
+	inList, inCode := false, false
+	var code []string
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out = append(out, "<p>"+renderInline(strings.Join(paragraph, " "))+"</p>")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if inList {
+			out = append(out, "</ul>")
+			inList = false
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inCode {
+				out = append(out, "<pre><code>"+html.EscapeString(strings.Join(code, "\n"))+"</code></pre>")
+				code, inCode = nil, false
+			} else {
+				flushParagraph()
+				closeList()
+				inCode = true
+			}
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flushParagraph()
+			closeList()
+			continue
+		}
+		if m := heading.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			closeList()
+			level := string('0' + rune(len(m[1])))
+			out = append(out, "<h"+level+">"+renderInline(m[2])+"</h"+level+">")
+			continue
+		}
+		if m := listItem.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			if !inList {
+				out = append(out, "<ul>")
+				inList = true
+			}
+			out = append(out, "<li>"+renderInline(m[1])+"</li>")
+			continue
+		}
+		closeList()
+		paragraph = append(paragraph, strings.TrimSpace(line))
+	}
+	if inCode {
+		out = append(out, "<pre><code>"+html.EscapeString(strings.Join(code, "\n"))+"</code></pre>")
+	}
+	flushParagraph()
+	closeList()
+	return strings.Join(out, "\n")
+}
+
+var (
+	inlineCode = regexp.MustCompile("`([^`]+)`")
+	link       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strong     = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	emphasis   = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+)
+
+//renderInline renders the inline markup of a line. The text is escaped first, so the markup added here is the only
+//HTML in the result
+func renderInline(text string) string {
+	// code spans are set aside so nothing inside them is treated as markup
+	var spans []string
+	text = inlineCode.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00" + string(rune('a'+len(spans)-1)) + "\x00"
+	})
+	text = html.EscapeString(text)
+	text = link.ReplaceAllStringFunc(text, func(m string) string {
+		parts := link.FindStringSubmatch(m)
+		href := html.UnescapeString(parts[2])
+		if !safeHref(href) {
+			return parts[1]
+		}
+		return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">` + parts[1] + "</a>"
+	})
+	text = strong.ReplaceAllString(text, "<strong>$1</strong>")
+	text = emphasis.ReplaceAllString(text, "<em>$1$2</em>")
+	for i, span := range spans {
+		text = strings.Replace(text, "\x00"+string(rune('a'+i))+"\x00", span, 1)
+	}
+	return text
+}
+
+//safeHref only lets through links which can not run script, e.g. javascript: links are dropped
+func safeHref(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
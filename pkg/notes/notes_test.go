@@ -0,0 +1,49 @@
+package notes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderPlainText(t *testing.T) {
+	rendered := string(Render("Fixed <login>\r\n& more", false))
+	if expected := "<pre>Fixed &lt;login&gt;\n&amp; more</pre>"; rendered != expected {
+		t.Fatalf("expected %q but got %q", expected, rendered)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	md := "# Release 1.2\n\nSome **bold** and *quiet* changes,\nsee [the docs](https://example.com/docs?a=1&b=2).\n\n- fixed `a<b`\n- added _more_\n\n```\n<script>x</script>\n```"
+	expected := strings.Join([]string{
+		"<h1>Release 1.2</h1>",
+		`<p>Some <strong>bold</strong> and <em>quiet</em> changes, see <a href="https://example.com/docs?a=1&amp;b=2" rel="nofollow noopener">the docs</a>.</p>`,
+		"<ul>",
+		"<li>fixed <code>a&lt;b</code></li>",
+		"<li>added <em>more</em></li>",
+		"</ul>",
+		"<pre><code>&lt;script&gt;x&lt;/script&gt;</code></pre>",
+	}, "\n")
+	if rendered := string(Render(md, true)); rendered != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, rendered)
+	}
+}
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	cases := []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror="alert(1)">`,
+		`[click](javascript:alert(1))`,
+		`[click](JavaScript:alert(1))`,
+		`[click](data:text/html,<script>alert(1)</script>)`,
+		`[x](https://example.com/" onmouseover="alert(1))`,
+		"`</code><script>alert(1)</script>`",
+	}
+	for _, md := range cases {
+		rendered := string(Render(md, true))
+		for _, unsafe := range []string{"<script", "<img", "javascript:", "JavaScript:", "data:", `" onmouseover`} {
+			if strings.Contains(rendered, unsafe) {
+				t.Fatalf("expected %q to be sanitized but got %q", md, rendered)
+			}
+		}
+	}
+}
@@ -1,52 +1,138 @@
 package openshift
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/aerogear/artifact-proxy-operator/pkg/budget"
+	"github.com/aerogear/artifact-proxy-operator/pkg/checksum"
 	"github.com/aerogear/artifact-proxy-operator/pkg/jenkins"
+	"github.com/aerogear/artifact-proxy-operator/pkg/links"
+	"github.com/aerogear/artifact-proxy-operator/pkg/logging"
 	apibuildv1 "github.com/openshift/api/build/v1"
+	"github.com/openshift/client-go/build/clientset/versioned/scheme"
 	buildv1 "github.com/openshift/client-go/build/clientset/versioned/typed/build/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/rest"
 )
 
 const (
 	BuildConfig             = "openshift.io/build-config.name"
+	BuildNumber             = "openshift.io/build.number"
 	JenkinsBuildUri         = "openshift.io/jenkins-build-uri"
 	WatchResourceAnnotation = "aerogear.org/download-mobile-artifact"
 	JenkinsArtifactUri      = "aerogear.org/jenkins-mobile-artifact-url"
 	DownloadProxyUri        = "aerogear.org/download-mobile-artifact-url"
 	ArtifactDownloadToken   = "aerogear.org/mobile-artifact-token"
 	BuildType               = "mobile-client-type"
+	AllowedGroups           = "artifact-proxy/allowed-groups"
+	BundleIdentifier        = "artifact-proxy/bundle-identifier"
+	BundleVersion           = "artifact-proxy/bundle-version"
+	AppVersion              = "artifact-proxy/app-version"
+	App                     = "artifact-proxy/app"
+	Title                   = "artifact-proxy/title"
+	IconUrl                 = "artifact-proxy/icon-url"
+	VariantPrefix           = "artifact-proxy/variant."
+	ContentType             = "artifact-proxy/content-type"
+	Checksum                = "artifact-proxy/checksum"
+	AndroidArtifactUri      = "artifact-proxy/android-artifact-url"
+	IosArtifactUri          = "artifact-proxy/ios-artifact-url"
+	TokenExpires            = "artifact-proxy/token-expires"
+	StreamLabel             = "artifact-proxy/stream"
+	StreamToken             = "artifact-proxy/stream-token"
+	NoCache                 = "artifact-proxy/no-cache"
+	PreviousToken           = "artifact-proxy/previous-token"
+	PreviousTokenExpires    = "artifact-proxy/previous-token-expires"
+	ReleaseNotes            = "artifact-proxy/release-notes"
+	ReleaseNotesFormat      = "artifact-proxy/release-notes-format"
+	MaxDownloads            = "artifact-proxy/max-downloads"
+	Status                  = "artifact-proxy/status"
 	AndroidExtension        = ".apk"
 	IosExtenstion           = ".ipa"
 )
 
+//BuildPhaseUnknown is the phase of a build whose status has not been populated yet
+const BuildPhaseUnknown apibuildv1.BuildPhase = "Unknown"
+
 type OpenShiftClient struct {
 	AuthToken     string
 	BuildClient   *buildv1.BuildV1Client
 	JenkinsClient *jenkins.JenkinsClient
 	namespace     string
-	operatorHost  string
+	//operatorHost is the public hostname of the proxy, it can change while running so is guarded by hostLock
+	operatorHost string
+	hostLock     sync.RWMutex
+	durations    *buildDurations
+	//watchMarker is the annotation a build must set to "true" to be tracked by the watcher
+	watchMarker string
+	//watchSelector optionally restricts the watch server side to builds matching a label selector
+	watchSelector string
+	synced        chan struct{}
+	syncOnce      sync.Once
+	//Streams resolves the latest completed build of each build stream
+	Streams *BuildStreams
+	//Updates passes the tracked builds seen by the watch loop on to requests waiting for them
+	Updates *BuildUpdates
+	//coalesce is how long updates to a build are collected before the latest is handled
+	coalesce  time.Duration
+	coalesced uint64
+	//watchLog is where the watch loop logs what it is doing
+	watchLog *logging.Logger
+	//watching is set while the watch loop runs, so starting it again does not open a second watch
+	watching int32
+	//Observed is called from the watch loop with each tracked build once it has a download url, it must not block
+	Observed func(build *apibuildv1.Build)
 }
 
 func (c *OpenShiftClient) GenerateArtifactUrl(buildName string, token string, artifact bool) string {
-	url := "https://" + c.operatorHost + "/" + buildName + "/download?token=" + token
+	link := links.Link{Host: c.GetOperatorHost(), Build: buildName, Token: token}
 	if artifact {
-		url += "&amp;artifact=true"
+		return link.IosArtifact()
 	}
-	return url
+	return link.Download()
+}
+
+//GenerateItmsUrl returns the itms-services URL which installs an iOS build, for pasting into MDM tooling
+func (c *OpenShiftClient) GenerateItmsUrl(buildName string, token string) string {
+	return links.Link{Host: c.GetOperatorHost(), Build: buildName, Token: token}.ItmsServices()
+}
+
+func (c *OpenShiftClient) GetOperatorHost() string {
+	c.hostLock.RLock()
+	defer c.hostLock.RUnlock()
+	return c.operatorHost
 }
 
 func (c *OpenShiftClient) GetBuild(build string) (*apibuildv1.Build, error) {
-	log.Printf("getting build info for build - " + build)
-	b, err := c.BuildClient.Builds(c.namespace).Get(build, metav1.GetOptions{})
+	return c.GetBuildContext(context.Background(), build)
+}
+
+//GetBuildContext fetches a build, giving up once the context is done or its request budget runs out
+func (c *OpenShiftClient) GetBuildContext(ctx context.Context, build string) (*apibuildv1.Build, error) {
+	log.Printf("getting build info for build - %s", build)
+	ctx, cancel := budget.Bounded(ctx)
+	defer cancel()
+	b := &apibuildv1.Build{}
+	err := c.BuildClient.RESTClient().Get().
+		Context(ctx).
+		Namespace(c.namespace).
+		Resource("builds").
+		Name(build).
+		VersionedParams(&metav1.GetOptions{}, scheme.ParameterCodec).
+		Do().
+		Into(b)
 	if err != nil {
 		return nil, err
 	}
@@ -54,11 +140,30 @@ func (c *OpenShiftClient) GetBuild(build string) (*apibuildv1.Build, error) {
 }
 
 func (c *OpenShiftClient) GetBuildType(build *apibuildv1.Build) (string, error) {
+	return c.GetBuildTypeContext(context.Background(), build)
+}
+
+//GetBuildTypeContext looks up the type of a build from its build config, giving up once the context is done or its
+//request budget runs out
+func (c *OpenShiftClient) GetBuildTypeContext(ctx context.Context, build *apibuildv1.Build) (string, error) {
+	if build == nil {
+		return "", errors.New("unable to get type of a missing build")
+	}
 	bc, ok := build.Annotations[BuildConfig]
 	if !ok {
 		return "", errors.New("unable to get build config info for " + build.Name)
 	}
-	b, err := c.BuildClient.BuildConfigs(c.namespace).Get(bc, metav1.GetOptions{})
+	ctx, cancel := budget.Bounded(ctx)
+	defer cancel()
+	b := &apibuildv1.BuildConfig{}
+	err := c.BuildClient.RESTClient().Get().
+		Context(ctx).
+		Namespace(c.namespace).
+		Resource("buildconfigs").
+		Name(bc).
+		VersionedParams(&metav1.GetOptions{}, scheme.ParameterCodec).
+		Do().
+		Into(b)
 	if err != nil {
 		return "", err
 	}
@@ -69,6 +174,15 @@ func (c *OpenShiftClient) GetBuildType(build *apibuildv1.Build) (string, error)
 	return buildType, nil
 }
 
+//GetBuildPhase returns the phase of a build, or BuildPhaseUnknown when its status has not been populated yet, e.g.
+//straight after it was created
+func (c *OpenShiftClient) GetBuildPhase(build *apibuildv1.Build) apibuildv1.BuildPhase {
+	if build == nil || build.Status.Phase == "" {
+		return BuildPhaseUnknown
+	}
+	return build.Status.Phase
+}
+
 func (c *OpenShiftClient) GetDownloadConst() string {
 	return JenkinsArtifactUri
 }
@@ -77,43 +191,157 @@ func (c *OpenShiftClient) GetTokenConst() string {
 	return ArtifactDownloadToken
 }
 
+//WatchBuilds lists the existing builds and then watches for changes, reconnecting as needed. It never returns, unless
+//the watcher is already running when it returns straight away
 func (c *OpenShiftClient) WatchBuilds() {
+	c.watchBuilds(nil)
+}
+
+//Synced is closed once the builds which existed when the watcher started have been processed
+func (c *OpenShiftClient) Synced() <-chan struct{} {
+	return c.synced
+}
+
+func (c *OpenShiftClient) watchBuilds(stop <-chan struct{}) {
+	if !atomic.CompareAndSwapInt32(&c.watching, 0, 1) {
+		c.watchLog.Warn("build watcher is already running, not starting another")
+		return
+	}
+	defer atomic.StoreInt32(&c.watching, 0)
 	for {
-		log.Printf("Connecting build watcher")
-		events, err := c.BuildClient.Builds(c.namespace).Watch(metav1.ListOptions{})
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		c.watchLog.Info("connecting build watcher", "namespace", c.namespace, "selector", c.watchSelector)
+		builds, err := c.BuildClient.Builds(c.namespace).List(metav1.ListOptions{LabelSelector: c.watchSelector})
 		if err != nil {
+			c.watchLog.Error("listing builds failed", "error", err)
 			panic(err)
 		}
-		for update := range events.ResultChan() {
+		c.watchLog.Info("initial list", "builds", len(builds.Items), "resourceVersion", builds.ResourceVersion)
+		for i := range builds.Items {
+			c.handleBuild(&builds.Items[i])
+		}
+		c.syncOnce.Do(func() { close(c.synced) })
+
+		events, err := c.BuildClient.Builds(c.namespace).Watch(metav1.ListOptions{LabelSelector: c.watchSelector, ResourceVersion: builds.ResourceVersion})
+		if err != nil {
+			c.watchLog.Error("starting watch failed", "error", err)
+			panic(err)
+		}
+		c.consumeEvents(events, stop)
+		c.watchLog.Warn("watch disconnected, reconnecting")
+	}
+}
+
+func (c *OpenShiftClient) consumeEvents(events watch.Interface, stop <-chan struct{}) {
+	defer events.Stop()
+	pending := newPendingBuilds(c.coalesce, &c.coalesced)
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-pending.timer.C:
+			for _, build := range pending.due(now) {
+				c.handleBuild(build)
+			}
+		case update, ok := <-events.ResultChan():
+			if !ok {
+				// the watch is reconnected from its last list, handle what is left rather than wait for the window
+				for _, build := range pending.all() {
+					c.handleBuild(build)
+				}
+				return
+			}
+			if update.Type == watch.Error {
+				c.watchLog.Error("watch error", "status", statusMessage(update.Object))
+				continue
+			}
 			raw, _ := json.Marshal(update.Object)
 			var build = apibuildv1.Build{}
 			json.Unmarshal(raw, &build)
-			//artifact download url requested
-			if val, ok := build.Annotations[WatchResourceAnnotation]; ok && val == "true" {
-				//and not provided yet
-				if _, ok := build.Annotations[JenkinsArtifactUri]; !ok {
-					c.addAnnotations(&build)
-					log.Printf("Download requested for %v\n", build.ObjectMeta.Name)
-				} else {
-					log.Printf("Download already provided for %v\n", build.ObjectMeta.Name)
-				}
-			} else {
-				log.Printf("Download not requested for %v\n", build.ObjectMeta.Name)
+			c.watchLog.Debug("event", "type", update.Type, "build", build.Name)
+			if update.Type == watch.Deleted {
+				pending.drop(&build)
+				c.Streams.Forget(&build)
+				c.durations.forget(&build)
+				c.watchLog.Debug("processed", "build", build.Name, "action", "forgotten")
+				continue
+			}
+			if c.coalesce == 0 {
+				c.handleBuild(&build)
+				continue
 			}
+			pending.add(&build)
 		}
-		log.Printf("watch disconnected")
 	}
 }
 
-func (c *OpenShiftClient) addAnnotations(build *apibuildv1.Build) {
+//statusMessage describes the object of a watch error event, which is normally a Status
+func statusMessage(obj runtime.Object) string {
+	if status, ok := obj.(*metav1.Status); ok {
+		return status.Message
+	}
+	return fmt.Sprintf("%v", obj)
+}
+
+//handleBuild processes a build seen by the watcher. Builds without the marker annotation are ignored entirely
+func (c *OpenShiftClient) handleBuild(build *apibuildv1.Build) {
+	c.watchLog.Debug("processed", "build", build.Name, "action", c.processBuild(build))
+}
+
+//processBuild does the work of handleBuild, returning what it did for the log
+func (c *OpenShiftClient) processBuild(build *apibuildv1.Build) string {
+	//artifact download url requested
+	if val, ok := build.Annotations[c.watchMarker]; !ok || val != "true" {
+		return "ignored"
+	}
+	c.durations.record(build)
+	c.Updates.Publish(build)
+	if val, ok := build.Annotations[Checksum]; ok {
+		if _, err := checksum.Parse(val); err != nil {
+			c.watchLog.Warn("invalid checksum annotation, downloads will fail until it is fixed", "build", build.Name, "annotation", Checksum, "error", err)
+		}
+	}
+	//and not provided yet
+	if _, ok := build.Annotations[JenkinsArtifactUri]; !ok {
+		if _, ok := build.Annotations[JenkinsBuildUri]; !ok {
+			// a freshly created build has not been picked up by Jenkins yet, the next update of it is handled instead
+			return "awaiting-jenkins"
+		}
+		if !c.addAnnotations(build) {
+			return "annotation-failed"
+		}
+		c.watchLog.Info("download url added", "build", build.Name)
+		c.observe(build)
+		return "annotated"
+	}
+	c.observe(build)
+	return "already-annotated"
+}
+
+//observe handles a tracked build which has a download url. Only then does it join its stream, so the latest link of a
+//stream never resolves to a build which can not be downloaded yet
+func (c *OpenShiftClient) observe(build *apibuildv1.Build) {
+	c.Streams.Record(build)
+	if c.Observed != nil {
+		c.Observed(build)
+	}
+}
+
+//addAnnotations fetches a build's artifact from Jenkins and annotates the build with its download url, it reports
+//whether the build was updated
+func (c *OpenShiftClient) addAnnotations(build *apibuildv1.Build) bool {
 	buildDetails, err := c.JenkinsClient.GetBuildInfo(build.Annotations[JenkinsBuildUri], c.AuthToken)
 	if err != nil {
-		log.Println("error " + err.Error() + " fetching build details for build " + build.Name)
-		return
+		c.watchLog.Warn("fetching build details from Jenkins failed", "build", build.Name, "error", err)
+		return false
 	}
 	if len(buildDetails.Artifacts) < 1 {
-		log.Println("no artifact information available for build " + build.Name)
-		return
+		c.watchLog.Warn("no artifact information available", "build", build.Name)
+		return false
 	}
 
 	var buildType string
@@ -132,15 +360,15 @@ func (c *OpenShiftClient) addAnnotations(build *apibuildv1.Build) {
 	}
 	if buildType == "" {
 		if len(buildDetails.Artifacts) != 1 {
-			log.Printf("can not accurately determine artifact for build %s\n", build.Name)
-			return
+			c.watchLog.Warn("can not accurately determine artifact", "build", build.Name, "artifacts", len(buildDetails.Artifacts))
+			return false
 		}
 		binArtifact = buildDetails.Artifacts[0]
-		log.Printf("unable to determine build type for build %s from artifact\n", build.Name)
+		c.watchLog.Debug("unable to determine build type from artifact", "build", build.Name)
 		buildType, err = c.GetBuildType(build)
 		if err != nil {
-			log.Printf("no build type found for %s. required annotations can't be added\n", build.Name)
-			return
+			c.watchLog.Warn("no build type found, required annotations can't be added", "build", build.Name)
+			return false
 		}
 	}
 
@@ -151,9 +379,10 @@ func (c *OpenShiftClient) addAnnotations(build *apibuildv1.Build) {
 
 	_, err = c.BuildClient.Builds(c.namespace).Update(build)
 	if err != nil {
-		log.Println("error " + err.Error() + " while updating build annotations for build " + build.Name)
+		c.watchLog.Warn("updating build annotations failed", "build", build.Name, "error", err)
+		return false
 	}
-
+	return true
 }
 
 func NewOpenShiftClient(jc *jenkins.JenkinsClient) (*OpenShiftClient, error) {
@@ -167,17 +396,50 @@ func NewOpenShiftClient(jc *jenkins.JenkinsClient) (*OpenShiftClient, error) {
 		return nil, err
 	}
 
-	ns := os.Getenv("NAMESPACE")
+	operatorHost, err := operatorHostFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return newOpenShiftClient(jc, token, buildClient, os.Getenv("NAMESPACE"), operatorHost)
+}
+
+//NewOpenShiftClientForConfig creates a client against an explicit API server config rather than the in cluster one
+func NewOpenShiftClientForConfig(jc *jenkins.JenkinsClient, config *rest.Config, token string, ns string, operatorHost string) (*OpenShiftClient, error) {
+	buildClient, err := buildv1.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return newOpenShiftClient(jc, token, buildClient, ns, operatorHost)
+}
+
+func newOpenShiftClient(jc *jenkins.JenkinsClient, token string, buildClient *buildv1.BuildV1Client, ns string, operatorHost string) (*OpenShiftClient, error) {
+	watchMarker := os.Getenv("WATCH_MARKER_ANNOTATION")
+	if watchMarker == "" {
+		watchMarker = WatchResourceAnnotation
+	}
 	if ns == "" {
 		return nil, errors.New("cannot create OpenShift client. no namespace present")
 	}
 
-	operatorHost := os.Getenv("OPERATOR_HOSTNAME")
 	if operatorHost == "" {
 		return nil, errors.New("no hostname available to set required annotations")
 
 	}
-	return &OpenShiftClient{token, buildClient, jc, ns, operatorHost}, nil
+	return &OpenShiftClient{
+		AuthToken:     token,
+		BuildClient:   buildClient,
+		JenkinsClient: jc,
+		namespace:     ns,
+		operatorHost:  operatorHost,
+		durations:     newBuildDurations(),
+		Streams:       NewBuildStreams(),
+		Updates:       NewBuildUpdates(),
+		watchMarker:   watchMarker,
+		watchSelector: os.Getenv("WATCH_LABEL_SELECTOR"),
+		synced:        make(chan struct{}),
+		coalesce:      coalesceWindow(),
+		watchLog:      logging.New("watch"),
+	}, nil
 }
 
 func getAuthToken() (string, error) {
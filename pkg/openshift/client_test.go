@@ -1 +1,400 @@
 package openshift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/jenkins"
+	apibuildv1 "github.com/openshift/api/build/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func testBuild(phase apibuildv1.BuildPhase) *apibuildv1.Build {
+	return &apibuildv1.Build{
+		ObjectMeta: metav1.ObjectMeta{Name: "build", Annotations: map[string]string{BuildConfig: "app"}},
+		Status:     apibuildv1.BuildStatus{Phase: phase},
+	}
+}
+
+func TestEstimateRemainingBuildTime(t *testing.T) {
+	c := &OpenShiftClient{durations: newBuildDurations()}
+	running := testBuild(apibuildv1.BuildPhaseRunning)
+	started := metav1.NewTime(time.Now().Add(-time.Minute))
+	running.Status.StartTimestamp = &started
+
+	if _, ok := c.EstimateRemainingBuildTime(running); ok {
+		t.Fatal("expected no estimate before any build completed")
+	}
+
+	for i, d := range []time.Duration{4 * time.Minute, 6 * time.Minute} {
+		complete := testBuild(apibuildv1.BuildPhaseComplete)
+		complete.Name = fmt.Sprintf("build-%d", i)
+		complete.Status.Duration = d
+		c.durations.record(complete)
+	}
+	remaining, ok := c.EstimateRemainingBuildTime(running)
+	if !ok {
+		t.Fatal("expected an estimate once builds completed")
+	}
+	if remaining > 4*time.Minute || remaining < 4*time.Minute-5*time.Second {
+		t.Fatalf("expected roughly 4m remaining but got %s", remaining)
+	}
+
+	overdue := metav1.NewTime(time.Now().Add(-time.Hour))
+	running.Status.StartTimestamp = &overdue
+	if _, ok := c.EstimateRemainingBuildTime(running); ok {
+		t.Fatal("expected no estimate for a build running longer than the average")
+	}
+}
+
+func TestGenerateArtifactUrl(t *testing.T) {
+	c := &OpenShiftClient{operatorHost: "proxy.example.com"}
+	if got := c.GenerateArtifactUrl("app-1", "tok", false); got != "https://proxy.example.com/app-1/download?token=tok" {
+		t.Fatalf("unexpected download url %s", got)
+	}
+	if got := c.GenerateArtifactUrl("app-1", "tok", true); got != "https://proxy.example.com/app-1/download?artifact=true&token=tok" {
+		t.Fatalf("unexpected artifact url %s", got)
+	}
+}
+
+func TestHandleBuildIgnoresUnmarkedBuilds(t *testing.T) {
+	var jenkinsCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&jenkinsCalls, 1)
+		rw.Write([]byte(`{"artifacts":[]}`))
+	}))
+	defer server.Close()
+	c := &OpenShiftClient{JenkinsClient: jenkins.NewJenkinsClient(), durations: newBuildDurations(), Streams: NewBuildStreams(), Updates: NewBuildUpdates(), watchMarker: "example.com/distribute"}
+
+	unmarked := testBuild(apibuildv1.BuildPhaseComplete)
+	unmarked.Status.Duration = time.Minute
+	unmarked.Annotations[JenkinsBuildUri] = server.URL + "/"
+	unmarked.Annotations[WatchResourceAnnotation] = "true"
+	c.handleBuild(unmarked)
+	if atomic.LoadInt32(&jenkinsCalls) != 0 {
+		t.Fatal("expected a build without the configured marker not to be looked up")
+	}
+	if _, ok := c.durations.average("app"); ok {
+		t.Fatal("expected a build without the configured marker not to be tracked")
+	}
+	if _, ok := unmarked.Annotations[ArtifactDownloadToken]; ok {
+		t.Fatal("expected a build without the configured marker not to be annotated")
+	}
+
+	marked := testBuild(apibuildv1.BuildPhaseComplete)
+	marked.Status.Duration = time.Minute
+	marked.Annotations[JenkinsBuildUri] = server.URL + "/"
+	marked.Annotations["example.com/distribute"] = "true"
+	c.handleBuild(marked)
+	if atomic.LoadInt32(&jenkinsCalls) != 1 {
+		t.Fatal("expected a marked build to be looked up in Jenkins")
+	}
+	if _, ok := c.durations.average("app"); !ok {
+		t.Fatal("expected a marked build to be tracked")
+	}
+}
+
+func TestHandleBuildObserved(t *testing.T) {
+	var observed []string
+	c := &OpenShiftClient{JenkinsClient: jenkins.NewJenkinsClient(), durations: newBuildDurations(), Streams: NewBuildStreams(), Updates: NewBuildUpdates(), watchMarker: WatchResourceAnnotation,
+		Observed: func(build *apibuildv1.Build) { observed = append(observed, build.Name) }}
+
+	unmarked := testBuild(apibuildv1.BuildPhaseComplete)
+	unmarked.Name = "unmarked"
+	unmarked.Annotations[JenkinsArtifactUri] = "https://jenkins.example.com/artifact/app.apk"
+	c.handleBuild(unmarked)
+	awaiting := testBuild(apibuildv1.BuildPhaseNew)
+	awaiting.Name = "awaiting"
+	awaiting.Annotations[WatchResourceAnnotation] = "true"
+	c.handleBuild(awaiting)
+	annotated := testBuild(apibuildv1.BuildPhaseComplete)
+	annotated.Name = "annotated"
+	annotated.Annotations[WatchResourceAnnotation] = "true"
+	annotated.Annotations[JenkinsArtifactUri] = "https://jenkins.example.com/artifact/app.apk"
+	c.handleBuild(annotated)
+
+	if len(observed) != 1 || observed[0] != "annotated" {
+		t.Fatalf("expected only the tracked build with a download url to be observed but got %v", observed)
+	}
+}
+
+func TestHandleBuildStreamsOnlyWithDownloadUrl(t *testing.T) {
+	c := &OpenShiftClient{JenkinsClient: jenkins.NewJenkinsClient(), durations: newBuildDurations(), Streams: NewBuildStreams(), Updates: NewBuildUpdates(), watchMarker: WatchResourceAnnotation}
+	build := testBuild(apibuildv1.BuildPhaseComplete)
+	build.Labels = map[string]string{StreamLabel: "nightly"}
+	build.Annotations[WatchResourceAnnotation] = "true"
+	c.handleBuild(build)
+	if latest, ok := c.Streams.Latest("nightly"); ok {
+		t.Fatalf("expected a build without a download url not to join its stream but got %s", latest)
+	}
+	build.Annotations[JenkinsArtifactUri] = "https://jenkins.example.com/artifact/app.apk"
+	c.handleBuild(build)
+	if latest, ok := c.Streams.Latest("nightly"); !ok || latest != build.Name {
+		t.Fatalf("expected the build to join its stream once it has a download url but got %q", latest)
+	}
+}
+
+func TestHandleBuildPublishesUpdates(t *testing.T) {
+	c := &OpenShiftClient{JenkinsClient: jenkins.NewJenkinsClient(), durations: newBuildDurations(), Streams: NewBuildStreams(), Updates: NewBuildUpdates(), watchMarker: WatchResourceAnnotation}
+	unmarkedUpdates, unsubscribeUnmarked := c.Updates.Subscribe("unmarked")
+	defer unsubscribeUnmarked()
+	trackedUpdates, unsubscribeTracked := c.Updates.Subscribe("tracked")
+	defer unsubscribeTracked()
+
+	unmarked := testBuild(apibuildv1.BuildPhaseComplete)
+	unmarked.Name = "unmarked"
+	c.handleBuild(unmarked)
+	for _, phase := range []apibuildv1.BuildPhase{apibuildv1.BuildPhaseRunning, apibuildv1.BuildPhaseComplete} {
+		tracked := testBuild(phase)
+		tracked.Name = "tracked"
+		tracked.Annotations[WatchResourceAnnotation] = "true"
+		c.handleBuild(tracked)
+	}
+
+	select {
+	case build := <-trackedUpdates:
+		if build.Status.Phase != apibuildv1.BuildPhaseComplete {
+			t.Fatalf("expected a waiter to get the latest update of its build but got phase %s", build.Status.Phase)
+		}
+	default:
+		t.Fatal("expected the tracked build to be published")
+	}
+	select {
+	case <-unmarkedUpdates:
+		t.Fatal("expected a build which is not tracked not to be published")
+	default:
+	}
+}
+
+func TestWatchBuildsSyncsExistingBuilds(t *testing.T) {
+	existing := testBuild(apibuildv1.BuildPhaseComplete)
+	existing.TypeMeta = metav1.TypeMeta{Kind: "Build", APIVersion: "build.openshift.io/v1"}
+	existing.Annotations[WatchResourceAnnotation] = "true"
+	existing.Annotations[JenkinsArtifactUri] = "https://jenkins/artifact/app.apk"
+	existing.Status.Duration = time.Minute
+	stopServer := make(chan struct{})
+	watching := make(chan struct{})
+	var watchOnce sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("content-type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			rw.WriteHeader(http.StatusOK)
+			rw.(http.Flusher).Flush()
+			watchOnce.Do(func() { close(watching) })
+			select {
+			case <-stopServer:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		json.NewEncoder(rw).Encode(apibuildv1.BuildList{
+			TypeMeta: metav1.TypeMeta{Kind: "BuildList", APIVersion: "build.openshift.io/v1"},
+			ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+			Items:    []apibuildv1.Build{*existing},
+		})
+	}))
+	c, err := NewOpenShiftClientForConfig(jenkins.NewJenkinsClient(), &rest.Config{Host: server.URL}, "token", "test", "proxy.example.com")
+	if err != nil {
+		t.Fatal("error creating client " + err.Error())
+	}
+	stop := make(chan struct{})
+	go c.watchBuilds(stop)
+	defer func() {
+		<-watching
+		close(stop)
+		close(stopServer)
+		server.Close()
+	}()
+
+	select {
+	case <-c.Synced():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watcher to sync")
+	}
+	if _, ok := c.durations.average("app"); !ok {
+		t.Fatal("expected existing builds to be processed before the watcher reports synced")
+	}
+}
+
+func TestWatchBuildsRunsOnce(t *testing.T) {
+	var lists, watches int32
+	stopServer := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("content-type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			atomic.AddInt32(&watches, 1)
+			rw.WriteHeader(http.StatusOK)
+			rw.(http.Flusher).Flush()
+			select {
+			case <-stopServer:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		atomic.AddInt32(&lists, 1)
+		json.NewEncoder(rw).Encode(apibuildv1.BuildList{
+			TypeMeta: metav1.TypeMeta{Kind: "BuildList", APIVersion: "build.openshift.io/v1"},
+			ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		})
+	}))
+	c, err := NewOpenShiftClientForConfig(jenkins.NewJenkinsClient(), &rest.Config{Host: server.URL}, "token", "test", "proxy.example.com")
+	if err != nil {
+		t.Fatal("error creating client " + err.Error())
+	}
+	stop := make(chan struct{})
+	returned := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			c.watchBuilds(stop)
+			returned <- i
+		}(i)
+	}
+	defer func() {
+		close(stop)
+		close(stopServer)
+		server.Close()
+	}()
+
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second watch loop to return straight away")
+	}
+	<-c.Synced()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&watches) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if l, w := atomic.LoadInt32(&lists), atomic.LoadInt32(&watches); l != 1 || w != 1 {
+		t.Fatalf("expected a single watch loop to list and watch once but got %d lists and %d watches", l, w)
+	}
+	select {
+	case <-returned:
+		t.Fatal("expected the running watch loop to keep going")
+	default:
+	}
+}
+
+func TestBuildWithoutStatus(t *testing.T) {
+	c := &OpenShiftClient{JenkinsClient: jenkins.NewJenkinsClient(), durations: newBuildDurations(), Streams: NewBuildStreams(), Updates: NewBuildUpdates(), watchMarker: WatchResourceAnnotation}
+	build := &apibuildv1.Build{ObjectMeta: metav1.ObjectMeta{Name: "build", Annotations: map[string]string{WatchResourceAnnotation: "true"}}}
+
+	if phase := c.GetBuildPhase(build); phase != BuildPhaseUnknown {
+		t.Fatalf("expected phase %s for a build without a status but got %s", BuildPhaseUnknown, phase)
+	}
+	if phase := c.GetBuildPhase(nil); phase != BuildPhaseUnknown {
+		t.Fatalf("expected phase %s for a missing build but got %s", BuildPhaseUnknown, phase)
+	}
+	if _, err := c.GetBuildType(nil); err == nil {
+		t.Fatal("expected an error getting the type of a missing build")
+	}
+	if _, ok := c.EstimateRemainingBuildTime(build); ok {
+		t.Fatal("expected no estimate for a build which has not started")
+	}
+	// a build not yet known to Jenkins is left alone rather than annotated
+	c.handleBuild(build)
+	if _, ok := build.Annotations[ArtifactDownloadToken]; ok {
+		t.Fatal("expected a build without a Jenkins build not to be annotated")
+	}
+}
+
+func TestBuildStreams(t *testing.T) {
+	streams := NewBuildStreams()
+	build := func(name string, phase apibuildv1.BuildPhase, completed time.Time) *apibuildv1.Build {
+		b := testBuild(phase)
+		b.Name = name
+		b.Labels = map[string]string{StreamLabel: "app"}
+		b.Status.CompletionTimestamp = &metav1.Time{Time: completed}
+		return b
+	}
+	now := time.Now()
+
+	streams.Record(build("running", apibuildv1.BuildPhaseRunning, now))
+	if _, ok := streams.Latest("app"); ok {
+		t.Fatal("expected builds which have not completed to be ignored")
+	}
+	streams.Record(build("new", apibuildv1.BuildPhaseComplete, now))
+	streams.Record(build("old", apibuildv1.BuildPhaseComplete, now.Add(-time.Hour)))
+	if latest, _ := streams.Latest("app"); latest != "new" {
+		t.Fatalf("expected the most recently completed build but got %q", latest)
+	}
+	streams.Forget(build("old", apibuildv1.BuildPhaseComplete, now))
+	if latest, _ := streams.Latest("app"); latest != "new" {
+		t.Fatalf("expected forgetting an older build to keep the latest but got %q", latest)
+	}
+	streams.Forget(build("new", apibuildv1.BuildPhaseComplete, now))
+	if _, ok := streams.Latest("app"); ok {
+		t.Fatal("expected a deleted latest build to be forgotten")
+	}
+}
+
+func TestBuildStreamsFallBackToOlderBuild(t *testing.T) {
+	streams := NewBuildStreams()
+	build := func(name string, completed time.Time) *apibuildv1.Build {
+		b := testBuild(apibuildv1.BuildPhaseComplete)
+		b.Name = name
+		b.Labels = map[string]string{StreamLabel: "app"}
+		b.Status.CompletionTimestamp = &metav1.Time{Time: completed}
+		return b
+	}
+	now := time.Now()
+	streams.Record(build("oldest", now.Add(-2*time.Hour)))
+	streams.Record(build("older", now.Add(-time.Hour)))
+	streams.Record(build("newest", now))
+
+	streams.Forget(build("newest", now))
+	if latest, ok := streams.Latest("app"); !ok || latest != "older" {
+		t.Fatalf("expected the next newest completed build once the latest is deleted but got %q", latest)
+	}
+	streams.Forget(build("older", now.Add(-time.Hour)))
+	if latest, ok := streams.Latest("app"); !ok || latest != "oldest" {
+		t.Fatalf("expected the only remaining build but got %q", latest)
+	}
+}
+
+func TestBuildDurationsCountEachBuildOnce(t *testing.T) {
+	c := &OpenShiftClient{durations: newBuildDurations()}
+	complete := testBuild(apibuildv1.BuildPhaseComplete)
+	complete.UID = "uid-1"
+	complete.Status.Duration = 4 * time.Minute
+	c.durations.record(complete)
+	// the same build seen again, e.g. on a later update or after the watch re-listed
+	again := complete.DeepCopy()
+	again.Status.Duration = 8 * time.Minute
+	c.durations.record(again)
+
+	if n := c.durations.completed["app"]; n != 1 {
+		t.Fatalf("expected one sample for a build seen twice but got %d", n)
+	}
+	if avg, _ := c.durations.average("app"); avg != 4*time.Minute {
+		t.Fatalf("expected an average of 4m but got %s", avg)
+	}
+}
+
+func TestSetOperatorHost(t *testing.T) {
+	c, err := NewOpenShiftClientForConfig(jenkins.NewJenkinsClient(), &rest.Config{Host: "https://api.example.com"}, "token", "test", "proxy.example.com")
+	if err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	for _, invalid := range []string{"", "https://proxy.example.com", "proxy.example.com/path", "proxy example.com", "user@proxy.example.com", "proxy.example.com:port"} {
+		if err := c.SetOperatorHost(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+	if got := c.GenerateArtifactUrl("app-1", "token-1", false); got != "https://proxy.example.com/app-1/download?token=token-1" {
+		t.Fatalf("expected the old hostname to be kept but got %s", got)
+	}
+	if err := c.SetOperatorHost("apps.example.com:8443"); err != nil {
+		t.Fatal("unexpected error " + err.Error())
+	}
+	if got := c.GenerateArtifactUrl("app-1", "token-1", false); got != "https://apps.example.com:8443/app-1/download?token=token-1" {
+		t.Fatalf("expected the new hostname to be used but got %s", got)
+	}
+}
@@ -0,0 +1,124 @@
+package openshift
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+const defaultCoalesceWindow = 500 * time.Millisecond
+
+//coalesceWindow reads WATCH_COALESCE_WINDOW_MS, how long updates to a build are collected before the latest of them is
+//handled. 0 handles every update as it arrives
+func coalesceWindow() time.Duration {
+	val := os.Getenv("WATCH_COALESCE_WINDOW_MS")
+	if val == "" {
+		return defaultCoalesceWindow
+	}
+	ms, err := strconv.Atoi(val)
+	if err != nil || ms < 0 {
+		log.Printf("ignoring invalid WATCH_COALESCE_WINDOW_MS %q", val)
+		return defaultCoalesceWindow
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+//pendingBuilds collects updates to builds during the coalesce window. Only the latest update of each build is kept,
+//and it is due once the window since the first update it replaced has passed, so a build updated continuously is
+//still handled at least once per window. It is not safe for concurrent use, consumeEvents owns it
+type pendingBuilds struct {
+	window    time.Duration
+	builds    map[string]*apibuildv1.Build
+	deadlines map[string]time.Time
+	timer     *time.Timer
+	coalesced *uint64
+}
+
+func newPendingBuilds(window time.Duration, coalesced *uint64) *pendingBuilds {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return &pendingBuilds{
+		window:    window,
+		builds:    map[string]*apibuildv1.Build{},
+		deadlines: map[string]time.Time{},
+		timer:     timer,
+		coalesced: coalesced,
+	}
+}
+
+func buildKey(build *apibuildv1.Build) string {
+	return build.Namespace + "/" + build.Name
+}
+
+//add records the latest state of a build, replacing an update still waiting to be handled
+func (p *pendingBuilds) add(build *apibuildv1.Build) {
+	key := buildKey(build)
+	if _, ok := p.builds[key]; ok {
+		atomic.AddUint64(p.coalesced, 1)
+	} else {
+		p.deadlines[key] = time.Now().Add(p.window)
+		p.schedule()
+	}
+	p.builds[key] = build
+}
+
+//drop forgets a pending update, when the build is deleted before it is handled
+func (p *pendingBuilds) drop(build *apibuildv1.Build) {
+	key := buildKey(build)
+	delete(p.builds, key)
+	delete(p.deadlines, key)
+}
+
+//due removes and returns the builds whose window has passed
+func (p *pendingBuilds) due(now time.Time) []*apibuildv1.Build {
+	var due []*apibuildv1.Build
+	for key, deadline := range p.deadlines {
+		if !now.Before(deadline) {
+			due = append(due, p.builds[key])
+			delete(p.builds, key)
+			delete(p.deadlines, key)
+		}
+	}
+	p.schedule()
+	return due
+}
+
+//all removes and returns every pending build
+func (p *pendingBuilds) all() []*apibuildv1.Build {
+	var all []*apibuildv1.Build
+	for _, build := range p.builds {
+		all = append(all, build)
+	}
+	p.builds = map[string]*apibuildv1.Build{}
+	p.deadlines = map[string]time.Time{}
+	p.timer.Stop()
+	return all
+}
+
+//schedule arms the timer for the earliest pending deadline
+func (p *pendingBuilds) schedule() {
+	var next time.Time
+	for _, deadline := range p.deadlines {
+		if next.IsZero() || deadline.Before(next) {
+			next = deadline
+		}
+	}
+	if !p.timer.Stop() {
+		select {
+		case <-p.timer.C:
+		default:
+		}
+	}
+	if !next.IsZero() {
+		p.timer.Reset(time.Until(next))
+	}
+}
+
+//CoalescedEvents is the number of build updates which were replaced by a later update before being handled
+func (c *OpenShiftClient) CoalescedEvents() uint64 {
+	return atomic.LoadUint64(&c.coalesced)
+}
@@ -0,0 +1,91 @@
+package openshift
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/jenkins"
+	"github.com/aerogear/artifact-proxy-operator/pkg/logging"
+	apibuildv1 "github.com/openshift/api/build/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+//handledLog collects the watch log of a client so tests can count the builds it handled
+type handledLog struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (h *handledLog) Write(p []byte) (int, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.buf.Write(p)
+}
+
+//count is how many times a build has been handled, deletes do not count
+func (h *handledLog) count() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	logs := h.buf.String()
+	return strings.Count(logs, "msg=processed build=build action=") - strings.Count(logs, "action=forgotten")
+}
+
+func newCoalescingClient(window time.Duration) (*OpenShiftClient, *handledLog) {
+	handled := &handledLog{}
+	return &OpenShiftClient{JenkinsClient: jenkins.NewJenkinsClient(), durations: newBuildDurations(), Streams: NewBuildStreams(), Updates: NewBuildUpdates(), watchMarker: WatchResourceAnnotation, coalesce: window,
+		watchLog: logging.NewWithOutput("watch", logging.Debug, handled)}, handled
+}
+
+func TestConsumeEventsCoalescesUpdates(t *testing.T) {
+	c, handled := newCoalescingClient(100 * time.Millisecond)
+	events := watch.NewFake()
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.consumeEvents(events, stop)
+
+	for i := 1; i <= 5; i++ {
+		build := testBuild(apibuildv1.BuildPhaseComplete)
+		build.ResourceVersion = strconv.Itoa(i)
+		build.Annotations[WatchResourceAnnotation] = "true"
+		build.Annotations[JenkinsArtifactUri] = "https://jenkins/artifact/app.apk"
+		build.Status.Duration = time.Duration(i) * time.Minute
+		events.Modify(build)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for handled.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := handled.count(); n != 1 {
+		t.Fatalf("expected rapid updates to be handled once but they were handled %d times", n)
+	}
+	if avg, _ := c.durations.average("app"); avg != 5*time.Minute {
+		t.Fatalf("expected the latest update to be handled but got a duration of %s", avg)
+	}
+	if coalesced := c.CoalescedEvents(); coalesced != 4 {
+		t.Fatalf("expected 4 coalesced events but got %d", coalesced)
+	}
+}
+
+func TestConsumeEventsDropsDeletedBuilds(t *testing.T) {
+	c, handled := newCoalescingClient(50 * time.Millisecond)
+	events := watch.NewFake()
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.consumeEvents(events, stop)
+
+	build := testBuild(apibuildv1.BuildPhaseComplete)
+	build.Annotations[WatchResourceAnnotation] = "true"
+	build.Annotations[JenkinsArtifactUri] = "https://jenkins/artifact/app.apk"
+	build.Status.Duration = time.Minute
+	events.Modify(build)
+	events.Delete(build)
+	time.Sleep(200 * time.Millisecond)
+	if n := handled.count(); n != 0 {
+		t.Fatalf("expected a build deleted within the window not to be handled but it was handled %d times", n)
+	}
+}
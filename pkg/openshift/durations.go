@@ -0,0 +1,75 @@
+package openshift
+
+import (
+	"sync"
+	"time"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//buildDurations keeps a running average of how long completed builds took, keyed by build config
+type buildDurations struct {
+	lock      sync.RWMutex
+	averages  map[string]time.Duration
+	completed map[string]int64
+	//recorded holds the builds already counted, the watcher sees a completed build again on every later update of it
+	//and on every re-list
+	recorded map[string]bool
+}
+
+func newBuildDurations() *buildDurations {
+	return &buildDurations{averages: map[string]time.Duration{}, completed: map[string]int64{}, recorded: map[string]bool{}}
+}
+
+//durationKey identifies a build for deduplicating samples, by its UID when it has one
+func durationKey(build *apibuildv1.Build) string {
+	if build.UID != "" {
+		return string(build.UID)
+	}
+	return build.Namespace + "/" + build.Name
+}
+
+func (d *buildDurations) record(build *apibuildv1.Build) {
+	bc, ok := build.Annotations[BuildConfig]
+	if !ok || build.Status.Phase != apibuildv1.BuildPhaseComplete || build.Status.Duration <= 0 {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	key := durationKey(build)
+	if d.recorded[key] {
+		return
+	}
+	d.recorded[key] = true
+	d.completed[bc]++
+	n := time.Duration(d.completed[bc])
+	d.averages[bc] += (build.Status.Duration - d.averages[bc]) / n
+}
+
+//forget stops tracking a deleted build, its sample stays part of the average
+func (d *buildDurations) forget(build *apibuildv1.Build) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.recorded, durationKey(build))
+}
+
+func (d *buildDurations) average(bc string) (time.Duration, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	avg, ok := d.averages[bc]
+	return avg, ok
+}
+
+//EstimateRemainingBuildTime returns a best effort guess of how long a running build has left, based on the average
+//duration of previously completed builds from the same build config. false is returned when there is nothing to go on
+func (c *OpenShiftClient) EstimateRemainingBuildTime(build *apibuildv1.Build) (time.Duration, bool) {
+	avg, ok := c.durations.average(build.Annotations[BuildConfig])
+	if !ok || build.Status.StartTimestamp == nil {
+		return 0, false
+	}
+	remaining := avg - time.Since(build.Status.StartTimestamp.Time)
+	if remaining <= 0 {
+		return 0, false
+	}
+	return remaining, true
+}
@@ -0,0 +1,57 @@
+package openshift
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//operatorHostPattern matches a hostname with an optional port, nothing which would change the rest of a download url
+var operatorHostPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]{1,5})?$`)
+
+//ValidateOperatorHost checks that host can be the public hostname of the proxy in the download urls it generates
+func ValidateOperatorHost(host string) error {
+	if host == "" {
+		return errors.New("no hostname available to set required annotations")
+	}
+	if !operatorHostPattern.MatchString(host) {
+		return errors.New("invalid operator hostname " + host + ", expected a hostname with an optional port")
+	}
+	return nil
+}
+
+//SetOperatorHost changes the hostname used in download urls from now on. An invalid host is rejected and the current
+//one kept
+func (c *OpenShiftClient) SetOperatorHost(host string) error {
+	if err := ValidateOperatorHost(host); err != nil {
+		return err
+	}
+	c.hostLock.Lock()
+	defer c.hostLock.Unlock()
+	c.operatorHost = host
+	return nil
+}
+
+//ReadOperatorHostFile reads the operator hostname from file, e.g. a key of a mounted ConfigMap
+func ReadOperatorHostFile(file string) (string, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(raw)), nil
+}
+
+//operatorHostFromEnv is the contents of OPERATOR_HOSTNAME_FILE when it is set, and OPERATOR_HOSTNAME otherwise
+func operatorHostFromEnv() (string, error) {
+	file := os.Getenv("OPERATOR_HOSTNAME_FILE")
+	if file == "" {
+		return os.Getenv("OPERATOR_HOSTNAME"), nil
+	}
+	host, err := ReadOperatorHostFile(file)
+	if err != nil {
+		return "", errors.New("error reading OPERATOR_HOSTNAME_FILE " + err.Error())
+	}
+	return host, nil
+}
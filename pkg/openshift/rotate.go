@@ -0,0 +1,39 @@
+package openshift
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//RotateToken gives a build a new download token and updates its download URL to match. The old token stays valid
+//for grace, recorded in the artifact-proxy/previous-token annotations, so links already handed out keep working for
+//a while. A grace of zero revokes the old token straight away
+func (c *OpenShiftClient) RotateToken(build *apibuildv1.Build, grace time.Duration) (*apibuildv1.Build, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	token := build.Name + "-" + hex.EncodeToString(secret)
+
+	build = build.DeepCopy()
+	if build.Annotations == nil {
+		build.Annotations = map[string]string{}
+	}
+	previous := build.Annotations[ArtifactDownloadToken]
+	if grace > 0 && previous != "" {
+		build.Annotations[PreviousToken] = previous
+		build.Annotations[PreviousTokenExpires] = time.Now().Add(grace).UTC().Format(time.RFC3339)
+	} else {
+		delete(build.Annotations, PreviousToken)
+		delete(build.Annotations, PreviousTokenExpires)
+	}
+	build.Annotations[ArtifactDownloadToken] = token
+	if uri, ok := build.Annotations[DownloadProxyUri]; ok {
+		build.Annotations[DownloadProxyUri] = c.GenerateArtifactUrl(build.Name, token, strings.Contains(uri, "artifact=true"))
+	}
+	return c.BuildClient.Builds(c.namespace).Update(build)
+}
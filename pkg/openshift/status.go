@@ -0,0 +1,16 @@
+package openshift
+
+import (
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//SetStatus records whether a build can be served in its artifact-proxy/status annotation, for controllers and
+//dashboards watching builds
+func (c *OpenShiftClient) SetStatus(build *apibuildv1.Build, status string) (*apibuildv1.Build, error) {
+	build = build.DeepCopy()
+	if build.Annotations == nil {
+		build.Annotations = map[string]string{}
+	}
+	build.Annotations[Status] = status
+	return c.BuildClient.Builds(c.namespace).Update(build)
+}
@@ -0,0 +1,64 @@
+package openshift
+
+import (
+	"sync"
+	"time"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//BuildStreams tracks the completed builds of each stream, builds join a stream with the artifact-proxy/stream
+//label so a stable link can always serve the latest of them
+type BuildStreams struct {
+	lock   sync.RWMutex
+	builds map[string]map[string]time.Time
+}
+
+//NewBuildStreams creates an empty tracker
+func NewBuildStreams() *BuildStreams {
+	return &BuildStreams{builds: map[string]map[string]time.Time{}}
+}
+
+//Record takes note of a completed build of a stream, when it completed decides whether it is the latest
+func (s *BuildStreams) Record(build *apibuildv1.Build) {
+	stream, ok := build.Labels[StreamLabel]
+	if !ok || stream == "" || build.Status.Phase != apibuildv1.BuildPhaseComplete {
+		return
+	}
+	completed := build.CreationTimestamp.Time
+	if build.Status.CompletionTimestamp != nil {
+		completed = build.Status.CompletionTimestamp.Time
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.builds[stream]; !ok {
+		s.builds[stream] = map[string]time.Time{}
+	}
+	s.builds[stream][build.Name] = completed
+}
+
+//Forget drops a deleted build, when it was the latest of its stream the next newest completed build takes its place
+func (s *BuildStreams) Forget(build *apibuildv1.Build) {
+	stream := build.Labels[StreamLabel]
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.builds[stream], build.Name)
+	if len(s.builds[stream]) == 0 {
+		delete(s.builds, stream)
+	}
+}
+
+//Latest returns the name of the newest completed build of stream
+func (s *BuildStreams) Latest(stream string) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	latest, found := "", false
+	var latestCompleted time.Time
+	for name, completed := range s.builds[stream] {
+		// ties are broken on the name so the answer does not depend on map order
+		if !found || completed.After(latestCompleted) || (completed.Equal(latestCompleted) && name > latest) {
+			latest, latestCompleted, found = name, completed, true
+		}
+	}
+	return latest, found
+}
@@ -0,0 +1,52 @@
+package openshift
+
+import (
+	"sync"
+
+	apibuildv1 "github.com/openshift/api/build/v1"
+)
+
+//BuildUpdates hands the builds seen by the watch loop to requests waiting on them, so a wait for a build to complete
+//does not have to poll the API server
+type BuildUpdates struct {
+	lock    sync.Mutex
+	waiters map[string]map[chan *apibuildv1.Build]struct{}
+}
+
+//NewBuildUpdates creates a notifier without waiters
+func NewBuildUpdates() *BuildUpdates {
+	return &BuildUpdates{waiters: map[string]map[chan *apibuildv1.Build]struct{}{}}
+}
+
+//Subscribe returns a channel receiving the latest version of the named build whenever the watcher sees it change.
+//Only the newest update is kept for a waiter which has not read the previous one yet, the returned func unsubscribes
+func (u *BuildUpdates) Subscribe(name string) (<-chan *apibuildv1.Build, func()) {
+	updates := make(chan *apibuildv1.Build, 1)
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if _, ok := u.waiters[name]; !ok {
+		u.waiters[name] = map[chan *apibuildv1.Build]struct{}{}
+	}
+	u.waiters[name][updates] = struct{}{}
+	return updates, func() {
+		u.lock.Lock()
+		defer u.lock.Unlock()
+		delete(u.waiters[name], updates)
+		if len(u.waiters[name]) == 0 {
+			delete(u.waiters, name)
+		}
+	}
+}
+
+//Publish passes a build on to its waiters. Each gets its own copy, as the watch loop goes on to change the build
+func (u *BuildUpdates) Publish(build *apibuildv1.Build) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for updates := range u.waiters[build.Name] {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- build.DeepCopy()
+	}
+}
@@ -0,0 +1,58 @@
+package openshift
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aerogear/artifact-proxy-operator/pkg/jenkins"
+	"github.com/aerogear/artifact-proxy-operator/pkg/logging"
+	apibuildv1 "github.com/openshift/api/build/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestWatchLogging(t *testing.T) {
+	logs := &bytes.Buffer{}
+	c := &OpenShiftClient{JenkinsClient: jenkins.NewJenkinsClient(), durations: newBuildDurations(), Streams: NewBuildStreams(), Updates: NewBuildUpdates(), watchMarker: WatchResourceAnnotation,
+		watchLog: logging.NewWithOutput("watch", logging.Debug, logs)}
+	events := watch.NewFake()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.consumeEvents(events, nil)
+	}()
+
+	annotated := testBuild(apibuildv1.BuildPhaseComplete)
+	annotated.Name = "annotated"
+	annotated.Annotations[WatchResourceAnnotation] = "true"
+	annotated.Annotations[JenkinsArtifactUri] = "https://jenkins/artifact/app.apk"
+	unmarked := testBuild(apibuildv1.BuildPhaseComplete)
+	unmarked.Name = "unmarked"
+	fresh := testBuild(apibuildv1.BuildPhaseNew)
+	fresh.Name = "fresh"
+	fresh.Annotations[WatchResourceAnnotation] = "true"
+
+	events.Add(annotated)
+	events.Add(unmarked)
+	events.Modify(fresh)
+	events.Delete(annotated)
+	events.Error(&metav1.Status{Message: "too old resource version"})
+	events.Stop()
+	<-done
+
+	expected := []string{
+		`level=debug component=watch msg=event type=ADDED build=annotated`,
+		`level=debug component=watch msg=processed build=annotated action=already-annotated`,
+		`level=debug component=watch msg=event type=ADDED build=unmarked`,
+		`level=debug component=watch msg=processed build=unmarked action=ignored`,
+		`level=debug component=watch msg=event type=MODIFIED build=fresh`,
+		`level=debug component=watch msg=processed build=fresh action=awaiting-jenkins`,
+		`level=debug component=watch msg=event type=DELETED build=annotated`,
+		`level=debug component=watch msg=processed build=annotated action=forgotten`,
+		`level=error component=watch msg="watch error" status="too old resource version"`,
+	}
+	if lines := strings.TrimSpace(logs.String()); lines != strings.Join(expected, "\n") {
+		t.Fatalf("expected watch logs\n%s\nbut got\n%s", strings.Join(expected, "\n"), lines)
+	}
+}
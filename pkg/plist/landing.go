@@ -0,0 +1,126 @@
+package plist
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+)
+
+//LandingPage is the data landing page templates are rendered with
+type LandingPage struct {
+	//Build is the name of the build being installed
+	Build string
+	//BuildType is android or ios
+	BuildType string
+	//DownloadUrl downloads the binary itself
+	DownloadUrl string
+	//ManifestUrl is the install manifest of an iOS build, empty for android
+	ManifestUrl string
+	//ItmsServicesUrl starts the install of an iOS build, empty for android. It is marked safe as html/template would
+	//otherwise refuse the itms-services scheme in links
+	ItmsServicesUrl template.URL
+	//ReleaseNotes are the build's release notes, already rendered to safe HTML. Empty when the build has none
+	ReleaseNotes template.HTML
+}
+
+var androidLanding = template.Must(template.New("android").Parse(`<html>
+<head>
+  <title>{{.Build}}</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+  <h1>{{.Build}}</h1>
+  <p><a id="download" href="{{.DownloadUrl}}">Download for Android</a></p>
+  {{if .ReleaseNotes}}<div id="release-notes">{{.ReleaseNotes}}</div>{{end}}
+</body>
+</html>`))
+
+//iosLandingWithNotes starts the install like ProduceHTML, but also shows the release notes while it does
+var iosLandingWithNotes = template.Must(template.New("ios").Parse(`<html>
+<head>
+  <title>{{.Build}}</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <script type="text/javascript" charset="utf-8">
+    function loadApp() {
+      setTimeout(function(){
+        window.location = {{.ItmsServicesUrl}};
+      }, 100);
+      return true;
+    }
+  </script>
+</head>
+<body onload="loadApp()">
+  <h1>{{.Build}}</h1>
+  <div id="release-notes">{{.ReleaseNotes}}</div>
+</body>
+</html>`))
+
+//LoadLandingTemplate parses the landing page template in file. Templates use html/template, so values are escaped
+//for wherever they appear in the page
+func LoadLandingTemplate(file string) (*template.Template, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(file).Parse(string(raw))
+}
+
+//RenderLanding renders a landing page template with the page's data
+func RenderLanding(t *template.Template, page LandingPage) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, page); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+//ProduceLandingHTML renders the built in landing page for a build type. iOS pages start the install as soon as they
+//load, android pages show a download button. Both show the release notes of builds which have them
+func ProduceLandingHTML(page LandingPage) (string, error) {
+	if page.BuildType == "ios" {
+		if page.ReleaseNotes != "" {
+			return RenderLanding(iosLandingWithNotes, page)
+		}
+		return ProduceHTML(page.ManifestUrl), nil
+	}
+	return RenderLanding(androidLanding, page)
+}
+
+//PlatformLink is a button on the index page of a build, downloading or installing it on one platform
+type PlatformLink struct {
+	//Platform is android or ios
+	Platform string
+	//Label is the text of the button
+	Label string
+	//Url downloads or installs the build on the platform. It is marked safe for the itms-services scheme of iOS installs
+	Url template.URL
+}
+
+//IndexPage is the data the index page of a build is rendered with
+type IndexPage struct {
+	//Build is the name of the build
+	Build string
+	//Platforms are the platforms the build can be downloaded for
+	Platforms []PlatformLink
+}
+
+var indexLanding = template.Must(template.New("index").Parse(`<html>
+<head>
+  <title>{{.Build}}</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+  <h1>{{.Build}}</h1>
+  {{range .Platforms}}<p><a id="{{.Platform}}" href="{{.Url}}">{{.Label}}</a></p>
+  {{end}}
+</body>
+</html>`))
+
+//ProduceIndexHTML renders the index page of a build, a button for each platform it can be downloaded for
+func ProduceIndexHTML(page IndexPage) (string, error) {
+	var buf bytes.Buffer
+	if err := indexLanding.Execute(&buf, page); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
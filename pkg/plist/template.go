@@ -1,10 +1,60 @@
 package plist
 
 import (
+	"bytes"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
 )
 
-func ProduceXML(proxyUrl string, title string) string {
+//DefaultBundleIdentifier is used in the manifest when a build does not declare its bundle identifier
+const DefaultBundleIdentifier = "$(PRODUCT_BUNDLE_IDENTIFIER)"
+
+//DefaultBundleVersion is used in the manifest when a build does not declare its version
+const DefaultBundleVersion = "1.0"
+
+//DefaultTitle is used in the manifest when a build has no title at all
+const DefaultTitle = "App"
+
+//Metadata describes the app in an install manifest. iOS needs a bundle identifier, bundle version and title for the
+//manifest to be valid, any of these left empty falls back to a default. The icon is optional and left out when empty
+type Metadata struct {
+	BundleIdentifier string
+	BundleVersion    string
+	Title            string
+	IconUrl          string
+}
+
+func ProduceXML(proxyUrl string, title string, bundleIdentifier string) string {
+	return ProduceManifest(proxyUrl, Metadata{Title: title, BundleIdentifier: bundleIdentifier})
+}
+
+//ProduceManifest renders the install manifest for the ipa at proxyUrl, filling in defaults for missing metadata so
+//the manifest is always complete
+func ProduceManifest(proxyUrl string, m Metadata) string {
+	if m.BundleIdentifier == "" {
+		m.BundleIdentifier = DefaultBundleIdentifier
+	}
+	if m.BundleVersion == "" {
+		m.BundleVersion = DefaultBundleVersion
+	}
+	if m.Title == "" {
+		m.Title = DefaultTitle
+	}
+	icon := ""
+	if m.IconUrl != "" {
+		icon = fmt.Sprintf(`
+          <dict>
+            <key>kind</key>
+            <string>display-image</string>
+            <key>url</key>
+            <string>%s</string>
+          </dict>`, escape(m.IconUrl))
+	}
 	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
 <plist version="1.0">
@@ -19,14 +69,14 @@ func ProduceXML(proxyUrl string, title string) string {
             <string>software-package</string>
             <key>url</key>
             <string>%s</string>
-          </dict>
+          </dict>%s
         </array>
         <key>metadata</key>
         <dict>
           <key>bundle-identifier</key>
-          <string>$(PRODUCT_BUNDLE_IDENTIFIER)</string>
+          <string>%s</string>
           <key>bundle-version</key>
-          <string>1.0</string>
+          <string>%s</string>
           <key>kind</key>
           <string>software</string>
           <key>title</key>
@@ -35,7 +85,44 @@ func ProduceXML(proxyUrl string, title string) string {
       </dict>
     </array>
   </dict>
-</plist>`, proxyUrl, title)
+</plist>`, escape(proxyUrl), icon, escape(m.BundleIdentifier), escape(m.BundleVersion), escape(m.Title))
+}
+
+//ValidateManifestUrl checks that rawUrl can be the url of the ipa in an install manifest. iOS silently refuses to
+//install from a manifest unless the url is absolute, https and percent-encoded, so a bad operator hostname is caught
+//here rather than on the device
+func ValidateManifestUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return errors.New("invalid manifest url " + err.Error())
+	}
+	if u.Scheme != "https" || u.Host == "" || u.Opaque != "" {
+		return errors.New("manifest url " + rawUrl + " is not an absolute https url")
+	}
+	for i := 0; i < len(rawUrl); i++ {
+		if !isUrlByte(rawUrl[i]) {
+			return errors.New("manifest url " + rawUrl + " is not percent-encoded")
+		}
+	}
+	if _, err := url.ParseQuery(u.RawQuery); err != nil {
+		return errors.New("invalid manifest url query " + err.Error())
+	}
+	return nil
+}
+
+//isUrlByte reports whether c may appear unescaped in a url, RFC 3986 unreserved and reserved characters and the % of
+//an escape
+func isUrlByte(c byte) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return true
+	}
+	return strings.IndexByte("-._~:/?#[]@!$&'()*+,;=%", c) >= 0
+}
+
+func escape(s string) string {
+	buf := bytes.NewBuffer([]byte{})
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
 }
 
 func ProduceHTML(plistUrl string) string {
@@ -55,3 +142,40 @@ func ProduceHTML(plistUrl string) string {
 <body onload="loadApp()"></body>
 </html>`, plistUrl)
 }
+
+//ProduceErrorHTML renders a page explaining to the person trying to install an app why it can not be installed
+func ProduceErrorHTML(title string, message string) string {
+	return fmt.Sprintf(`<html>
+<head>
+  <title>%s</title>
+</head>
+<body>
+  <h1>%s</h1>
+  <p>%s</p>
+</body>
+</html>`, html.EscapeString(title), html.EscapeString(title), html.EscapeString(message))
+}
+
+//ProduceUniversalHTML renders a landing page for a build with both an android and an iOS artifact. The platform is
+//detected from the user agent in the browser, and links to both are shown for anything it does not recognise
+func ProduceUniversalHTML(androidUrl string, iosUrl string) string {
+	return fmt.Sprintf(`<html>
+<head>
+  <script type="text/javascript" charset="utf-8">
+    function loadApp() {
+      var ua = navigator.userAgent;
+      if (/iPhone|iPad|iPod/i.test(ua)) {
+        window.location = "%s";
+      } else if (/Android/i.test(ua)) {
+        window.location = "%s";
+      }
+      return true;
+    }
+  </script>
+</head>
+<body onload="loadApp()">
+  <p><a id="android" href="%s">Download for Android</a></p>
+  <p><a id="ios" href="%s">Install on iOS</a></p>
+</body>
+</html>`, template.JSEscapeString(iosUrl), template.JSEscapeString(androidUrl), html.EscapeString(androidUrl), html.EscapeString(iosUrl))
+}
@@ -1,7 +1,10 @@
 package plist
 
 import (
+	"encoding/xml"
 	"fmt"
+	"html/template"
+	"strings"
 	"testing"
 )
 
@@ -37,11 +40,210 @@ func TestProduceXml(t *testing.T) {
     </array>
   </dict>
 </plist>`
-	xml := ProduceXML("http://test.com")
+	xml := ProduceXML("http://test.com", "SimpleiOSObjectiveCPushApp", DefaultBundleIdentifier)
 	if xml != expectResponse {
 		fmt.Printf("Expected \n%s\n", expectResponse)
 		fmt.Printf("But Got \n%s\n", xml)
 		t.Fatal("unexpected xml response")
 	}
-	ProduceXML("http://test.com")
+}
+
+func TestProduceXmlEscapesValues(t *testing.T) {
+	xml := ProduceXML("https://proxy/app/download?artifact=true&token=t", "App & Co", DefaultBundleIdentifier)
+	if !strings.Contains(xml, "<string>https://proxy/app/download?artifact=true&amp;token=t</string>") {
+		t.Fatalf("expected url to be escaped in manifest but got \n%s", xml)
+	}
+	if !strings.Contains(xml, "<string>App &amp; Co</string>") {
+		t.Fatalf("expected title to be escaped in manifest but got \n%s", xml)
+	}
+}
+
+func TestProduceXmlBundleIdentifier(t *testing.T) {
+	xml := ProduceXML("http://test.com", "App", "org.aerogear.app")
+	if !strings.Contains(xml, "<key>bundle-identifier</key>\n          <string>org.aerogear.app</string>") {
+		t.Fatalf("expected bundle identifier in manifest but got \n%s", xml)
+	}
+}
+
+//manifestValues decodes a manifest's metadata and asset dicts into key value maps, failing on invalid xml
+func manifestValues(t *testing.T, manifest string) (map[string]string, map[string]string) {
+	var doc struct {
+		Assets []struct {
+			Keys   []string `xml:"key"`
+			Values []string `xml:"string"`
+		} `xml:"dict>array>dict>array>dict"`
+		Metadata struct {
+			Keys   []string `xml:"key"`
+			Values []string `xml:"string"`
+		} `xml:"dict>array>dict>dict"`
+	}
+	if err := xml.Unmarshal([]byte(manifest), &doc); err != nil {
+		t.Fatalf("expected a valid manifest but got %v\n%s", err, manifest)
+	}
+	assets := map[string]string{}
+	for _, asset := range doc.Assets {
+		if len(asset.Keys) != 2 || len(asset.Values) != 2 {
+			t.Fatalf("expected every asset to have a kind and url but got \n%s", manifest)
+		}
+		assets[asset.Values[0]] = asset.Values[1]
+	}
+	if len(doc.Metadata.Keys) != len(doc.Metadata.Values) {
+		t.Fatalf("expected every metadata key to have a value but got \n%s", manifest)
+	}
+	metadata := map[string]string{}
+	for i, key := range doc.Metadata.Keys {
+		metadata[key] = doc.Metadata.Values[i]
+	}
+	return metadata, assets
+}
+
+func TestProduceManifestPartialMetadata(t *testing.T) {
+	cases := []struct {
+		metadata Metadata
+		expected map[string]string
+		icon     string
+	}{
+		{
+			metadata: Metadata{},
+			expected: map[string]string{"bundle-identifier": DefaultBundleIdentifier, "bundle-version": DefaultBundleVersion, "title": DefaultTitle},
+		},
+		{
+			metadata: Metadata{Title: "My App"},
+			expected: map[string]string{"bundle-identifier": DefaultBundleIdentifier, "bundle-version": DefaultBundleVersion, "title": "My App"},
+		},
+		{
+			metadata: Metadata{BundleVersion: "2.3.1"},
+			expected: map[string]string{"bundle-identifier": DefaultBundleIdentifier, "bundle-version": "2.3.1", "title": DefaultTitle},
+		},
+		{
+			metadata: Metadata{IconUrl: "https://example.com/icon.png"},
+			expected: map[string]string{"bundle-identifier": DefaultBundleIdentifier, "bundle-version": DefaultBundleVersion, "title": DefaultTitle},
+			icon:     "https://example.com/icon.png",
+		},
+		{
+			metadata: Metadata{BundleIdentifier: "org.aerogear.app", IconUrl: "https://example.com/icon.png?size=57&shine=no"},
+			expected: map[string]string{"bundle-identifier": "org.aerogear.app", "bundle-version": DefaultBundleVersion, "title": DefaultTitle},
+			icon:     "https://example.com/icon.png?size=57&shine=no",
+		},
+	}
+	for _, tc := range cases {
+		metadata, assets := manifestValues(t, ProduceManifest("http://test.com", tc.metadata))
+		if metadata["kind"] != "software" {
+			t.Errorf("expected software kind for %+v but got %q", tc.metadata, metadata["kind"])
+		}
+		for key, value := range tc.expected {
+			if metadata[key] != value {
+				t.Errorf("expected %s %q for %+v but got %q", key, value, tc.metadata, metadata[key])
+			}
+		}
+		if assets["software-package"] != "http://test.com" {
+			t.Errorf("expected software package url for %+v but got %q", tc.metadata, assets["software-package"])
+		}
+		if assets["display-image"] != tc.icon {
+			t.Errorf("expected display image %q for %+v but got %q", tc.icon, tc.metadata, assets["display-image"])
+		}
+	}
+}
+
+func TestProduceErrorHTML(t *testing.T) {
+	page := ProduceErrorHTML("App can not be installed", "build <app-1> is misconfigured")
+	if !strings.Contains(page, "<h1>App can not be installed</h1>") {
+		t.Fatalf("expected title in page but got \n%s", page)
+	}
+	if !strings.Contains(page, "build &lt;app-1&gt; is misconfigured") {
+		t.Fatalf("expected escaped message in page but got \n%s", page)
+	}
+}
+
+func TestProduceUniversalHTML(t *testing.T) {
+	page := ProduceUniversalHTML("https://proxy/app/download?platform=android&token=t", "itms-services://?action=download-manifest&url=x")
+	if !strings.Contains(page, `href="https://proxy/app/download?platform=android&amp;token=t"`) {
+		t.Fatalf("expected android link in page but got \n%s", page)
+	}
+	if !strings.Contains(page, `href="itms-services://?action=download-manifest&amp;url=x"`) {
+		t.Fatalf("expected ios link in page but got \n%s", page)
+	}
+}
+
+func TestProduceLandingHTML(t *testing.T) {
+	page := LandingPage{Build: "app-1", BuildType: "android", DownloadUrl: "https://proxy/app-1/download?artifact=true&token=a<b"}
+	android, err := ProduceLandingHTML(page)
+	if err != nil {
+		t.Fatalf("unexpected error rendering android landing page %v", err)
+	}
+	if !strings.Contains(android, `<a id="download" href="https://proxy/app-1/download?artifact=true&amp;token=a%3cb">`) {
+		t.Fatalf("expected an escaped download button but got \n%s", android)
+	}
+
+	page = LandingPage{Build: "app-1", BuildType: "ios", ManifestUrl: "https://proxy/app-1/download?plist=true"}
+	ios, err := ProduceLandingHTML(page)
+	if err != nil {
+		t.Fatalf("unexpected error rendering ios landing page %v", err)
+	}
+	if ios != ProduceHTML(page.ManifestUrl) {
+		t.Fatalf("expected the itms-services landing page for ios but got \n%s", ios)
+	}
+}
+
+func TestProduceLandingHTMLReleaseNotes(t *testing.T) {
+	notes := template.HTML("<p>Faster <em>startup</em></p>")
+	page := LandingPage{Build: "app-1", BuildType: "android", DownloadUrl: "https://proxy/app-1/download?artifact=true", ReleaseNotes: notes}
+	android, err := ProduceLandingHTML(page)
+	if err != nil {
+		t.Fatalf("unexpected error rendering android landing page %v", err)
+	}
+	if !strings.Contains(android, `<div id="release-notes"><p>Faster <em>startup</em></p></div>`) {
+		t.Fatalf("expected the release notes on the android page but got \n%s", android)
+	}
+
+	page = LandingPage{Build: "app-1", BuildType: "ios", ItmsServicesUrl: "itms-services://?action=download-manifest&url=x", ReleaseNotes: notes}
+	ios, err := ProduceLandingHTML(page)
+	if err != nil {
+		t.Fatalf("unexpected error rendering ios landing page %v", err)
+	}
+	if !strings.Contains(ios, `<div id="release-notes"><p>Faster <em>startup</em></p></div>`) || !strings.Contains(ios, `window.location = "itms-services://?action=download-manifest\u0026url=x"`) {
+		t.Fatalf("expected the release notes and install on the ios page but got \n%s", ios)
+	}
+}
+
+func TestValidateManifestUrl(t *testing.T) {
+	valid := []string{
+		"https://proxy.example.com/app-1/download?artifact=true&token=a%26b",
+		"https://proxy.example.com:8443/app-1/download?artifact=true&reason=QA+sign-off",
+	}
+	for _, u := range valid {
+		if err := ValidateManifestUrl(u); err != nil {
+			t.Errorf("expected %s to be valid but got %s", u, err.Error())
+		}
+	}
+	invalid := []string{
+		"http://proxy.example.com/app-1/download?artifact=true",
+		"https:///app-1/download?artifact=true",
+		"/app-1/download?artifact=true",
+		"https://proxy%20example.com/app-1/download",
+		"https://proxy.example.com/app 1/download?artifact=true",
+		"https://proxy.example.com/app-1/download?token=a%zz",
+		"https://proxy.example.com/app-1/download?token=<b>",
+	}
+	for _, u := range invalid {
+		if err := ValidateManifestUrl(u); err == nil {
+			t.Errorf("expected %s to be rejected", u)
+		}
+	}
+}
+
+func TestProduceIndexHTML(t *testing.T) {
+	page, err := ProduceIndexHTML(IndexPage{Build: "app-1", Platforms: []PlatformLink{
+		{Platform: "android", Label: "Download for Android", Url: "https://proxy/app-1/download?platform=android&token=a<b"},
+		{Platform: "ios", Label: "Install on iOS", Url: "itms-services://?action=download-manifest&url=x"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error rendering index page %v", err)
+	}
+	if !strings.Contains(page, `<a id="android" href="https://proxy/app-1/download?platform=android&amp;token=a%3cb">Download for Android</a>`) {
+		t.Fatalf("expected an escaped android button but got \n%s", page)
+	}
+	if !strings.Contains(page, `<a id="ios" href="itms-services://?action=download-manifest&amp;url=x">Install on iOS</a>`) {
+		t.Fatalf("expected the itms-services link to be kept but got \n%s", page)
+	}
 }
@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm   = "AWS4-HMAC-SHA256"
+	amzDate     = "20060102T150405Z"
+	shortDate   = "20060102"
+	maxPresign  = 7 * 24 * time.Hour
+	serviceName = "s3"
+)
+
+//Presigner creates presigned S3 GET urls. Urls are signed with AWS signature version 4 using query parameters, so they
+//can be handed to a client which has no credentials of its own
+type Presigner struct {
+	Region          string
+	Endpoint        *url.URL
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	//PathStyle puts the bucket in the path rather than the host, which S3 compatible stores often need
+	PathStyle bool
+	now       func() time.Time
+}
+
+//NewPresignerFromEnv configures a presigner from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, the optional
+//AWS_SESSION_TOKEN, S3_REGION, S3_ENDPOINT and S3_FORCE_PATH_STYLE
+func NewPresignerFromEnv() (*Presigner, error) {
+	p := &Presigner{
+		Region:          os.Getenv("S3_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		PathStyle:       os.Getenv("S3_FORCE_PATH_STYLE") == "true",
+	}
+	if p.AccessKeyID == "" || p.SecretAccessKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to presign S3 urls")
+	}
+	if p.Region == "" {
+		p.Region = "us-east-1"
+	}
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://s3." + p.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("invalid S3_ENDPOINT " + endpoint)
+	}
+	p.Endpoint = u
+	return p, nil
+}
+
+//ParseLocation splits an s3://bucket/key location into its bucket and key
+func ParseLocation(location string) (string, string, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "s3" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return "", "", errors.New("invalid S3 location " + location + ", expected s3://bucket/key")
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+//PresignGet returns a url for reading key from bucket which is valid for ttl. params are added to the signed url, e.g.
+//response-content-disposition to have S3 override the headers it responds with
+func (p *Presigner) PresignGet(bucket string, key string, ttl time.Duration, params url.Values) (string, error) {
+	if ttl <= 0 || ttl > maxPresign {
+		return "", fmt.Errorf("presigned url lifetime %s must be between 1s and %s", ttl, maxPresign)
+	}
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	signedAt := now().UTC()
+	scope := strings.Join([]string{signedAt.Format(shortDate), p.Region, serviceName, "aws4_request"}, "/")
+
+	host, path := p.Endpoint.Host, "/"+bucket+"/"+key
+	if !p.PathStyle {
+		host, path = bucket+"."+p.Endpoint.Host, "/"+key
+	}
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", p.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", signedAt.Format(amzDate))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if p.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+
+	canonicalURI := encodePath(path)
+	canonicalQuery := encodeQuery(query)
+	canonicalRequest := strings.Join([]string{"GET", canonicalURI, canonicalQuery, "host:" + host + "\n", "host", "UNSIGNED-PAYLOAD"}, "\n")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{algorithm, signedAt.Format(amzDate), scope, hex.EncodeToString(hashed[:])}, "\n")
+
+	key4 := hmacSHA256([]byte("AWS4"+p.SecretAccessKey), signedAt.Format(shortDate))
+	key4 = hmacSHA256(key4, p.Region)
+	key4 = hmacSHA256(key4, serviceName)
+	key4 = hmacSHA256(key4, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key4, stringToSign))
+
+	return p.Endpoint.Scheme + "://" + host + canonicalURI + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+//encodeQuery sorts and encodes query parameters the way signature version 4 expects
+func encodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func encodePath(path string) string {
+	return uriEncode(path, false)
+}
+
+//uriEncode percent encodes everything but the unreserved characters, and the / separator when encoding a path
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}